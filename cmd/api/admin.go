@@ -0,0 +1,44 @@
+// Filename: cmd/api/admin.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"quiz3.desireamagwula.net/internal/data"
+)
+
+// unlockUserHandler for the "DELETE /v1/admin/users/:id/lockout" endpoint.
+// It clears the login and two-factor lockouts of an account.
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Lockouts.Clear(data.AccountThrottleKey(user.Email))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.TOTP.ResetFailures(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "account successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,131 @@
+// Filename: cmd/api/apikeys_test.go
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+func TestRequireScope(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{ID: 1, Name: "Alice"}
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	tests := []struct {
+		name    string
+		key     *data.APIKey
+		handler http.HandlerFunc
+		want    int
+	}{
+		{"login token on a scoped route", nil, app.requireScope(data.ScopeNotesWrite, app.requireAuthenticatedUser(ok)), http.StatusNoContent},
+		{"login token on an account route", nil, app.requireAuthenticatedUser(ok), http.StatusNoContent},
+		{"read key reading", &data.APIKey{Scopes: []string{data.ScopeNotesRead}}, app.requireScope(data.ScopeNotesRead, app.requireAuthenticatedUser(ok)), http.StatusNoContent},
+		{"read key writing", &data.APIKey{Scopes: []string{data.ScopeNotesRead}}, app.requireScope(data.ScopeNotesWrite, app.requireAuthenticatedUser(ok)), http.StatusForbidden},
+		{"write key reading", &data.APIKey{Scopes: []string{data.ScopeNotesWrite}}, app.requireScope(data.ScopeNotesRead, app.requireAuthenticatedUser(ok)), http.StatusForbidden},
+		{"write key writing", &data.APIKey{Scopes: data.APIKeyScopes}, app.requireScope(data.ScopeNotesWrite, app.requireAuthenticatedUser(ok)), http.StatusNoContent},
+		{"key on an account route", &data.APIKey{Scopes: data.APIKeyScopes}, app.requireAuthenticatedUser(ok), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = app.contextSetUser(r, user)
+			if tt.key != nil {
+				r = app.contextSetAPIKey(r, tt.key)
+			}
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+			wantStatus(t, w, tt.want)
+		})
+	}
+}
+
+func TestValidateAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		valid  bool
+	}{
+		{[]string{data.ScopeNotesRead}, true},
+		{[]string{data.ScopeNotesRead, data.ScopeNotesWrite}, true},
+		{[]string{}, false},
+		{[]string{data.ScopeNotesRead, data.ScopeNotesRead}, false},
+		{[]string{"admin"}, false},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		data.ValidateAPIKey(v, &data.APIKey{Name: "cron", Scopes: tt.scopes})
+		if v.Valid() != tt.valid {
+			t.Errorf("scopes %q: got valid %t, want %t (%v)", tt.scopes, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
+
+// API keys reach the Note routes their scopes allow and nothing else
+func TestAPIKeyScopes(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	note := app.newTestNote(t, alice, alice.workspace.ID, "existing")
+	newKey := func(scopes string) string {
+		w := app.do(t, http.MethodPost, "/v1/api-keys", alice.token, fmt.Sprintf(`{"name":"script","scopes":%s}`, scopes))
+		wantStatus(t, w, http.StatusCreated)
+		return decodeBody(t, w)["api_key"].(map[string]interface{})["key"].(string)
+	}
+	readKey := newKey(`["notes:read"]`)
+	writeKey := newKey(`["notes:write"]`)
+	body := `{"task_name":"from a script","description":"d","category":"c","priority":"low","status":["todo"]}`
+
+	wantStatus(t, app.do(t, http.MethodGet, "/v1/Notes", readKey, ""), http.StatusOK)
+	wantStatus(t, app.do(t, http.MethodGet, fmt.Sprintf("/v1/Notes/%d", note.ID), readKey, ""), http.StatusOK)
+	wantStatus(t, app.do(t, http.MethodPost, "/v1/Notes", readKey, body), http.StatusForbidden)
+	wantStatus(t, app.do(t, http.MethodDelete, fmt.Sprintf("/v1/Notes/%d", note.ID), readKey, ""), http.StatusForbidden)
+
+	wantStatus(t, app.do(t, http.MethodGet, "/v1/Notes", writeKey, ""), http.StatusForbidden)
+	wantStatus(t, app.do(t, http.MethodPost, "/v1/Notes", writeKey, body), http.StatusCreated)
+
+	// No key can manage keys or the account, whatever its scopes
+	for _, key := range []string{readKey, writeKey} {
+		wantStatus(t, app.do(t, http.MethodGet, "/v1/api-keys", key, ""), http.StatusForbidden)
+		wantStatus(t, app.do(t, http.MethodPost, "/v1/api-keys", key, `{"name":"escalated"}`), http.StatusForbidden)
+		wantStatus(t, app.do(t, http.MethodGet, "/v1/users/me/sessions", key, ""), http.StatusForbidden)
+	}
+
+	// A read key can query but not mutate through GraphQL
+	w := app.do(t, http.MethodPost, "/v1/graphql", readKey, `{"query":"{ notes { edges { node { taskName } } } }"}`)
+	wantStatus(t, w, http.StatusOK)
+	if _, ok := decodeBody(t, w)["errors"]; ok {
+		t.Errorf("read key query: got errors %s", w.Body.String())
+	}
+	w = app.do(t, http.MethodPost, "/v1/graphql", readKey, fmt.Sprintf(`{"query":"mutation { deleteNote(id: %d) }"}`, note.ID))
+	if !bytes.Contains(w.Body.Bytes(), []byte("api_key_not_permitted")) {
+		t.Errorf("read key mutation: got %s, want an api_key_not_permitted error", w.Body.String())
+	}
+}
+
+// Revoked and expired keys are rejected like any other invalid token
+func TestAPIKeyRevokedOrExpired(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	key := &data.APIKey{UserID: alice.ID, Name: "script", Scopes: data.APIKeyScopes}
+	if err := app.models.APIKeys.New(key); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(t, app.do(t, http.MethodGet, "/v1/Notes", key.Plaintext, ""), http.StatusOK)
+	wantStatus(t, app.do(t, http.MethodDelete, fmt.Sprintf("/v1/api-keys/%d", key.ID), alice.token, ""), http.StatusOK)
+	wantStatus(t, app.do(t, http.MethodGet, "/v1/Notes", key.Plaintext, ""), http.StatusUnauthorized)
+
+	expiry := time.Now().Add(time.Second)
+	expiring := &data.APIKey{UserID: alice.ID, Name: "expiring", Scopes: data.APIKeyScopes, Expiry: &expiry}
+	if err := app.models.APIKeys.New(expiring); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(expiry) + 100*time.Millisecond)
+	wantStatus(t, app.do(t, http.MethodGet, "/v1/Notes", expiring.Plaintext, ""), http.StatusUnauthorized)
+}
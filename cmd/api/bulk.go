@@ -0,0 +1,324 @@
+// Filename: cmd/api/bulk.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// The most items a single bulk request may hold
+const maxBulkItems = 500
+
+// A bulkItemError fails one item of a bulk request with its own status
+type bulkItemError struct {
+	status  int
+	message interface{}
+}
+
+func (e bulkItemError) Error() string {
+	return http.StatusText(e.status)
+}
+
+// A bulkResult reports the outcome of one item of a bulk request
+type bulkResult struct {
+	Index  int         `json:"index"`
+	Status int         `json:"status"`
+	Note   *data.Note  `json:"Note,omitempty"`
+	ID     int64       `json:"id,omitempty"`
+	Error  interface{} `json:"error,omitempty"`
+}
+
+// readBulkMode() reads the mode query parameter. In atomic mode, the default,
+// nothing is changed unless every item succeeds. In partial mode the items
+// that succeed are kept.
+func (app *application) readBulkMode(r *http.Request, v *validator.Validator) bool {
+	mode := app.readString(r.URL.Query(), "mode", "atomic")
+	v.Check(validator.In(mode, "atomic", "partial"), "mode", "must be atomic or partial")
+	return mode == "atomic"
+}
+
+// itemOutcome() turns the error of a bulk item into its status and message
+func (app *application) itemOutcome(r *http.Request, err error) (int, interface{}) {
+	var itemErr bulkItemError
+	switch {
+	case errors.As(err, &itemErr):
+		return itemErr.status, itemErr.message
+	case errors.Is(err, data.ErrRecordNotFound):
+		return http.StatusNotFound, "The requested resource could not be found"
+	case errors.Is(err, data.ErrEditConflict):
+		return http.StatusConflict, "unable to update the record due to an edit conflict, please try again"
+	default:
+		app.logError(r, err)
+		return http.StatusInternalServerError, "the server encountered a problem and could not proceed"
+	}
+}
+
+// writeBulkResponse() answers a bulk request. Atomic requests that failed
+// get the status of their first failing item and the errors keyed by index.
+// Otherwise every item is reported, with 207 Multi-Status in partial mode.
+func (app *application) writeBulkResponse(w http.ResponseWriter, r *http.Request, atomic bool, successStatus int, results []bulkResult) {
+	if atomic {
+		failed := map[string]interface{}{}
+		status := 0
+		for _, result := range results {
+			if result.Error == nil {
+				continue
+			}
+			if result.Status == http.StatusInternalServerError {
+				app.serverErrorResponse(w, r, errors.New("bulk item failed"))
+				return
+			}
+			if status == 0 {
+				status = result.Status
+			}
+			failed[strconv.Itoa(result.Index)] = result.Error
+		}
+		if status != 0 {
+			app.errorResponse(w, r, status, "bulk_failed", failed)
+			return
+		}
+	} else {
+		successStatus = http.StatusMultiStatus
+	}
+	err := app.writeJSON(w, r, successStatus, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readBulkItems() reads the items of a bulk request body into dst, a
+// pointer to a slice. The items are listed under "Notes" in version 1 and
+// "notes" in version 2. JSON decoding ignores the case of keys, so the key
+// is checked here and the other version's is rejected.
+func (app *application) readBulkItems(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	var body map[string]json.RawMessage
+	err := app.readJSON(w, r, &body)
+	if err != nil {
+		return err
+	}
+	key := app.notesKey(r)
+	for k := range body {
+		if k != key {
+			return fmt.Errorf("body contains unknown key %q", k)
+		}
+	}
+	items, ok := body[key]
+	if !ok {
+		// validateBulkSize() reports the missing items
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(items))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(dst)
+	if err != nil {
+		return decodeError(err, len(items))
+	}
+	return nil
+}
+
+// validateBulkSize() checks the number of items in a bulk request
+func validateBulkSize(v *validator.Validator, key string, n int) {
+	v.Check(n >= 1, key, "must contain at least one entry")
+	v.Check(n <= maxBulkItems, key, "must not contain more than "+strconv.Itoa(maxBulkItems)+" entries")
+}
+
+// bulkCreateNotesHandler for the "POST /v1/Notes/bulk" endpoint
+func (app *application) bulkCreateNotesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Notes []struct {
+			Task_Name   string   `json:"task_name"`
+			Description string   `json:"description"`
+			Category    string   `json:"category"`
+			Priority    string   `json:"priority"`
+			Status      []string `json:"status"`
+		}
+	}
+	err := app.readBulkItems(w, r, &input.Notes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	atomic := app.readBulkMode(r, v)
+	validateBulkSize(v, app.notesKey(r), len(input.Notes))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Validate every Note up front. Only the valid ones reach the database.
+	results := make([]bulkResult, len(input.Notes))
+	valid := []*data.Note{}
+	indexes := []int{}
+	for i, item := range input.Notes {
+		Note := &data.Note{
+			Task_Name:   item.Task_Name,
+			Description: item.Description,
+			Category:    item.Category,
+			Priority:    item.Priority,
+			Status:      item.Status,
+		}
+		results[i].Index = i
+		v := validator.New()
+		if app.validateNote(r, v, Note); !v.Valid() {
+			results[i].Status = http.StatusUnprocessableEntity
+			results[i].Error = v.Errors
+			continue
+		}
+		valid = append(valid, Note)
+		indexes = append(indexes, i)
+	}
+	if atomic && len(valid) < len(input.Notes) {
+		app.writeBulkResponse(w, r, atomic, http.StatusCreated, results)
+		return
+	}
+	tenant := app.contextGetTenant(r)
+	errs, err := app.models.Notes.InsertMany(tenant, valid, atomic)
+	if err != nil && !errors.Is(err, data.ErrBulkRolledBack) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for j, i := range indexes {
+		if errs[j] != nil {
+			results[i].Status, results[i].Error = app.itemOutcome(r, errs[j])
+			continue
+		}
+		results[i].Status = http.StatusCreated
+		results[i].Note = valid[j]
+	}
+	app.writeBulkResponse(w, r, atomic, http.StatusCreated, results)
+}
+
+// bulkUpdateNotesHandler for the "PATCH /v1/Notes/bulk" endpoint. Each item
+// names a Note, the version it was read at, and the fields to change.
+func (app *application) bulkUpdateNotesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Notes []struct {
+			ID          int64    `json:"id"`
+			Version     int32    `json:"version"`
+			Task_Name   *string  `json:"task_name"`
+			Description *string  `json:"description"`
+			Category    *string  `json:"category"`
+			Priority    *string  `json:"priority"`
+			Status      []string `json:"status"`
+		}
+	}
+	err := app.readBulkItems(w, r, &input.Notes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	atomic := app.readBulkMode(r, v)
+	validateBulkSize(v, app.notesKey(r), len(input.Notes))
+	ids := make([]int64, len(input.Notes))
+	for i, item := range input.Notes {
+		key := app.notesKey(r) + "." + strconv.Itoa(i)
+		v.Check(item.ID > 0, key+".id", "must be provided")
+		v.Check(item.Version > 0, key+".version", "must be provided")
+		ids[i] = item.ID
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tenant := app.contextGetTenant(r)
+	notes, errs, err := app.models.Notes.UpdateMany(tenant, ids, atomic, func(i int, Note *data.Note) error {
+		item := input.Notes[i]
+		if Note.Version != item.Version {
+			return data.ErrEditConflict
+		}
+		if item.Task_Name != nil {
+			Note.Task_Name = *item.Task_Name
+		}
+		if item.Description != nil {
+			Note.Description = *item.Description
+		}
+		if item.Category != nil {
+			Note.Category = *item.Category
+		}
+		if item.Priority != nil {
+			Note.Priority = *item.Priority
+		}
+		if item.Status != nil {
+			Note.Status = item.Status
+		}
+		v := validator.New()
+		if app.validateNote(r, v, Note); !v.Valid() {
+			return bulkItemError{status: http.StatusUnprocessableEntity, message: v.Errors}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, data.ErrBulkRolledBack) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	results := make([]bulkResult, len(ids))
+	for i := range ids {
+		results[i].Index = i
+		if errs[i] != nil {
+			results[i].Status, results[i].Error = app.itemOutcome(r, errs[i])
+			continue
+		}
+		results[i].Status = http.StatusOK
+		results[i].Note = notes[i]
+	}
+	app.writeBulkResponse(w, r, atomic, http.StatusOK, results)
+}
+
+// bulkDeleteNotesHandler for the "DELETE /v1/Notes/bulk" endpoint. The
+// optional versions list the version each Note was read at, in the same order
+// as the ids, and are required when preconditions are strict.
+func (app *application) bulkDeleteNotesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs      []int64 `json:"ids"`
+		Versions []int32 `json:"versions"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	atomic := app.readBulkMode(r, v)
+	validateBulkSize(v, "ids", len(input.IDs))
+	for _, id := range input.IDs {
+		v.Check(id > 0, "ids", "must only contain positive ids")
+	}
+	if input.Versions != nil {
+		v.Check(len(input.Versions) == len(input.IDs), "versions", "must contain one entry for each id")
+		for _, version := range input.Versions {
+			v.Check(version > 0, "versions", "must only contain positive versions")
+		}
+	} else if app.config.preconditions.strict {
+		v.AddError("versions", "must be provided")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tenant := app.contextGetTenant(r)
+	errs, err := app.models.Notes.DeleteMany(tenant, input.IDs, input.Versions, atomic)
+	if err != nil && !errors.Is(err, data.ErrBulkRolledBack) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	results := make([]bulkResult, len(input.IDs))
+	for i, id := range input.IDs {
+		results[i].Index = i
+		results[i].ID = id
+		if errs[i] != nil {
+			results[i].Status, results[i].Error = app.itemOutcome(r, errs[i])
+			continue
+		}
+		results[i].Status = http.StatusOK
+	}
+	app.writeBulkResponse(w, r, atomic, http.StatusOK, results)
+}
@@ -0,0 +1,152 @@
+// Filename: cmd/api/bulk_test.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"quiz3.desireamagwula.net/internal/data"
+)
+
+func TestWriteBulkResponse(t *testing.T) {
+	app := newTestApplication(t)
+	ok := []bulkResult{{Index: 0, Status: http.StatusOK, ID: 1}, {Index: 1, Status: http.StatusOK, ID: 2}}
+	mixed := []bulkResult{
+		{Index: 0, Status: http.StatusOK, ID: 1},
+		{Index: 1, Status: http.StatusNotFound, ID: 2, Error: "not found"},
+		{Index: 2, Status: http.StatusConflict, ID: 3, Error: "conflict"},
+	}
+	broken := []bulkResult{{Index: 0, Status: http.StatusInternalServerError, Error: "boom"}}
+	tests := []struct {
+		name    string
+		atomic  bool
+		results []bulkResult
+		status  int
+		// The keys of the body, and the number of entries under the key
+		key     string
+		entries int
+	}{
+		{"atomic success", true, ok, http.StatusOK, "results", 2},
+		// The status of the first failure, with only the failures by index
+		{"atomic failure", true, mixed, http.StatusNotFound, "error", 2},
+		{"atomic server error", true, broken, http.StatusInternalServerError, "error", 0},
+		// Every item is reported, whatever happened to it
+		{"partial success", false, ok, http.StatusMultiStatus, "results", 2},
+		{"partial failure", false, mixed, http.StatusMultiStatus, "results", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.writeBulkResponse(w, httptest.NewRequest(http.MethodPost, "/v1/Notes/bulk", nil), tt.atomic, http.StatusOK, tt.results)
+			wantStatus(t, w, tt.status)
+			body := decodeBody(t, w)
+			switch value := body[tt.key].(type) {
+			case []interface{}:
+				if len(value) != tt.entries {
+					t.Errorf("got %d results, want %d", len(value), tt.entries)
+				}
+			case map[string]interface{}:
+				if len(value) != tt.entries {
+					t.Errorf("got %d errors, want %d", len(value), tt.entries)
+				}
+				if tt.entries > 0 && (value["1"] != "not found" || value["2"] != "conflict") {
+					t.Errorf("got errors %v, want them keyed by index", value)
+				}
+			case string:
+				if tt.entries != 0 {
+					t.Errorf("got error %q, want %d errors", value, tt.entries)
+				}
+			default:
+				t.Errorf("got body %s, want a %q key", w.Body.String(), tt.key)
+			}
+		})
+	}
+}
+
+// notesIn() counts the Notes of the user
+func (app *application) notesIn(t *testing.T, user *testUser) int {
+	t.Helper()
+	w := app.do(t, http.MethodGet, "/v1/Notes", user.token, "")
+	wantStatus(t, w, http.StatusOK)
+	return len(decodeBody(t, w)["Notes"].([]interface{}))
+}
+
+// One bad item fails an atomic request without changing anything, while a
+// partial request keeps the items that succeeded
+func TestBulkCreateModes(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	body := `{"Notes":[` +
+		`{"task_name":"good","description":"d","category":"c","priority":"low","status":["todo"]},` +
+		`{"task_name":"","description":"d","category":"c","priority":"low","status":["todo"]},` +
+		`{"task_name":"also good","description":"d","category":"c","priority":"low","status":["todo"]}]}`
+
+	w := app.do(t, http.MethodPost, "/v1/Notes/bulk", alice.token, body)
+	wantStatus(t, w, http.StatusUnprocessableEntity)
+	if failed := decodeBody(t, w)["error"].(map[string]interface{}); len(failed) != 1 || failed["1"] == nil {
+		t.Errorf("got errors %v, want one for item 1", failed)
+	}
+	if n := app.notesIn(t, alice); n != 0 {
+		t.Errorf("atomic request left %d Notes", n)
+	}
+
+	w = app.do(t, http.MethodPost, "/v1/Notes/bulk?mode=partial", alice.token, body)
+	wantStatus(t, w, http.StatusMultiStatus)
+	results := decodeBody(t, w)["results"].([]interface{})
+	for i, want := range []float64{http.StatusCreated, http.StatusUnprocessableEntity, http.StatusCreated} {
+		if got := results[i].(map[string]interface{})["status"]; got != want {
+			t.Errorf("item %d: got status %v, want %v", i, got, want)
+		}
+	}
+	if n := app.notesIn(t, alice); n != 2 {
+		t.Errorf("partial request left %d Notes, want 2", n)
+	}
+
+	wantStatus(t, app.do(t, http.MethodPost, "/v1/Notes/bulk?mode=some", alice.token, body), http.StatusUnprocessableEntity)
+}
+
+// A failure found in the database, after earlier items were written, rolls
+// the atomic request back
+func TestBulkUpdateModes(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	first := app.newTestNote(t, alice, alice.workspace.ID, "first")
+	second := app.newTestNote(t, alice, alice.workspace.ID, "second")
+	bob := app.newTestUser(t, "Bob")
+	other := app.newTestNote(t, bob, bob.workspace.ID, "Bob's")
+	priorityOf := func(note *data.Note) string {
+		w := app.do(t, http.MethodGet, fmt.Sprintf("/v1/Notes/%d", note.ID), alice.token, "")
+		wantStatus(t, w, http.StatusOK)
+		return decodeBody(t, w)["Note"].(map[string]interface{})["priority"].(string)
+	}
+	body := fmt.Sprintf(`{"Notes":[{"id":%d,"version":%d,"priority":"high"},{"id":%d,"version":%d,"priority":"high"},{"id":%d,"version":1,"priority":"high"}]}`,
+		first.ID, first.Version, second.ID, second.Version+1, other.ID)
+
+	w := app.do(t, http.MethodPatch, "/v1/Notes/bulk", alice.token, body)
+	wantStatus(t, w, http.StatusConflict)
+	if failed := decodeBody(t, w)["error"].(map[string]interface{}); len(failed) != 2 || failed["1"] == nil || failed["2"] == nil {
+		t.Errorf("got errors %v, want ones for items 1 and 2", failed)
+	}
+	if p := priorityOf(first); p != "low" {
+		t.Errorf("atomic request changed the first Note to %q", p)
+	}
+
+	w = app.do(t, http.MethodPatch, "/v1/Notes/bulk?mode=partial", alice.token, body)
+	wantStatus(t, w, http.StatusMultiStatus)
+	results := decodeBody(t, w)["results"].([]interface{})
+	// Another workspace's Note is not found rather than forbidden
+	for i, want := range []float64{http.StatusOK, http.StatusConflict, http.StatusNotFound} {
+		if got := results[i].(map[string]interface{})["status"]; got != want {
+			t.Errorf("item %d: got status %v, want %v", i, got, want)
+		}
+	}
+	if p := priorityOf(first); p != "high" {
+		t.Errorf("partial request left the first Note at %q", p)
+	}
+	if p := priorityOf(second); p != "low" {
+		t.Errorf("partial request changed the conflicting Note to %q", p)
+	}
+}
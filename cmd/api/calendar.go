@@ -0,0 +1,312 @@
+// Filename: cmd/api/calendar.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/ical"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+const (
+	// How long a calendar feed URL works before it has to be replaced
+	calendarFeedTTL = 365 * 24 * time.Hour
+	// The domain that makes the UIDs of our to-dos globally unique
+	calendarUIDDomain = "quiz3.desireamagwula.net"
+	// The layout of UTC date-times in iCalendar
+	icalTimeLayout = "20060102T150405Z"
+)
+
+// The PRIORITY written for each Note priority. RFC 5545 counts 1 as the
+// highest and 9 as the lowest; other priorities are left undefined.
+var icalPriorities = map[string]int{"high": 1, "medium": 5, "low": 9}
+
+// The Note status written for each VTODO STATUS on import
+var icalStatuses = map[string]string{
+	"NEEDS-ACTION": "todo",
+	"IN-PROCESS":   "in progress",
+	"COMPLETED":    "done",
+	"CANCELLED":    "cancelled",
+}
+
+// createCalendarFeedHandler for the "POST /v1/users/me/calendar-feed"
+// endpoint. It returns the secret URL of the user's calendar feed, replacing
+// any URL given out before.
+func (app *application) createCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.models.Tokens.New(user.ID, calendarFeedTTL, data.ScopeCalendarFeed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	feed := map[string]interface{}{
+		"url":    fmt.Sprintf("%s://%s%s?token=%s", scheme, r.Host, app.versionedPath(r, "/v1/calendar.ics"), token.Plaintext),
+		"expiry": token.Expiry,
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"calendar_feed": feed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCalendarFeedHandler for the "DELETE /v1/users/me/calendar-feed"
+// endpoint. The feed URL stops working.
+func (app *application) deleteCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "calendar feed successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// calendarFeedHandler for the "GET /v1/calendar.ics" endpoint. Calendar apps
+// can't send an Authorization header, so the feed is authenticated by the
+// token in its URL instead. The Notes of the user's personal workspace are
+// streamed as VTODO components.
+func (app *application) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.invalidFeedTokenResponse(w, r)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeCalendarFeed, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidFeedTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	workspace, err := app.models.Workspaces.GetPersonal(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	cw := ical.NewWriter(w)
+	now := time.Now().UTC().Format(icalTimeLayout)
+	// As with exports, nothing is sent until the first Note is read
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="notes.ics"`)
+		w.WriteHeader(http.StatusOK)
+		cw.Begin("VCALENDAR")
+		cw.Property("VERSION", nil, "2.0")
+		cw.Text("PRODID", "-//"+calendarUIDDomain+"//Notes//EN")
+		cw.Property("CALSCALE", nil, "GREGORIAN")
+		cw.Property("METHOD", nil, "PUBLISH")
+		cw.Text("X-WR-CALNAME", "Notes")
+		started = true
+	}
+	app.streamFor(w, r, exportTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+	defer cancel()
+	tenant := data.Tenant{UserID: user.ID, WorkspaceID: workspace.ID}
+	filters := data.Filters{Sort: "id", SortList: noteSortList}
+	err = app.models.Notes.Export(ctx, tenant, data.NoteFilter{}, filters, func(Note *data.Note) error {
+		if !started {
+			start()
+		}
+		writeVTODO(cw, Note, now)
+		return nil
+	})
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.logError(r, err)
+		return
+	}
+	if !started {
+		start()
+	}
+	cw.End("VCALENDAR")
+	err = cw.Flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// writeVTODO() writes a Note as a VTODO. The full status list goes in an
+// X-NOTES-STATUS property so that importing the feed gets it back.
+func writeVTODO(cw *ical.Writer, Note *data.Note, now string) {
+	cw.Begin("VTODO")
+	cw.Property("UID", nil, fmt.Sprintf("note-%d@%s", Note.ID, calendarUIDDomain))
+	cw.Property("DTSTAMP", nil, now)
+	cw.Property("CREATED", nil, Note.CreatedAt.UTC().Format(icalTimeLayout))
+	cw.Property("SEQUENCE", nil, strconv.Itoa(int(Note.Version)-1))
+	cw.Text("SUMMARY", Note.Task_Name)
+	cw.Text("DESCRIPTION", Note.Description)
+	cw.Text("CATEGORIES", Note.Category)
+	if priority, ok := icalPriorities[strings.ToLower(Note.Priority)]; ok {
+		cw.Property("PRIORITY", nil, strconv.Itoa(priority))
+	}
+	cw.Property("STATUS", nil, icalStatus(Note.Status))
+	escaped := make([]string, len(Note.Status))
+	for i, status := range Note.Status {
+		escaped[i] = ical.EscapeText(status)
+	}
+	cw.Property("X-NOTES-STATUS", nil, strings.Join(escaped, ","))
+	cw.End("VTODO")
+}
+
+// icalStatus() picks the VTODO STATUS that best describes a Note's statuses
+func icalStatus(statuses []string) string {
+	found := map[string]bool{}
+	for _, status := range statuses {
+		switch strings.ToLower(status) {
+		case "done", "complete", "completed":
+			found["COMPLETED"] = true
+		case "cancelled", "canceled":
+			found["CANCELLED"] = true
+		case "in progress", "in-progress", "doing", "started":
+			found["IN-PROCESS"] = true
+		}
+	}
+	for _, status := range []string{"COMPLETED", "CANCELLED", "IN-PROCESS"} {
+		if found[status] {
+			return status
+		}
+	}
+	return "NEEDS-ACTION"
+}
+
+// importCalendarHandler for the "POST /v1/calendar/import" endpoint. Every
+// VTODO in the text/calendar body becomes a Note in a single transaction, so
+// nothing is imported unless every to-do is valid. Errors are keyed by the
+// line the VTODO begins on.
+func (app *application) importCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if mediaType != "text/calendar" {
+			app.badRequestResponse(w, r, errors.New("the body must be text/calendar"))
+			return
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	components, err := ical.Parse(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxImportBytes)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	todos := []*ical.Component{}
+	for _, c := range components {
+		if c.Name == "VTODO" {
+			todos = append(todos, c)
+			continue
+		}
+		for _, child := range c.Components {
+			if child.Name == "VTODO" {
+				todos = append(todos, child)
+			}
+		}
+	}
+	v := validator.New()
+	validateBulkSize(v, "VTODO", len(todos))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	rows := []importRow{}
+	rowErrors := map[string]map[string]string{}
+	for _, todo := range todos {
+		Note := noteFromVTODO(todo)
+		v := validator.New()
+		if app.validateNote(r, v, Note); !v.Valid() {
+			rowErrors[strconv.Itoa(todo.Line)] = v.Errors
+			continue
+		}
+		rows = append(rows, importRow{line: todo.Line, note: Note})
+	}
+	if len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", rowErrors)
+		return
+	}
+	_, failures, err := app.importRows(app.contextGetTenant(r), rows)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if len(failures) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "import_failed", failures)
+		return
+	}
+	notes := make([]*data.Note, len(rows))
+	for i, row := range rows {
+		notes[i] = row.note
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"Notes": notes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// noteFromVTODO() reads a Note from a VTODO. Every CATEGORIES value is kept,
+// joined by commas. A to-do without a PRIORITY gets medium, and one without
+// a STATUS is still to do.
+func noteFromVTODO(todo *ical.Component) *data.Note {
+	Note := &data.Note{Priority: "medium"}
+	if summary, ok := todo.Get("SUMMARY"); ok {
+		Note.Task_Name = summary.Text()
+	}
+	if description, ok := todo.Get("DESCRIPTION"); ok {
+		Note.Description = description.Text()
+	}
+	categories := []string{}
+	for _, prop := range todo.All("CATEGORIES") {
+		categories = append(categories, ical.SplitList(prop.Value)...)
+	}
+	Note.Category = strings.Join(categories, ", ")
+	if prop, ok := todo.Get("PRIORITY"); ok {
+		// A malformed priority is treated as undefined, like 0
+		priority, _ := strconv.Atoi(strings.TrimSpace(prop.Value))
+		switch {
+		case priority >= 1 && priority <= 4:
+			Note.Priority = "high"
+		case priority >= 6 && priority <= 9:
+			Note.Priority = "low"
+		}
+	}
+	if prop, ok := todo.Get("X-NOTES-STATUS"); ok {
+		Note.Status = ical.SplitList(prop.Value)
+	} else if prop, ok := todo.Get("STATUS"); ok {
+		if status, ok := icalStatuses[strings.ToUpper(prop.Value)]; ok {
+			Note.Status = []string{status}
+		}
+	} else {
+		Note.Status = []string{"todo"}
+	}
+	return Note
+}
@@ -0,0 +1,80 @@
+// Filename: cmd/api/calendar_test.go
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/ical"
+)
+
+// A Note written as a VTODO reads back as the same Note, including text
+// that needs escaping and characters that fall on a fold
+func TestVTODORoundTrip(t *testing.T) {
+	notes := []*data.Note{
+		{
+			Task_Name:   "Plan the trip; pack, book",
+			Description: strings.Repeat("x", 60) + "Übernachtung in Zürich 😀\nthen a second line with a back\\slash",
+			Category:    "travel, family",
+			Priority:    "high",
+			Status:      []string{"todo", "waiting, on others"},
+		},
+		{Task_Name: "Medium", Description: "d", Category: "c", Priority: "medium", Status: []string{"done"}},
+		{Task_Name: "Low", Description: "d", Category: "c", Priority: "LOW", Status: []string{"in progress"}},
+	}
+	for _, note := range notes {
+		note.CreatedAt = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		note.Version = 1
+		var buf bytes.Buffer
+		cw := ical.NewWriter(&buf)
+		writeVTODO(cw, note, "20240102T030405Z")
+		if err := cw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		components, err := ical.Parse(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := noteFromVTODO(components[0])
+		want := *note
+		want.Priority = strings.ToLower(note.Priority)
+		want.CreatedAt, want.Version = time.Time{}, 0
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("got %+v, want %+v", *got, want)
+		}
+	}
+}
+
+// To-dos from other calendar apps have no X-NOTES-STATUS, and their
+// priorities are numbers
+func TestNoteFromVTODO(t *testing.T) {
+	tests := []struct {
+		props    string
+		priority string
+		status   []string
+		category string
+	}{
+		{"", "medium", []string{"todo"}, ""},
+		{"PRIORITY:1\r\nSTATUS:COMPLETED\r\n", "high", []string{"done"}, ""},
+		{"PRIORITY:5\r\nSTATUS:in-process\r\n", "medium", []string{"in progress"}, ""},
+		{"PRIORITY:9\r\nSTATUS:CANCELLED\r\n", "low", []string{"cancelled"}, ""},
+		{"PRIORITY:0\r\nSTATUS:UNKNOWN\r\n", "medium", nil, ""},
+		{"PRIORITY:high\r\n", "medium", []string{"todo"}, ""},
+		{"CATEGORIES:work,home\r\nCATEGORIES:a\\,b\r\n", "medium", []string{"todo"}, "work, home, a,b"},
+	}
+	for _, tt := range tests {
+		components, err := ical.Parse(strings.NewReader("BEGIN:VTODO\r\n" + tt.props + "END:VTODO\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		note := noteFromVTODO(components[0])
+		if note.Priority != tt.priority || !reflect.DeepEqual(note.Status, tt.status) || note.Category != tt.category {
+			t.Errorf("%q: got %q %q %q, want %q %q %q", tt.props, note.Priority, note.Status, note.Category, tt.priority, tt.status, tt.category)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Filename: cmd/api/checklist.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// createChecklistItemHandler for the "POST /v1/Notes/:id/checklist"
+// endpoint. The item is added to the end of the checklist.
+func (app *application) createChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.noteNotFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Text string `json:"text"`
+		Done bool   `json:"done"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	item := &data.ChecklistItem{
+		NoteID: id,
+		Text:   input.Text,
+		Done:   input.Done,
+	}
+	v := validator.New()
+	if data.ValidateChecklistItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Checklists.Insert(app.contextGetTenant(r), item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.noteNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateChecklistItemHandler for the "PATCH /v1/Notes/:id/checklist/:item"
+// endpoint. It changes the text of an item or ticks it off.
+func (app *application) updateChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	id, err := app.readItemIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	tenant := app.contextGetTenant(r)
+	item, err := app.models.Checklists.Get(tenant, noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Text *string `json:"text"`
+		Done *bool   `json:"done"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Text != nil {
+		item.Text = *input.Text
+	}
+	if input.Done != nil {
+		item.Done = *input.Done
+	}
+	v := validator.New()
+	if data.ValidateChecklistItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Checklists.Update(tenant, item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
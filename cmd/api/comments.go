@@ -0,0 +1,100 @@
+// Filename: cmd/api/comments.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// createCommentHandler for the "POST /v1/Notes/:id/comments" endpoint
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.noteNotFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Body string `json:"body"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	comment := &data.Comment{
+		NoteID: id,
+		Body:   input.Body,
+	}
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Comments.Insert(app.contextGetTenant(r), comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.noteNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The related resources that can be embedded in Notes with ?include=
+var noteIncludeList = []string{"comments", "checklist"}
+
+// loadNoteIncludes() fetches the related resources of a page of Notes,
+// keyed by include name and then by Note ID. Notes without any get an empty
+// list rather than null.
+func (app *application) loadNoteIncludes(t data.Tenant, notes []*data.Note, includes []string) (map[string]map[int64]interface{}, error) {
+	ids := make([]int64, len(notes))
+	for i, note := range notes {
+		ids[i] = note.ID
+	}
+	related := make(map[string]map[int64]interface{}, len(includes))
+	for _, include := range includes {
+		if _, ok := related[include]; ok {
+			continue
+		}
+		byNote := make(map[int64]interface{}, len(notes))
+		switch include {
+		case "comments":
+			comments, err := app.models.Comments.GetForNotes(t, ids)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if comments[id] == nil {
+					comments[id] = []*data.Comment{}
+				}
+				byNote[id] = comments[id]
+			}
+		case "checklist":
+			items, err := app.models.Checklists.GetForNotes(t, ids)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if items[id] == nil {
+					items[id] = []*data.ChecklistItem{}
+				}
+				byNote[id] = items[id]
+			}
+		default:
+			return nil, fmt.Errorf("unknown include %q", include)
+		}
+		related[include] = byNote
+	}
+	return related, nil
+}
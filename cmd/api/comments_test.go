@@ -0,0 +1,85 @@
+// Filename: cmd/api/comments_test.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// The bulk and import routes share the ":id" route of POST with the
+// comments and checklists, and other ids are still not allowed
+func TestPostNoteSegments(t *testing.T) {
+	app := newTestApplication(t)
+	for _, target := range []string{"/v1/Notes/42", "/v1/workspaces/1/Notes/42"} {
+		w := app.do(t, http.MethodPost, target, "", `{}`)
+		wantStatus(t, w, http.StatusMethodNotAllowed)
+		if allow := w.Header().Get("Allow"); allow != "GET, PATCH, DELETE" {
+			t.Errorf("POST %s: got Allow %q, want %q", target, allow, "GET, PATCH, DELETE")
+		}
+	}
+	w := app.do(t, http.MethodPost, "/v1/Notes/bulk", "", `{}`)
+	wantStatus(t, w, http.StatusUnauthorized)
+}
+
+func TestNoteIncludes(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	bob := app.newTestUser(t, "Bob")
+	note := app.newTestNote(t, alice, alice.workspace.ID, "includes")
+	other := app.newTestNote(t, alice, alice.workspace.ID, "no includes")
+
+	w := app.do(t, http.MethodPost, fmt.Sprintf("/v1/Notes/%d/comments", note.ID), alice.token, `{"body":"looks good"}`)
+	wantStatus(t, w, http.StatusCreated)
+	w = app.do(t, http.MethodPost, fmt.Sprintf("/v1/Notes/%d/checklist", note.ID), alice.token, `{"text":"first"}`)
+	wantStatus(t, w, http.StatusCreated)
+	w = app.do(t, http.MethodPost, fmt.Sprintf("/v1/Notes/%d/checklist", note.ID), alice.token, `{"text":"second"}`)
+	wantStatus(t, w, http.StatusCreated)
+	item := decodeBody(t, w)["item"].(map[string]interface{})
+	if item["position"] != float64(2) {
+		t.Errorf("got position %v, want 2", item["position"])
+	}
+
+	// Other users can't reach the Note
+	w = app.do(t, http.MethodPost, fmt.Sprintf("/v1/Notes/%d/comments", note.ID), bob.token, `{"body":"hi"}`)
+	wantStatus(t, w, http.StatusNotFound)
+	w = app.do(t, http.MethodPatch, fmt.Sprintf("/v1/Notes/%d/checklist/%v", note.ID, item["id"]), bob.token, `{"done":true}`)
+	wantStatus(t, w, http.StatusNotFound)
+
+	list := func() (string, []interface{}) {
+		w := app.do(t, http.MethodGet, "/v1/Notes?include=comments,checklist&fields=id,task_name", alice.token, "")
+		wantStatus(t, w, http.StatusOK)
+		return w.Header().Get("ETag"), decodeBody(t, w)["Notes"].([]interface{})
+	}
+	etag, notes := list()
+	if len(notes) != 2 {
+		t.Fatalf("got %d Notes, want 2", len(notes))
+	}
+	first := notes[0].(map[string]interface{})
+	if comments := first["comments"].([]interface{}); len(comments) != 1 || comments[0].(map[string]interface{})["body"] != "looks good" {
+		t.Errorf("got comments %v", first["comments"])
+	}
+	checklist := first["checklist"].([]interface{})
+	if len(checklist) != 2 || checklist[0].(map[string]interface{})["text"] != "first" {
+		t.Errorf("got checklist %v", first["checklist"])
+	}
+	if _, ok := first["category"]; ok {
+		t.Errorf("got category, which ?fields= left out")
+	}
+	second := notes[1].(map[string]interface{})
+	if second["id"] != float64(other.ID) || len(second["comments"].([]interface{})) != 0 {
+		t.Errorf("got %v, want %d with no comments", second, other.ID)
+	}
+
+	// Ticking an item off changes the listing, but not the version of the
+	// Note
+	w = app.do(t, http.MethodPatch, fmt.Sprintf("/v1/Notes/%d/checklist/%v", note.ID, item["id"]), alice.token, `{"done":true}`)
+	wantStatus(t, w, http.StatusOK)
+	if changed, _ := list(); changed == etag {
+		t.Errorf("the ETag %s didn't change with the checklist", etag)
+	}
+
+	w = app.do(t, http.MethodGet, "/v1/Notes?include=attachments", alice.token, "")
+	wantStatus(t, w, http.StatusUnprocessableEntity)
+}
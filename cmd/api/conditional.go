@@ -0,0 +1,101 @@
+// Filename: cmd/api/conditional.go
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"quiz3.desireamagwula.net/internal/data"
+)
+
+// representation() names the representation a request gets: the format it
+// negotiated and the API version, whose field names and dates differ. Strong
+// entity tags must differ between representations, because their bytes do.
+func (app *application) representation(r *http.Request) string {
+	return fmt.Sprintf("%s-v%d", app.contextGetEncoder(r).Name, app.contextGetVersion(r))
+}
+
+// noteETag() returns the strong entity tag of a representation of a Note.
+// The version changes on every update, so the ID, version and representation
+// together identify one response body.
+func noteETag(note *data.Note, representation string) string {
+	return fmt.Sprintf(`"%d-%d-%s"`, note.ID, note.Version, representation)
+}
+
+// listETag() returns the strong entity tag of a page of Notes. It covers the
+// ID and version of every Note, the pagination metadata, the embedded related
+// resources and the representation.
+func listETag(notes []*data.Note, metadata data.Metadata, representation string, related interface{}) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s;", representation)
+	for _, note := range notes {
+		fmt.Fprintf(h, "%d-%d,", note.ID, note.Version)
+	}
+	for _, value := range []interface{}{metadata, related} {
+		js, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		h.Write(js)
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16]), nil
+}
+
+// etagListContains() reports whether an If-Match or If-None-Match header
+// lists the entity tag. If-Match uses the strong comparison, under which weak
+// tags never match, and If-None-Match uses the weak comparison.
+func etagListContains(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified() answers a GET with 304 Not Modified if the client already
+// holds the representation. It reports whether a response was sent.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagListContains(header, etag, true) {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch() enforces the If-Match header of a request that changes a
+// Note. The tag must be that of the representation the request negotiates,
+// as sent with the response to a GET with the same Accept header and API
+// version. In strict mode the header is required. It sends the error response
+// itself and reports whether the request may go ahead.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, note *data.Note) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if app.config.preconditions.strict {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+	if !etagListContains(header, noteETag(note, app.representation(r)), false) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+// Filename: cmd/api/conditional_test.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestETagListContains(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{`"1-2-json-v1"`, false, true},
+		{`"1-1-json-v1", "1-2-json-v1"`, false, true},
+		{`*`, false, true},
+		{`W/"1-2-json-v1"`, true, true},
+		{`W/"1-2-json-v1"`, false, false},
+		{`"1-2-csv-v1"`, true, false},
+		{`"1-2-json-v2"`, true, false},
+		{`"1-2"`, true, false},
+	}
+	for _, tt := range tests {
+		if got := etagListContains(tt.header, `"1-2-json-v1"`, tt.weak); got != tt.want {
+			t.Errorf("etagListContains(%q, weak=%t) = %t, want %t", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+// Each format and API version has its own tag, so a cache can't answer a
+// request for one representation with 304 for another
+func TestETagPerRepresentation(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	note := app.newTestNote(t, alice, alice.workspace.ID, "etag")
+	get := func(path, accept string, headers ...string) *http.Response {
+		w := app.do(t, http.MethodGet, fmt.Sprintf(path, note.ID), alice.token, "", append([]string{"Accept", accept}, headers...)...)
+		return w.Result()
+	}
+
+	seen := map[string]string{}
+	for _, rep := range []struct{ path, accept string }{
+		{"/v1/Notes/%d", "application/json"},
+		{"/v1/Notes/%d", "text/csv"},
+		{"/v2/Notes/%d", "application/json"},
+	} {
+		res := get(rep.path, rep.accept)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: got status %d", rep.path, rep.accept, res.StatusCode)
+		}
+		etag := res.Header.Get("ETag")
+		if other, ok := seen[etag]; ok {
+			t.Errorf("%s %s has the same ETag %s as %s", rep.path, rep.accept, etag, other)
+		}
+		seen[etag] = rep.path + " " + rep.accept
+	}
+
+	jsonTag := get("/v1/Notes/%d", "application/json").Header.Get("ETag")
+	if res := get("/v1/Notes/%d", "application/json", "If-None-Match", jsonTag); res.StatusCode != http.StatusNotModified {
+		t.Errorf("same representation: got status %d, want 304", res.StatusCode)
+	}
+	if res := get("/v1/Notes/%d", "text/csv", "If-None-Match", jsonTag); res.StatusCode != http.StatusOK {
+		t.Errorf("other representation: got status %d, want 200", res.StatusCode)
+	}
+}
+
+// A delete with If-Match only goes ahead if the Note is still at the tagged
+// version, and bulk deletes with versions fail the items that changed
+func TestConditionalDelete(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	note := app.newTestNote(t, alice, alice.workspace.ID, "delete me")
+	path := fmt.Sprintf("/v1/Notes/%d", note.ID)
+	staleTag := app.do(t, http.MethodGet, path, alice.token, "").Header().Get("ETag")
+	w := app.do(t, http.MethodPatch, path, alice.token, `{"priority":"high"}`)
+	wantStatus(t, w, http.StatusOK)
+	freshTag := w.Header().Get("ETag")
+
+	wantStatus(t, app.do(t, http.MethodDelete, path, alice.token, "", "If-Match", staleTag), http.StatusPreconditionFailed)
+	wantStatus(t, app.do(t, http.MethodGet, path, alice.token, ""), http.StatusOK)
+	wantStatus(t, app.do(t, http.MethodDelete, path, alice.token, "", "If-Match", freshTag), http.StatusOK)
+	wantStatus(t, app.do(t, http.MethodDelete, path, alice.token, "", "If-Match", freshTag), http.StatusNotFound)
+
+	kept := app.newTestNote(t, alice, alice.workspace.ID, "kept")
+	gone := app.newTestNote(t, alice, alice.workspace.ID, "gone")
+	body := fmt.Sprintf(`{"ids":[%d,%d],"versions":[%d,%d]}`, kept.ID, gone.ID, kept.Version+1, gone.Version)
+	w = app.do(t, http.MethodDelete, "/v1/Notes/bulk?mode=partial", alice.token, body)
+	wantStatus(t, w, http.StatusMultiStatus)
+	results := decodeBody(t, w)["results"].([]interface{})
+	for i, want := range []float64{http.StatusConflict, http.StatusOK} {
+		if got := results[i].(map[string]interface{})["status"]; got != want {
+			t.Errorf("item %d: got status %v, want %v", i, got, want)
+		}
+	}
+	wantStatus(t, app.do(t, http.MethodGet, fmt.Sprintf("/v1/Notes/%d", kept.ID), alice.token, ""), http.StatusOK)
+
+	// Versions must line up with the ids
+	body = fmt.Sprintf(`{"ids":[%d],"versions":[1,2]}`, kept.ID)
+	wantStatus(t, app.do(t, http.MethodDelete, "/v1/Notes/bulk", alice.token, body), http.StatusUnprocessableEntity)
+}
@@ -0,0 +1,135 @@
+// Filename: cmd/api/context.go
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"quiz3.desireamagwula.net/internal/codec"
+	"quiz3.desireamagwula.net/internal/data"
+)
+
+// Define a custom type for our context keys
+type contextKey string
+
+const (
+	userContextKey       = contextKey("user")
+	workspaceContextKey  = contextKey("workspace")
+	apiKeyContextKey     = contextKey("apiKey")
+	scopeCheckContextKey = contextKey("scopeCheck")
+	encoderContextKey    = contextKey("encoder")
+	versionContextKey    = contextKey("version")
+	problemContextKey    = contextKey("problem")
+	graphqlContextKey    = contextKey("graphql")
+)
+
+// contextSetUser() adds the user to the request context
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser() retrieves the user from the request context
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// contextSetWorkspace() adds the workspace being accessed to the request context
+func (app *application) contextSetWorkspace(r *http.Request, workspace *data.Workspace) *http.Request {
+	ctx := context.WithValue(r.Context(), workspaceContextKey, workspace)
+	return r.WithContext(ctx)
+}
+
+// contextGetWorkspace() retrieves the workspace from the request context
+func (app *application) contextGetWorkspace(r *http.Request) *data.Workspace {
+	workspace, ok := r.Context().Value(workspaceContextKey).(*data.Workspace)
+	if !ok {
+		panic("missing workspace value in request context")
+	}
+	return workspace
+}
+
+// contextGetTenant() combines the user and workspace of the request into the
+// tenant that note queries are scoped to
+func (app *application) contextGetTenant(r *http.Request) data.Tenant {
+	return data.Tenant{
+		UserID:      app.contextGetUser(r).ID,
+		WorkspaceID: app.contextGetWorkspace(r).ID,
+	}
+}
+
+// contextSetAPIKey() records the API key a request authenticated with
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey() returns the API key of the request, or nil if the
+// request was not authenticated with one
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// contextSetScopeChecked() marks that the route checked the API key scopes
+func (app *application) contextSetScopeChecked(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), scopeCheckContextKey, true)
+	return r.WithContext(ctx)
+}
+
+// contextGetScopeChecked() reports whether the route checked the API key scopes
+func (app *application) contextGetScopeChecked(r *http.Request) bool {
+	checked, _ := r.Context().Value(scopeCheckContextKey).(bool)
+	return checked
+}
+
+// contextSetEncoder() records the response format chosen for the request
+func (app *application) contextSetEncoder(r *http.Request, encoder *codec.Encoder) *http.Request {
+	ctx := context.WithValue(r.Context(), encoderContextKey, encoder)
+	return r.WithContext(ctx)
+}
+
+// contextGetEncoder() returns the response format of the request, JSON if
+// none was chosen
+func (app *application) contextGetEncoder(r *http.Request) *codec.Encoder {
+	encoder, ok := r.Context().Value(encoderContextKey).(*codec.Encoder)
+	if !ok {
+		return codec.JSON
+	}
+	return encoder
+}
+
+// contextSetVersion() records the version of the API the request was made to
+func (app *application) contextSetVersion(r *http.Request, version int) *http.Request {
+	ctx := context.WithValue(r.Context(), versionContextKey, version)
+	return r.WithContext(ctx)
+}
+
+// contextGetVersion() returns the version of the API the request was made
+// to, version 1 if none was recorded
+func (app *application) contextGetVersion(r *http.Request) int {
+	version, ok := r.Context().Value(versionContextKey).(int)
+	if !ok {
+		return 1
+	}
+	return version
+}
+
+// contextSetProblemDetails() records that the client accepts errors as
+// problem details
+func (app *application) contextSetProblemDetails(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), problemContextKey, true)
+	return r.WithContext(ctx)
+}
+
+// contextGetProblemDetails() reports whether errors are written as problem
+// details
+func (app *application) contextGetProblemDetails(r *http.Request) bool {
+	problem, _ := r.Context().Value(problemContextKey).(bool)
+	return problem
+}
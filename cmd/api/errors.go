@@ -1,36 +1,139 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/codec"
 )
 
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.Println(err)
 }
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
+
+// errorResponse() writes an error. The code names the kind of error, and the
+// message is either a sentence or a map of problems keyed by field. Clients
+// that accept application/problem+json get RFC 9457 problem details, and
+// everyone else gets the message under an error key.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message interface{}) {
+	if app.contextGetProblemDetails(r) {
+		app.problemResponse(w, r, status, code, message)
+		return
+	}
 	// CReate a variable
 	env := envelope{"error": message}
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeJSON(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// The base of the URIs that identify each kind of problem
+const problemTypeBase = "https://quiz3.desireamagwula.net/problems/"
+
+// A problem is an error as RFC 9457 problem details, with the code of the
+// error and any problems with individual fields as extension members
+type problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail"`
+	Instance string      `json:"instance"`
+	Code     string      `json:"code"`
+	Errors   interface{} `json:"errors,omitempty"`
+}
+
+// problemTitles gives the short summary of each kind of problem
+var problemTitles = map[string]string{
+	"server_error":                 "Internal server error",
+	"not_found":                    "Resource not found",
+	"note_not_found":               "Note not found",
+	"method_not_allowed":           "Method not allowed",
+	"bad_request":                  "Malformed request",
+	"validation_failed":            "Validation failed",
+	"edit_conflict":                "Edit conflict",
+	"invalid_credentials":          "Invalid credentials",
+	"invalid_authentication_token": "Invalid authentication token",
+	"authentication_required":      "Authentication required",
+	"not_permitted":                "Not permitted",
+	"api_key_not_permitted":        "API key not permitted",
+	"two_factor_locked":            "Too many two-factor attempts",
+	"login_locked":                 "Too many login attempts",
+	"admin_required":               "Administrator required",
+	"invalid_csrf_token":           "Invalid CSRF token",
+	"invalid_feed_token":           "Invalid calendar feed token",
+	"patch_test_failed":            "Patch test failed",
+	"precondition_failed":          "Precondition failed",
+	"precondition_required":        "Precondition required",
+	"idempotency_key_reused":       "Idempotency key reused",
+	"idempotency_key_in_flight":    "Idempotency key in use",
+	"not_acceptable":               "Format not acceptable",
+	"bulk_failed":                  "Bulk request failed",
+	"import_failed":                "Import failed",
+}
+
+// problemResponse() writes an error as problem details. A message that
+// isn't a sentence is listed under errors.
+func (app *application) problemResponse(w http.ResponseWriter, r *http.Request, status int, code string, message interface{}) {
+	p := problem{
+		Type:     problemTypeBase + code,
+		Title:    problemTitles[code],
+		Status:   status,
+		Instance: app.versionedPath(r, r.URL.Path),
+		Code:     code,
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(status)
+	}
+	if detail, ok := message.(string); ok {
+		p.Detail = detail
+	} else {
+		p.Detail = "the problems are listed under errors"
+		p.Errors = message
+	}
+	value, err := app.versionedValue(r, p)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var body bytes.Buffer
+	err = codec.JSON.Encode(&body, value)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ProblemJSON)
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
+
 // Server error response
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 	// Prepare a message with the
 	message := "the server encountered a problem and could not proceed"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, "server_error", message)
+}
+
+// Note not found error
+func (app *application) noteNotFoundResponse(w http.ResponseWriter, r *http.Request) {
+	message := "The requested resource could not be found"
+	app.errorResponse(w, r, http.StatusNotFound, "note_not_found", message)
 }
 
 // The not found response
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	//Create a message 
 	message := "The requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, "not_found", message)
 
 }
 
@@ -38,22 +141,124 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	//Create a message 
 	message := fmt.Sprintf("The %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed", message)
 
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, "bad_request", err.Error())
 
 }
 
 // Validation error 
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", errors)
 }
 
 // Edit Conflict error
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
-}
\ No newline at end of file
+	app.errorResponse(w, r, http.StatusConflict, "edit_conflict", message)
+}
+
+// Invalid credentials error
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_credentials", message)
+}
+
+// Invalid authentication token error
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_authentication_token", message)
+}
+
+// Authentication required error
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, "authentication_required", message)
+}
+
+// Not permitted error
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your role in this workspace does not permit this action"
+	app.errorResponse(w, r, http.StatusForbidden, "not_permitted", message)
+}
+
+// API key not permitted error
+func (app *application) apiKeyNotPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your API key does not permit access to this resource"
+	app.errorResponse(w, r, http.StatusForbidden, "api_key_not_permitted", message)
+}
+
+// Two-factor lockout error
+func (app *application) twoFactorLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many invalid codes, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, "two_factor_locked", message)
+}
+
+// Login lockout error
+func (app *application) loginLockedResponse(w http.ResponseWriter, r *http.Request, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, "login_locked", message)
+}
+
+// Admin required error
+func (app *application) adminRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be an administrator to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, "admin_required", message)
+}
+
+// Invalid CSRF token error
+func (app *application) invalidCSRFTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "missing or invalid CSRF token"
+	app.errorResponse(w, r, http.StatusForbidden, "invalid_csrf_token", message)
+}
+
+// Invalid calendar feed token error
+func (app *application) invalidFeedTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or missing calendar feed token"
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_feed_token", message)
+}
+
+// Failed patch test error
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, "patch_test_failed", err.Error())
+}
+
+// Precondition failed error
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has changed since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, "precondition_failed", message)
+}
+
+// Precondition required error
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must be made conditional with an If-Match header"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, "precondition_required", message)
+}
+
+// Idempotency key reused error
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this Idempotency-Key was already used with a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "idempotency_key_reused", message)
+}
+
+// Idempotency key in flight error
+func (app *application) idempotencyKeyInFlightResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this Idempotency-Key is still being processed, please try again"
+	app.errorResponse(w, r, http.StatusConflict, "idempotency_key_in_flight", message)
+}
+
+// Not acceptable error
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request, encoders []*codec.Encoder) {
+	formats := []string{}
+	for _, encoder := range encoders {
+		formats = append(formats, encoder.ContentType)
+	}
+	message := fmt.Sprintf("the requested format is not supported, use one of: %s", strings.Join(formats, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, "not_acceptable", message)
+}
@@ -0,0 +1,168 @@
+// Filename: cmd/api/errors_test.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// wantProblem() fails the test unless the response is problem details with
+// the status and code, and returns the body
+func wantProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code, instance string) map[string]interface{} {
+	t.Helper()
+	wantStatus(t, w, status)
+	if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("got Content-Type %q, want application/problem+json", got)
+	}
+	body := decodeBody(t, w)
+	want := map[string]interface{}{
+		"type":     problemTypeBase + code,
+		"title":    problemTitles[code],
+		"status":   float64(status),
+		"instance": instance,
+		"code":     code,
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("got %s %v, want %v", key, body[key], value)
+		}
+	}
+	if detail, _ := body["detail"].(string); detail == "" {
+		t.Errorf("got no detail in %v", body)
+	}
+	return body
+}
+
+func TestProblemDetails(t *testing.T) {
+	app := newTestApplication(t)
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		token    string
+		status   int
+		code     string
+		instance string
+	}{
+		{"unknown path", http.MethodGet, "/v1/nothing", "", "", http.StatusNotFound, "not_found", "/v1/nothing"},
+		{"wrong method", http.MethodPut, "/v1/healthcheck", "", "", http.StatusMethodNotAllowed, "method_not_allowed", "/v1/healthcheck"},
+		{"unknown format", http.MethodGet, "/v1/healthcheck?format=xml", "", "", http.StatusNotAcceptable, "not_acceptable", "/v1/healthcheck"},
+		{"malformed body", http.MethodPost, "/v1/users", `{"name":`, "", http.StatusBadRequest, "bad_request", "/v1/users"},
+		{"no token", http.MethodGet, "/v1/Notes", "", "", http.StatusUnauthorized, "authentication_required", "/v1/Notes"},
+		{"malformed token", http.MethodGet, "/v1/Notes", "", "not a token", http.StatusUnauthorized, "invalid_authentication_token", "/v1/Notes"},
+		// The instance is in the version of the request
+		{"version 2", http.MethodGet, "/v2/nothing", "", "", http.StatusNotFound, "not_found", "/v2/nothing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := app.do(t, tt.method, tt.target, tt.token, tt.body, "Accept", "application/problem+json")
+			body := wantProblem(t, w, tt.status, tt.code, tt.instance)
+			if _, ok := body["errors"]; ok {
+				t.Errorf("got errors in %v", body)
+			}
+		})
+	}
+}
+
+// Validation failures are listed by field under errors
+func TestProblemDetailsValidation(t *testing.T) {
+	app := newTestApplication(t)
+	w := app.do(t, http.MethodPost, "/v1/users", "", `{"name":"","email":"not an email","password":"pa55word1234"}`, "Accept", "application/problem+json")
+	body := wantProblem(t, w, http.StatusUnprocessableEntity, "validation_failed", "/v1/users")
+	errs, ok := body["errors"].(map[string]interface{})
+	if !ok || errs["name"] == nil || errs["email"] == nil || errs["password"] != nil {
+		t.Errorf("got errors %v, want ones for name and email", body["errors"])
+	}
+}
+
+// Only clients that accept problem details by name get them. Everyone else
+// gets the message under an error key, as before.
+func TestErrorFormatNegotiation(t *testing.T) {
+	app := newTestApplication(t)
+	tests := []struct {
+		accept  string
+		problem bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/*", false},
+		{"application/json", false},
+		{"application/problem+json", true},
+		{"application/json, application/problem+json;q=0.5", true},
+		{"application/json, application/problem+json;q=0", false},
+		{"text/csv, application/problem+json", true},
+	}
+	for _, tt := range tests {
+		w := app.do(t, http.MethodGet, "/v1/nothing", "", "", "Accept", tt.accept)
+		wantStatus(t, w, http.StatusNotFound)
+		body := decodeBody(t, w)
+		contentType := w.Header().Get("Content-Type")
+		if tt.problem {
+			if contentType != "application/problem+json" || body["code"] != "not_found" {
+				t.Errorf("%q: got %s %v, want problem details", tt.accept, contentType, body)
+			}
+			continue
+		}
+		if _, ok := body["error"].(string); !ok || body["code"] != nil {
+			t.Errorf("%q: got %s %v, want an error message", tt.accept, contentType, body)
+		}
+	}
+}
+
+// Every code errorResponse() is called with has a title, so that codes
+// can't be added without one
+func TestProblemTitles(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	callRX := regexp.MustCompile(`errorResponse\(w, r, [^,]+, "([a-z_]+)"`)
+	codes := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range callRX.FindAllStringSubmatch(string(src), -1) {
+			codes++
+			if problemTitles[match[1]] == "" {
+				t.Errorf("%s: code %s has no title", file, match[1])
+			}
+		}
+	}
+	if codes == 0 {
+		t.Fatal("found no calls of errorResponse()")
+	}
+}
+
+// Errors about Notes carry codes of their own
+func TestProblemDetailsNotes(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	note := app.newTestNote(t, alice, alice.workspace.ID, "first")
+	path := fmt.Sprintf("/v1/Notes/%d", note.ID)
+
+	w := app.do(t, http.MethodGet, "/v1/Notes/999999999", alice.token, "", "Accept", "application/problem+json")
+	wantProblem(t, w, http.StatusNotFound, "note_not_found", "/v1/Notes/999999999")
+
+	w = app.do(t, http.MethodPatch, path, alice.token, `{"priority":"high"}`, "Accept", "application/problem+json", "If-Match", `"stale"`)
+	wantProblem(t, w, http.StatusPreconditionFailed, "precondition_failed", path)
+
+	w = app.do(t, http.MethodPatch, path, alice.token, `{"priority":""}`, "Accept", "application/problem+json")
+	body := wantProblem(t, w, http.StatusUnprocessableEntity, "validation_failed", path)
+	// Version 1 reports the priority under its old key
+	if errs, _ := body["errors"].(map[string]interface{}); errs["address"] == nil {
+		t.Errorf("got errors %v, want one for the priority", body["errors"])
+	}
+}
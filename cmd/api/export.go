@@ -0,0 +1,159 @@
+// Filename: cmd/api/export.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/codec"
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+const (
+	// How often an export flushes what it has written to the client
+	exportFlushEvery = 100
+	// The longest an export may run. It is longer than the WriteTimeout of
+	// the server, so exports move their write deadline.
+	exportTimeout = 10 * time.Minute
+)
+
+// streamFor() lets a streamed response be written for the given time rather
+// than the WriteTimeout of the server, which is meant for ordinary responses
+// and would cut it short. The returned controller flushes the response.
+func (app *application) streamFor(w http.ResponseWriter, r *http.Request, d time.Duration) *http.ResponseController {
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Now().Add(d))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.logError(r, err)
+	}
+	return rc
+}
+
+// The formats Notes can be exported in, NDJSON unless the client asks for CSV
+// or todo.txt
+var exportEncoders = []*codec.Encoder{mustEncoder("ndjson"), mustEncoder("csv"), todoTxtEncoder}
+
+func mustEncoder(name string) *codec.Encoder {
+	encoder, err := codec.ByName(name, codec.Encoders)
+	if err != nil {
+		panic("unknown encoder: " + name)
+	}
+	return encoder
+}
+
+// exportNotesHandler for the "GET /v1/Notes/export" endpoint. Every Note
+// matching the list filters is streamed as it is read from the database,
+// without pagination. The handler negotiates the format itself.
+func (app *application) exportNotesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	qs := r.URL.Query()
+	err := app.checkQueryParams(qs, append([]string{"sort", "fields", "format"}, noteFilterParams...)...)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Only the formats with a row per Note can be streamed
+	var encoder *codec.Encoder
+	if format := qs.Get("format"); format != "" {
+		encoder, err = codec.ByName(format, exportEncoders)
+	} else {
+		encoder, err = codec.Negotiate(r.Header.Get("Accept"), exportEncoders)
+	}
+	if err != nil {
+		app.notAcceptableResponse(w, r, exportEncoders)
+		return
+	}
+	v := validator.New()
+	filter := app.readNoteFilter(qs, v)
+	filters := data.Filters{
+		Sort:      app.readString(qs, "sort", "id"),
+		SortList:  noteSortList,
+		Fields:    app.readCSV(qs, "fields", []string{}),
+		FieldList: noteFieldList,
+	}
+	data.ValidateSortAndFields(v, filters)
+	// A todo.txt line needs the whole Note
+	v.Check(encoder != todoTxtEncoder || len(filters.Fields) == 0, "fields", "can't be used with the todotxt format")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rw, err := encoder.NewRecordWriter(w)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	rc := app.streamFor(w, r, exportTimeout)
+	// The headers are only sent with the first Note, so that an error before
+	// then can still be reported properly
+	started := false
+	filename := "notes." + encoder.Name
+	if encoder == todoTxtEncoder {
+		filename = "todo.txt"
+	}
+	start := func() {
+		w.Header().Set("Content-Type", encoder.ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.WriteHeader(http.StatusOK)
+		started = true
+	}
+	count := 0
+	// The export stops if the client goes away
+	ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+	defer cancel()
+	tenant := app.contextGetTenant(r)
+	err = app.models.Notes.Export(ctx, tenant, filter, filters, func(Note *data.Note) error {
+		if !started {
+			start()
+		}
+		var record interface{} = Note
+		if len(filters.Fields) > 0 {
+			record = sparseNote(Note, filters.Fields)
+		}
+		// todo.txt lines are written from the Note itself
+		if encoder != todoTxtEncoder {
+			var err error
+			record, err = app.versionedValue(r, record)
+			if err != nil {
+				return err
+			}
+		}
+		err := rw.Write(record)
+		if err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			err = rw.Flush()
+			if err != nil {
+				return err
+			}
+			err = rc.Flush()
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// Too late to change the status, so cut the response short
+		app.logError(r, err)
+		return
+	}
+	if !started {
+		start()
+	}
+	err = rw.Flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,41 @@
+// Filename: cmd/api/export_test.go
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A streamed response outlives the WriteTimeout of the server, which would
+// otherwise close the connection in the middle of it
+func TestStreamForOutlivesWriteTimeout(t *testing.T) {
+	app := newTestApplication(t)
+	for _, stream := range []bool{false, true} {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if stream {
+				app.streamFor(w, r, time.Second)
+			}
+			w.Write([]byte("first\n"))
+			http.NewResponseController(w).Flush()
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("second\n"))
+		}))
+		srv.Config.WriteTimeout = 50 * time.Millisecond
+		srv.Start()
+		res, err := srv.Client().Get(srv.URL)
+		var body []byte
+		if err == nil {
+			body, err = io.ReadAll(res.Body)
+			res.Body.Close()
+		}
+		srv.Close()
+		complete := err == nil && string(body) == "first\nsecond\n"
+		if complete != stream {
+			t.Errorf("stream=%t: got body %q, error %v", stream, body, err)
+		}
+	}
+}
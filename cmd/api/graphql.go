@@ -0,0 +1,864 @@
+// Filename: cmd/api/graphql.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/codec"
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/graphql"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// graphqlNoteKeys are the keys Note validation errors are reported under in
+// GraphQL, which are the fields of the input objects
+var graphqlNoteKeys = data.NoteKeys{
+	TaskName:    "taskName",
+	Description: "description",
+	Category:    "category",
+	Priority:    "priority",
+	Status:      "status",
+}
+
+// graphqlFilterKeys renames the keys of pagination errors to the arguments
+// of the connection fields
+var graphqlFilterKeys = map[string]string{
+	"page_size": "first",
+	"cursor":    "after",
+	"sort":      "sort",
+}
+
+// A gqlNote is a Note with the workspace it belongs to
+type gqlNote struct {
+	*data.Note
+	workspaceID int64
+}
+
+// A gqlConnection is a page of the Notes in a workspace
+type gqlConnection struct {
+	notes    []*data.Note
+	metadata data.Metadata
+	filters  data.Filters
+	// The workspace the Notes belong to
+	workspaceID int64
+}
+
+// A gqlEdge is a Note in a connection with the cursor that follows it
+type gqlEdge struct {
+	node   gqlNote
+	cursor string
+}
+
+// noteRef identifies a Note for the Note loader
+type noteRef struct {
+	workspaceID int64
+	id          int64
+}
+
+// connectionArgs are the arguments of a connection field. The connections
+// asked for with the same arguments are loaded together.
+type connectionArgs struct {
+	first       int
+	after       string
+	sort        string
+	taskName    string
+	description string
+	category    string
+	priority    string
+	// The statuses joined by newlines, so that the struct is comparable
+	status string
+}
+
+// graphqlRequest holds what the resolvers of one request share: who is asking
+// and the loaders that batch their reads
+type graphqlRequest struct {
+	app  *application
+	r    *http.Request
+	user *data.User
+	key  *data.APIKey
+	// The workspaces the user belongs to, read once per request
+	workspaces    map[int64]*data.Workspace
+	workspaceList []*data.Workspace
+	personal      *data.Workspace
+	// The Notes, comments and checklists by noteRef and the summaries by
+	// workspace id
+	notes      *graphql.Loader
+	comments   *graphql.Loader
+	checklists *graphql.Loader
+	summaries  *graphql.Loader
+	// The connections by workspace id, one loader for each set of arguments
+	connections map[connectionArgs]*graphql.Loader
+}
+
+func (app *application) newGraphQLRequest(r *http.Request) *graphqlRequest {
+	g := &graphqlRequest{
+		app:         app,
+		r:           r,
+		user:        app.contextGetUser(r),
+		key:         app.contextGetAPIKey(r),
+		connections: map[connectionArgs]*graphql.Loader{},
+	}
+	g.notes = graphql.NewLoader(g.loadNotes)
+	g.comments = graphql.NewLoader(g.loadComments)
+	g.checklists = graphql.NewLoader(g.loadChecklists)
+	g.summaries = graphql.NewLoader(g.loadSummaries)
+	return g
+}
+
+// graphqlRequestFrom() returns the request a resolver is running for
+func graphqlRequestFrom(ctx context.Context) *graphqlRequest {
+	g, ok := ctx.Value(graphqlContextKey).(*graphqlRequest)
+	if !ok {
+		panic("missing graphql request in context")
+	}
+	return g
+}
+
+// fail() turns an error from the models into a GraphQL error. Unexpected
+// errors are logged, and reported without their details.
+func (g *graphqlRequest) fail(err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return graphql.NewError("note_not_found", "The requested resource could not be found")
+	case errors.Is(err, data.ErrEditConflict):
+		return graphql.NewError("edit_conflict", "unable to update the record due to an edit conflict, please try again")
+	}
+	g.app.logError(g.r, err)
+	return graphql.NewError("server_error", "the server encountered a problem and could not proceed")
+}
+
+// failedValidation() reports validation errors, keyed by field, in the
+// extensions of the error
+func failedValidation(errs map[string]string) error {
+	e := graphql.NewError("validation_failed", "the problems are listed under errors")
+	e.Extensions["errors"] = errs
+	return e
+}
+
+// loadWorkspaces() reads the workspaces of the user the first time one is
+// needed
+func (g *graphqlRequest) loadWorkspaces() error {
+	if g.workspaces != nil {
+		return nil
+	}
+	workspaces, err := g.app.models.Workspaces.GetAllForUser(g.user.ID)
+	if err != nil {
+		return g.fail(err)
+	}
+	g.workspaces = map[int64]*data.Workspace{}
+	g.workspaceList = workspaces
+	for _, workspace := range workspaces {
+		g.workspaces[workspace.ID] = workspace
+		if workspace.Personal && workspace.Role == data.RoleOwner && g.personal == nil {
+			g.personal = workspace
+		}
+	}
+	return nil
+}
+
+// workspace() returns the workspace named by an ID argument, or the personal
+// workspace if the argument wasn't given. Workspaces the user doesn't
+// belong to are reported as not found so their existence is not leaked.
+func (g *graphqlRequest) workspace(arg interface{}) (*data.Workspace, error) {
+	if err := g.loadWorkspaces(); err != nil {
+		return nil, err
+	}
+	notFound := graphql.NewError("not_found", "The requested resource could not be found")
+	if arg == nil {
+		if g.personal == nil {
+			return nil, notFound
+		}
+		return g.personal, nil
+	}
+	id, err := strconv.ParseInt(arg.(string), 10, 64)
+	if err != nil {
+		return nil, notFound
+	}
+	workspace, ok := g.workspaces[id]
+	if !ok {
+		return nil, notFound
+	}
+	return workspace, nil
+}
+
+// writableWorkspace() returns the workspace named by an ID argument if the
+// user may change its Notes
+func (g *graphqlRequest) writableWorkspace(arg interface{}) (*data.Workspace, error) {
+	if g.key != nil && !g.key.HasScope(data.ScopeNotesWrite) {
+		return nil, graphql.NewError("api_key_not_permitted", "your API key does not permit access to this resource")
+	}
+	workspace, err := g.workspace(arg)
+	if err != nil {
+		return nil, err
+	}
+	if !data.RoleAtLeast(workspace.Role, data.RoleMember) {
+		return nil, graphql.NewError("not_permitted", "your role in this workspace does not permit this action")
+	}
+	return workspace, nil
+}
+
+// tenant() scopes Note queries to a workspace of the user
+func (g *graphqlRequest) tenant(workspaceID int64) data.Tenant {
+	return data.Tenant{UserID: g.user.ID, WorkspaceID: workspaceID}
+}
+
+// loadNotes() reads the Notes asked for, one query per workspace
+func (g *graphqlRequest) loadNotes(keys []interface{}) ([]interface{}, error) {
+	ids := map[int64][]int64{}
+	for _, key := range keys {
+		ref := key.(noteRef)
+		ids[ref.workspaceID] = append(ids[ref.workspaceID], ref.id)
+	}
+	found := map[int64]map[int64]*data.Note{}
+	for workspaceID, noteIDs := range ids {
+		notes, err := g.app.models.Notes.GetMany(g.tenant(workspaceID), noteIDs)
+		if err != nil {
+			return nil, g.fail(err)
+		}
+		found[workspaceID] = notes
+	}
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		ref := key.(noteRef)
+		if note, ok := found[ref.workspaceID][ref.id]; ok {
+			values[i] = gqlNote{Note: note, workspaceID: ref.workspaceID}
+		}
+	}
+	return values, nil
+}
+
+// loadForNotes() reads what belongs to the Notes asked for, one query per
+// workspace. get() returns the values of each Note by its id.
+func (g *graphqlRequest) loadForNotes(keys []interface{}, get func(t data.Tenant, ids []int64) (map[int64][]interface{}, error)) ([]interface{}, error) {
+	ids := map[int64][]int64{}
+	for _, key := range keys {
+		ref := key.(noteRef)
+		ids[ref.workspaceID] = append(ids[ref.workspaceID], ref.id)
+	}
+	found := map[int64]map[int64][]interface{}{}
+	for workspaceID, noteIDs := range ids {
+		values, err := get(g.tenant(workspaceID), noteIDs)
+		if err != nil {
+			return nil, g.fail(err)
+		}
+		found[workspaceID] = values
+	}
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		ref := key.(noteRef)
+		list := found[ref.workspaceID][ref.id]
+		if list == nil {
+			list = []interface{}{}
+		}
+		values[i] = list
+	}
+	return values, nil
+}
+
+// loadComments() reads the comments of the Notes asked for
+func (g *graphqlRequest) loadComments(keys []interface{}) ([]interface{}, error) {
+	return g.loadForNotes(keys, func(t data.Tenant, ids []int64) (map[int64][]interface{}, error) {
+		comments, err := g.app.models.Comments.GetForNotes(t, ids)
+		if err != nil {
+			return nil, err
+		}
+		values := map[int64][]interface{}{}
+		for id, list := range comments {
+			for _, comment := range list {
+				values[id] = append(values[id], comment)
+			}
+		}
+		return values, nil
+	})
+}
+
+// loadChecklists() reads the checklists of the Notes asked for
+func (g *graphqlRequest) loadChecklists(keys []interface{}) ([]interface{}, error) {
+	return g.loadForNotes(keys, func(t data.Tenant, ids []int64) (map[int64][]interface{}, error) {
+		items, err := g.app.models.Checklists.GetForNotes(t, ids)
+		if err != nil {
+			return nil, err
+		}
+		values := map[int64][]interface{}{}
+		for id, list := range items {
+			for _, item := range list {
+				values[id] = append(values[id], item)
+			}
+		}
+		return values, nil
+	})
+}
+
+// loadSummaries() counts the Notes of the workspaces asked for
+func (g *graphqlRequest) loadSummaries(keys []interface{}) ([]interface{}, error) {
+	ids := make([]int64, len(keys))
+	for i, key := range keys {
+		ids[i] = key.(int64)
+	}
+	summaries, err := g.app.models.Notes.Summaries(g.user.ID, ids)
+	if err != nil {
+		return nil, g.fail(err)
+	}
+	values := make([]interface{}, len(keys))
+	for i, id := range ids {
+		values[i] = summaries[id]
+	}
+	return values, nil
+}
+
+// connectionArgsFrom() reads the arguments of a connection field
+func connectionArgsFrom(args map[string]interface{}) connectionArgs {
+	c := connectionArgs{}
+	c.first, _ = args["first"].(int)
+	c.after, _ = args["after"].(string)
+	c.sort, _ = args["sort"].(string)
+	c.taskName, _ = args["taskName"].(string)
+	c.description, _ = args["description"].(string)
+	c.category, _ = args["category"].(string)
+	c.priority, _ = args["priority"].(string)
+	status := []string{}
+	list, _ := args["status"].([]interface{})
+	for _, s := range list {
+		status = append(status, s.(string))
+	}
+	c.status = strings.Join(status, "\n")
+	return c
+}
+
+func (c connectionArgs) filter() data.NoteFilter {
+	filter := data.NoteFilter{
+		Task_Name:   c.taskName,
+		Description: c.description,
+		Category:    c.category,
+		Priority:    c.priority,
+		Status:      []string{},
+	}
+	if c.status != "" {
+		filter.Status = strings.Split(c.status, "\n")
+	}
+	return filter
+}
+
+// filters() returns the page the arguments ask for. Connections always use
+// cursor pagination.
+func (c connectionArgs) filters() data.Filters {
+	return data.Filters{
+		Page:      1,
+		PageSize:  c.first,
+		Sort:      c.sort,
+		SortList:  noteSortList,
+		UseCursor: true,
+		Cursor:    c.after,
+	}
+}
+
+// connection() returns a thunk for a page of the Notes in a workspace. The
+// pages of every workspace asked for with the same arguments are read in
+// one query.
+func (g *graphqlRequest) connection(workspaceID int64, args map[string]interface{}) (interface{}, error) {
+	c := connectionArgsFrom(args)
+	v := validator.New()
+	data.ValidateFilters(v, c.filters())
+	if !v.Valid() {
+		errs := map[string]string{}
+		for key, message := range v.Errors {
+			if name, ok := graphqlFilterKeys[key]; ok {
+				key = name
+			}
+			errs[key] = message
+		}
+		return nil, failedValidation(errs)
+	}
+	loader, ok := g.connections[c]
+	if !ok {
+		loader = graphql.NewLoader(func(keys []interface{}) ([]interface{}, error) {
+			ids := make([]int64, len(keys))
+			for i, key := range keys {
+				ids[i] = key.(int64)
+			}
+			notes, metadata, err := g.app.models.Notes.GetAllForWorkspaces(g.user.ID, ids, c.filter(), c.filters())
+			if err != nil {
+				return nil, g.fail(err)
+			}
+			values := make([]interface{}, len(keys))
+			for i, id := range ids {
+				values[i] = &gqlConnection{notes: notes[id], metadata: metadata[id], filters: c.filters(), workspaceID: id}
+			}
+			return values, nil
+		})
+		g.connections[c] = loader
+	}
+	return loader.Load(workspaceID), nil
+}
+
+// connectionMultiplier() counts a connection for the size of its page
+func connectionMultiplier(args map[string]interface{}) int {
+	first, _ := args["first"].(int)
+	if first < 1 {
+		return 1
+	}
+	return first
+}
+
+// noteListMultiplier() counts the comments or checklist of a Note as a
+// handful, since the lists aren't paginated
+func noteListMultiplier(args map[string]interface{}) int {
+	return 10
+}
+
+// noteFromInput() reads the fields of a NoteInput or NotePatch into a Note.
+// Fields missing from a patch are left alone.
+func noteFromInput(note *data.Note, input map[string]interface{}) {
+	if v, ok := input["taskName"].(string); ok {
+		note.Task_Name = v
+	}
+	if v, ok := input["description"].(string); ok {
+		note.Description = v
+	}
+	if v, ok := input["category"].(string); ok {
+		note.Category = v
+	}
+	if v, ok := input["priority"].(string); ok {
+		note.Priority = v
+	}
+	if list, ok := input["status"].([]interface{}); ok {
+		note.Status = []string{}
+		for _, s := range list {
+			note.Status = append(note.Status, s.(string))
+		}
+	}
+}
+
+// noteField() returns a field of Note read from the source with fn
+func noteField(name string, t graphql.Type, fn func(note gqlNote) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Name: name,
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return fn(p.Source.(gqlNote)), nil
+		},
+	}
+}
+
+// graphqlSchema() builds the schema served at /v1/graphql. Notes and
+// workspaces refer to each other, so their fields are added once both exist.
+func (app *application) graphqlSchema() (*graphql.Schema, error) {
+	nonNull := func(t graphql.Type) graphql.Type { return &graphql.NonNull{Of: t} }
+	list := func(t graphql.Type) graphql.Type { return &graphql.List{Of: nonNull(t)} }
+
+	noteType := &graphql.Object{Name: "Note", Description: "A task in a workspace"}
+	workspaceType := &graphql.Object{Name: "Workspace", Description: "A workspace the user belongs to"}
+	// Notes have no tags of their own, so their statuses are what is counted
+	tagCountType := &graphql.Object{
+		Name:        "TagCount",
+		Description: "The number of Notes carrying a status. Notes have no separate tags, so tag is a status.",
+		Fields: []*graphql.Field{
+			{Name: "tag", Type: nonNull(graphql.String)},
+			{Name: "count", Type: nonNull(graphql.Int)},
+		},
+	}
+	commentType := &graphql.Object{
+		Name:        "Comment",
+		Description: "A remark a member of the workspace left on a Note",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: nonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.Comment).ID, nil
+			}},
+			{Name: "userId", Type: nonNull(graphql.ID), Description: "The user who left the comment", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.Comment).UserID, nil
+			}},
+			{Name: "body", Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.Comment).Body, nil
+			}},
+			{Name: "createdAt", Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.Comment).CreatedAt.UTC().Format(time.RFC3339), nil
+			}},
+		},
+	}
+	checklistItemType := &graphql.Object{
+		Name:        "ChecklistItem",
+		Description: "A step of a Note",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: nonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.ChecklistItem).ID, nil
+			}},
+			{Name: "text", Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.ChecklistItem).Text, nil
+			}},
+			{Name: "done", Type: nonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.ChecklistItem).Done, nil
+			}},
+			{Name: "position", Type: nonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.ChecklistItem).Position, nil
+			}},
+			{Name: "version", Type: nonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.ChecklistItem).Version, nil
+			}},
+		},
+	}
+	pageInfoType := &graphql.Object{
+		Name: "PageInfo",
+		Fields: []*graphql.Field{
+			{Name: "hasNextPage", Type: nonNull(graphql.Boolean)},
+			{Name: "endCursor", Type: graphql.String, Description: "Pass as after to get the next page"},
+		},
+	}
+	edgeType := &graphql.Object{
+		Name: "NoteEdge",
+		Fields: []*graphql.Field{
+			{Name: "cursor", Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(gqlEdge).cursor, nil
+			}},
+			{Name: "node", Type: nonNull(noteType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(gqlEdge).node, nil
+			}},
+		},
+	}
+	connectionType := &graphql.Object{
+		Name:        "NoteConnection",
+		Description: "A page of Notes, paginated with cursors",
+		Fields: []*graphql.Field{
+			{Name: "edges", Type: nonNull(list(edgeType)), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				c := p.Source.(*gqlConnection)
+				edges := make([]interface{}, len(c.notes))
+				for i, note := range c.notes {
+					edges[i] = gqlEdge{
+						node:   gqlNote{Note: note, workspaceID: c.workspaceID},
+						cursor: c.filters.CursorFor(note),
+					}
+				}
+				return edges, nil
+			}},
+			{Name: "pageInfo", Type: nonNull(pageInfoType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				c := p.Source.(*gqlConnection)
+				info := map[string]interface{}{"hasNextPage": c.metadata.NextCursor != "", "endCursor": nil}
+				if len(c.notes) > 0 {
+					info["endCursor"] = c.filters.CursorFor(c.notes[len(c.notes)-1])
+				}
+				return info, nil
+			}},
+		},
+	}
+	// The arguments of the connection fields
+	connectionArgs := []*graphql.Argument{
+		{Name: "first", Type: graphql.Int, Default: 20, Description: "The number of Notes in the page, at most 100"},
+		{Name: "after", Type: graphql.String, Description: "The endCursor of the previous page"},
+		{Name: "sort", Type: graphql.String, Default: "id", Description: "One of " + strings.Join(noteSortList, ", ")},
+		{Name: "taskName", Type: graphql.String, Description: "Search the task names"},
+		{Name: "description", Type: graphql.String, Description: "Search the descriptions"},
+		{Name: "category", Type: graphql.String},
+		{Name: "priority", Type: graphql.String},
+		{Name: "status", Type: list(graphql.String), Description: "Only Notes carrying every status"},
+	}
+	workspaceArg := &graphql.Argument{Name: "workspace", Type: graphql.ID, Description: "The personal workspace if not given"}
+
+	noteType.Fields = []*graphql.Field{
+		noteField("id", nonNull(graphql.ID), func(n gqlNote) interface{} { return n.ID }),
+		noteField("taskName", nonNull(graphql.String), func(n gqlNote) interface{} { return n.Task_Name }),
+		noteField("description", nonNull(graphql.String), func(n gqlNote) interface{} { return n.Description }),
+		noteField("category", nonNull(graphql.String), func(n gqlNote) interface{} { return n.Category }),
+		noteField("priority", nonNull(graphql.String), func(n gqlNote) interface{} { return n.Priority }),
+		noteField("status", nonNull(list(graphql.String)), func(n gqlNote) interface{} {
+			status := make([]interface{}, len(n.Status))
+			for i, s := range n.Status {
+				status[i] = s
+			}
+			return status
+		}),
+		noteField("version", nonNull(graphql.Int), func(n gqlNote) interface{} { return n.Version }),
+		noteField("createdAt", nonNull(graphql.String), func(n gqlNote) interface{} { return n.CreatedAt.UTC().Format(time.RFC3339) }),
+		{Name: "workspace", Type: nonNull(workspaceType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			g := graphqlRequestFrom(p.Context)
+			return g.workspace(strconv.FormatInt(p.Source.(gqlNote).workspaceID, 10))
+		}},
+		{Name: "comments", Type: nonNull(list(commentType)), Description: "Oldest first", Multiplier: noteListMultiplier, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			note := p.Source.(gqlNote)
+			return graphqlRequestFrom(p.Context).comments.Load(noteRef{workspaceID: note.workspaceID, id: note.ID}), nil
+		}},
+		{Name: "checklist", Type: nonNull(list(checklistItemType)), Description: "In the order the items were added", Multiplier: noteListMultiplier, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			note := p.Source.(gqlNote)
+			return graphqlRequestFrom(p.Context).checklists.Load(noteRef{workspaceID: note.workspaceID, id: note.ID}), nil
+		}},
+	}
+	workspaceType.Fields = []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*data.Workspace).ID, nil
+		}},
+		{Name: "name", Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*data.Workspace).Name, nil
+		}},
+		{Name: "personal", Type: nonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*data.Workspace).Personal, nil
+		}},
+		{Name: "role", Type: nonNull(graphql.String), Description: "The role of the user", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*data.Workspace).Role, nil
+		}},
+		{Name: "notes", Type: nonNull(connectionType), Args: connectionArgs, Multiplier: connectionMultiplier, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return graphqlRequestFrom(p.Context).connection(p.Source.(*data.Workspace).ID, p.Args)
+		}},
+		{Name: "noteCount", Type: nonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			thunk := graphqlRequestFrom(p.Context).summaries.Load(p.Source.(*data.Workspace).ID)
+			return graphql.Thunk(func() (interface{}, error) {
+				summary, err := thunk()
+				if err != nil {
+					return nil, err
+				}
+				return summary.(*data.NoteSummary).Count, nil
+			}), nil
+		}},
+		{Name: "tagCounts", Type: nonNull(list(tagCountType)), Description: "The number of Notes with each status, most used first. Statuses stand in for tags, which Notes don't have.", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			thunk := graphqlRequestFrom(p.Context).summaries.Load(p.Source.(*data.Workspace).ID)
+			return graphql.Thunk(func() (interface{}, error) {
+				summary, err := thunk()
+				if err != nil {
+					return nil, err
+				}
+				tags := make([]interface{}, len(summary.(*data.NoteSummary).Tags))
+				for i, tag := range summary.(*data.NoteSummary).Tags {
+					tags[i] = map[string]interface{}{"tag": tag.Tag, "count": tag.Count}
+				}
+				return tags, nil
+			}), nil
+		}},
+	}
+
+	noteInput := &graphql.InputObject{
+		Name: "NoteInput",
+		Fields: []*graphql.Argument{
+			{Name: "taskName", Type: nonNull(graphql.String)},
+			{Name: "description", Type: nonNull(graphql.String)},
+			{Name: "category", Type: nonNull(graphql.String)},
+			{Name: "priority", Type: nonNull(graphql.String)},
+			{Name: "status", Type: nonNull(list(graphql.String))},
+		},
+	}
+	notePatch := &graphql.InputObject{
+		Name:        "NotePatch",
+		Description: "The fields of a Note to change",
+		Fields: []*graphql.Argument{
+			{Name: "taskName", Type: graphql.String},
+			{Name: "description", Type: graphql.String},
+			{Name: "category", Type: graphql.String},
+			{Name: "priority", Type: graphql.String},
+			{Name: "status", Type: list(graphql.String)},
+		},
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: []*graphql.Field{
+			{Name: "note", Type: noteType, Args: []*graphql.Argument{{Name: "id", Type: nonNull(graphql.ID)}, workspaceArg}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				g := graphqlRequestFrom(p.Context)
+				workspace, err := g.workspace(p.Args["workspace"])
+				if err != nil {
+					return nil, err
+				}
+				id, err := strconv.ParseInt(p.Args["id"].(string), 10, 64)
+				if err != nil {
+					return nil, nil
+				}
+				return g.notes.Load(noteRef{workspaceID: workspace.ID, id: id}), nil
+			}},
+			{Name: "notes", Type: nonNull(connectionType), Args: append([]*graphql.Argument{workspaceArg}, connectionArgs...), Multiplier: connectionMultiplier, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				g := graphqlRequestFrom(p.Context)
+				workspace, err := g.workspace(p.Args["workspace"])
+				if err != nil {
+					return nil, err
+				}
+				return g.connection(workspace.ID, p.Args)
+			}},
+			{Name: "workspace", Type: workspaceType, Args: []*graphql.Argument{{Name: "id", Type: nonNull(graphql.ID)}}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				g := graphqlRequestFrom(p.Context)
+				workspace, err := g.workspace(p.Args["id"])
+				var gqlErr *graphql.Error
+				if errors.As(err, &gqlErr) && gqlErr.Extensions["code"] == "not_found" {
+					return nil, nil
+				}
+				return workspace, err
+			}},
+			{Name: "workspaces", Type: nonNull(list(workspaceType)), Multiplier: func(args map[string]interface{}) int { return 10 }, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				g := graphqlRequestFrom(p.Context)
+				if err := g.loadWorkspaces(); err != nil {
+					return nil, err
+				}
+				values := make([]interface{}, len(g.workspaceList))
+				for i, workspace := range g.workspaceList {
+					values[i] = workspace
+				}
+				return values, nil
+			}},
+		},
+	}
+
+	mutation := &graphql.Object{
+		Name: "Mutation",
+		Fields: []*graphql.Field{
+			{Name: "createNote", Type: nonNull(noteType), Args: []*graphql.Argument{workspaceArg, {Name: "input", Type: nonNull(noteInput)}}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				g := graphqlRequestFrom(p.Context)
+				workspace, err := g.writableWorkspace(p.Args["workspace"])
+				if err != nil {
+					return nil, err
+				}
+				note := &data.Note{}
+				noteFromInput(note, p.Args["input"].(map[string]interface{}))
+				v := validator.New()
+				if data.ValidateNoteKeys(v, note, graphqlNoteKeys); !v.Valid() {
+					return nil, failedValidation(v.Errors)
+				}
+				if err := g.app.models.Notes.Insert(g.tenant(workspace.ID), note); err != nil {
+					return nil, g.fail(err)
+				}
+				return gqlNote{Note: note, workspaceID: workspace.ID}, nil
+			}},
+			{Name: "updateNote", Type: nonNull(noteType), Args: []*graphql.Argument{
+				{Name: "id", Type: nonNull(graphql.ID)},
+				workspaceArg,
+				{Name: "input", Type: nonNull(notePatch)},
+				{Name: "version", Type: graphql.Int, Description: "Only update the Note if it is at this version"},
+			}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				g := graphqlRequestFrom(p.Context)
+				workspace, err := g.writableWorkspace(p.Args["workspace"])
+				if err != nil {
+					return nil, err
+				}
+				id, err := strconv.ParseInt(p.Args["id"].(string), 10, 64)
+				if err != nil {
+					return nil, g.fail(data.ErrRecordNotFound)
+				}
+				note, err := g.app.models.Notes.Get(g.tenant(workspace.ID), id)
+				if err != nil {
+					return nil, g.fail(err)
+				}
+				if version, ok := p.Args["version"].(int); ok && int32(version) != note.Version {
+					return nil, g.fail(data.ErrEditConflict)
+				}
+				noteFromInput(note, p.Args["input"].(map[string]interface{}))
+				v := validator.New()
+				if data.ValidateNoteKeys(v, note, graphqlNoteKeys); !v.Valid() {
+					return nil, failedValidation(v.Errors)
+				}
+				if err := g.app.models.Notes.Update(g.tenant(workspace.ID), note); err != nil {
+					return nil, g.fail(err)
+				}
+				return gqlNote{Note: note, workspaceID: workspace.ID}, nil
+			}},
+			{Name: "deleteNote", Type: nonNull(graphql.ID), Description: "Returns the id of the deleted Note", Args: []*graphql.Argument{
+				{Name: "id", Type: nonNull(graphql.ID)},
+				workspaceArg,
+				{Name: "version", Type: graphql.Int, Description: "Only delete the Note if it is at this version"},
+			}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				g := graphqlRequestFrom(p.Context)
+				workspace, err := g.writableWorkspace(p.Args["workspace"])
+				if err != nil {
+					return nil, err
+				}
+				id, err := strconv.ParseInt(p.Args["id"].(string), 10, 64)
+				if err != nil {
+					return nil, g.fail(data.ErrRecordNotFound)
+				}
+				var version int32
+				if v, ok := p.Args["version"].(int); ok {
+					version = int32(v)
+				}
+				if err := g.app.models.Notes.Delete(g.tenant(workspace.ID), id, version); err != nil {
+					return nil, g.fail(err)
+				}
+				return id, nil
+			}},
+		},
+	}
+	return graphql.NewSchema(query, mutation)
+}
+
+// graphqlParams are the query parameters of GET /v1/graphql
+var graphqlParams = []string{"query", "operationName", "variables"}
+
+// graphqlHandler() runs GraphQL requests. POST takes the request as a JSON
+// body, and GET takes it in the query string but can only run queries. A GET
+// without a query returns the schema.
+func (app *application) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		graphql.Request
+		// Clients may send extensions, which are not used
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	opts := graphql.Options{Limits: app.config.graphql.limits}
+	if r.Method == http.MethodGet {
+		qs := r.URL.Query()
+		err := app.checkQueryParams(qs, graphqlParams...)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if !qs.Has("query") {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(app.graphql.String()))
+			return
+		}
+		input.Query = qs.Get("query")
+		input.OperationName = qs.Get("operationName")
+		if variables := qs.Get("variables"); variables != "" {
+			dec := json.NewDecoder(strings.NewReader(variables))
+			dec.UseNumber()
+			if err := dec.Decode(&input.Variables); err != nil {
+				app.badRequestResponse(w, r, errors.New("variables must be a JSON object"))
+				return
+			}
+		}
+		opts.QueriesOnly = true
+	} else {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if len(input.Query) > graphql.MaxDocumentLength {
+		app.badRequestResponse(w, r, errors.New("the query is too long"))
+		return
+	}
+	ctx := context.WithValue(r.Context(), graphqlContextKey, app.newGraphQLRequest(r))
+	resp := app.graphql.Execute(ctx, input.Request, opts)
+	// Requests that never ran are the client's fault. Data is only sent for
+	// operations that ran, even if it is null.
+	status := http.StatusOK
+	env := envelope{}
+	switch {
+	case resp.Executed:
+		env["data"] = resp.Data
+	case opts.QueriesOnly && resp.Operation == "mutation":
+		w.Header().Set("Allow", http.MethodPost)
+		status = http.StatusMethodNotAllowed
+	default:
+		status = http.StatusBadRequest
+	}
+	if len(resp.Errors) > 0 {
+		env["errors"] = resp.Errors
+	}
+	err := app.writeGraphQL(w, status, env)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeGraphQL() writes a GraphQL response. Its keys come from the query, so
+// unlike writeJSON() they aren't renamed for version 2 of the API.
+func (app *application) writeGraphQL(w http.ResponseWriter, status int, env envelope) error {
+	var body bytes.Buffer
+	err := codec.JSON.Encode(&body, env)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", codec.JSON.ContentType)
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+	return nil
+}
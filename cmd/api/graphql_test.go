@@ -0,0 +1,38 @@
+// Filename: cmd/api/graphql_test.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGraphQLNoteComments(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	note := app.newTestNote(t, alice, alice.workspace.ID, "with comments")
+	app.newTestNote(t, alice, alice.workspace.ID, "without comments")
+	for _, body := range []string{"first", "second"} {
+		w := app.do(t, http.MethodPost, fmt.Sprintf("/v1/Notes/%d/comments", note.ID), alice.token, fmt.Sprintf(`{"body":%q}`, body))
+		wantStatus(t, w, http.StatusCreated)
+	}
+	w := app.do(t, http.MethodPost, fmt.Sprintf("/v1/Notes/%d/checklist", note.ID), alice.token, `{"text":"step"}`)
+	wantStatus(t, w, http.StatusCreated)
+
+	query := `{"query":"{ notes(sort: \"id\") { edges { node { taskName comments { body } checklist { text done position } } } } }"}`
+	w = app.do(t, http.MethodPost, "/v1/graphql", alice.token, query)
+	wantStatus(t, w, http.StatusOK)
+	want := `{"data":{"notes":{"edges":[` +
+		`{"node":{"taskName":"with comments","comments":[{"body":"first"},{"body":"second"}],"checklist":[{"text":"step","done":false,"position":1}]}},` +
+		`{"node":{"taskName":"without comments","comments":[],"checklist":[]}}]}}}`
+	var got bytes.Buffer
+	if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want {
+		t.Errorf("got %s, want %s", got.String(), want)
+	}
+}
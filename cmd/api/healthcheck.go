@@ -17,7 +17,7 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 
 	//Convert Map to a JSON object
 	// js, err := json.Marshal(data)
-	err := app.writeJSON(w, http.StatusOK, data, nil)
+	err := app.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
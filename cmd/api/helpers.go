@@ -2,14 +2,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"quiz3.desireamagwula.net/internal/validator"
@@ -29,24 +33,78 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 
 }
 
+// readWorkspaceIDParam() reads the :wid parameter of the workspace routes
+func (app *application) readWorkspaceIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("wid"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("Invalid workspace id parameter")
+	}
+
+	return id, nil
+}
+
+// readItemIDParam() reads the :item parameter of the checklist routes
+func (app *application) readItemIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("item"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("Invalid item id parameter")
+	}
+
+	return id, nil
+}
+
+// segmentOr() sends the requests of a ":id" route to another handler when the
+// id is the given word. httprouter doesn't allow a static segment next to a
+// parameter, so routes such as "/v1/Notes/bulk" can't be registered next to
+// "/v1/Notes/:id".
+func (app *application) segmentOr(segment string, static, param http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if httprouter.ParamsFromContext(r.Context()).ByName("id") == segment {
+			static(w, r)
+			return
+		}
+		param(w, r)
+	}
+}
+
+// clientIP() returns the address the request came from
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
 // Define a new type named envelope
 type envelope map[string]interface{}
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+// writeJSON() writes the response in the format negotiated for the request,
+// which is JSON unless the client asked for another
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	encoder := app.contextGetEncoder(r)
+	value, err := app.versionedValue(r, data)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	err = encoder.Encode(&body, value)
 	if err != nil {
 		return err
 	}
-	js = append(js, '\n')
 	// Add any of the headers
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
-	// Specify that we will serve our responses using JSON
-	w.Header().Set("Content-Type", "application/json")
+	// Specify the format we will serve our response in
+	w.Header().Set("Content-Type", encoder.ContentType)
 	w.WriteHeader(status)
-	//Write the byte slice containing the json response body
-	w.Write(js)
+	//Write the byte slice containing the response body
+	w.Write(body.Bytes())
 	return nil
 }
 
@@ -59,42 +117,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	err := dec.Decode(dst)
 	// Check for a bad request
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
-		//Switch to check for the errors
-		switch {
-		//Check for syntax Errors
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly formed JSON (at character %d)", syntaxError.Offset)
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly formed JSON")
-		// Check for wrong types passed by the client
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
-			//Empty body
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
-
-		// Check for Unmappable fields
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
-
-		// Too large
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("The body must not be larger than %d bytes", maxBytes)
-
-		// Pass non-nil pointer
-		case errors.As(err, &invalidUnmarshalError):
-			panic(err)
-		//default
-		default:
-			return err
-		}
+		return decodeError(err, maxBytes)
 	}
 	// Call decode again
 	err = dec.Decode(&struct{}{})
@@ -105,6 +128,47 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+// decodeError() explains why a JSON body couldn't be decoded, in words the
+// client can act on
+func decodeError(err error, maxBytes int) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	//Switch to check for the errors
+	switch {
+	//Check for syntax Errors
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("body contains badly formed JSON (at character %d)", syntaxError.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body contains badly formed JSON")
+	// Check for wrong types passed by the client
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		//Empty body
+	case errors.Is(err, io.EOF):
+		return errors.New("body must not be empty")
+
+	// Check for Unmappable fields
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
+		return fmt.Errorf("body contains unknown key %s", fieldName)
+
+	// Too large
+	case err.Error() == "http: request body too large":
+		return fmt.Errorf("The body must not be larger than %d bytes", maxBytes)
+
+	// Pass non-nil pointer
+	case errors.As(err, &invalidUnmarshalError):
+		panic(err)
+	//default
+	default:
+		return err
+	}
+}
+
 // The readString() method returns a string value from the query parameter
 // string or returns a default value if no matching key is found
 
@@ -150,3 +214,65 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 }
 
+
+// The readTime() method reads a time from the query string. Either an RFC
+// 3339 timestamp or a date is accepted, a date meaning midnight UTC. If the
+// value can't be parsed a validation error is added.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	value := qs.Get(key)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t
+		}
+	}
+	v.AddError(key, "must be an RFC 3339 timestamp or a date in the form YYYY-MM-DD")
+	return time.Time{}
+}
+
+// The checkQueryParams() method returns an error naming any query parameters
+// that are not in the allowed list
+func (app *application) checkQueryParams(qs url.Values, allowed ...string) error {
+	unknown := []string{}
+	for key := range qs {
+		if !validator.In(key, allowed...) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown query parameter(s) %s; valid parameters are %s", strings.Join(unknown, ", "), strings.Join(allowed, ", "))
+}
+
+// The readBool() method reads a boolean from the query string. If the value
+// can't be parsed a validation error is added.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+	return boolValue
+}
+
+// The background() method runs fn in its own goroutine, logging any panic
+// rather than letting it take down the server
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logError(nil, fmt.Errorf("%s", err))
+			}
+		}()
+		fn()
+	}()
+}
@@ -0,0 +1,132 @@
+// Filename: cmd/api/idempotency.go
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+const (
+	// How long a stored response is replayed for
+	idempotencyKeyTTL = 24 * time.Hour
+	// How long a retry waits for the first request with its key to finish
+	idempotencyWait = 10 * time.Second
+	// How long a request holds its key. A request that crashed without
+	// releasing the key stops blocking retries after this.
+	idempotencyLease = time.Minute
+)
+
+// responseRecorder passes a response through while keeping a copy of it.
+// Like net/http, it only takes the first status written into account.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent() makes a handler safe to retry. The response to the first
+// request with an Idempotency-Key header is stored and replayed for retries
+// with the same key and payload. Retries arriving while the first request is
+// still running wait for its response.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		v := validator.New()
+		if data.ValidateIdempotencyKey(v, key); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		// Read the body so it can be hashed, then hand it on to the handler
+		maxBytes := 1_048_576
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("The body must not be larger than %d bytes", maxBytes))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		user := app.contextGetUser(r)
+		hash := data.IdempotencyRequestHash(r.Method, app.versionedPath(r, r.URL.Path), body)
+		deadline := time.Now().Add(idempotencyWait)
+		for {
+			stored, err := app.models.Idempotency.Claim(user.ID, key, hash, idempotencyKeyTTL, idempotencyLease)
+			switch {
+			case err == nil && stored == nil:
+				app.serveIdempotent(w, r, next, user.ID, key)
+				return
+			case err == nil:
+				for name, values := range stored.Headers {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+				return
+			case errors.Is(err, data.ErrIdempotencyKeyReused):
+				app.idempotencyKeyReusedResponse(w, r)
+				return
+			case errors.Is(err, data.ErrIdempotencyKeyInFlight):
+				if time.Now().After(deadline) {
+					app.idempotencyKeyInFlightResponse(w, r)
+					return
+				}
+				time.Sleep(100 * time.Millisecond)
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+}
+
+// serveIdempotent() runs the handler for a claimed key and stores its
+// response. Server errors are not stored so that the request can be retried.
+func (app *application) serveIdempotent(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, userID int64, key string) {
+	rec := &responseRecorder{ResponseWriter: w}
+	defer func() {
+		if rec.status == 0 || rec.status >= 500 {
+			err := app.models.Idempotency.Release(userID, key)
+			if err != nil {
+				app.logError(r, err)
+			}
+			return
+		}
+		err := app.models.Idempotency.Complete(userID, key, &data.StoredResponse{
+			Status:  rec.status,
+			Headers: w.Header().Clone(),
+			Body:    rec.body.Bytes(),
+		})
+		if err != nil {
+			app.logError(r, err)
+		}
+	}()
+	next.ServeHTTP(rec, r)
+}
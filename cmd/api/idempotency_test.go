@@ -0,0 +1,59 @@
+// Filename: cmd/api/idempotency_test.go
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A handler that writes a second status keeps the first, and so does the
+// copy that would be stored
+func TestResponseRecorderKeepsFirstStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: w}
+	rec.WriteHeader(http.StatusInternalServerError)
+	rec.WriteHeader(http.StatusCreated)
+	rec.Write([]byte("{}"))
+	if rec.status != http.StatusInternalServerError || w.Code != http.StatusInternalServerError {
+		t.Errorf("recorded %d and sent %d, want 500", rec.status, w.Code)
+	}
+
+	rec = &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.Write([]byte("{}"))
+	rec.WriteHeader(http.StatusCreated)
+	if rec.status != http.StatusOK {
+		t.Errorf("recorded %d after an implicit 200", rec.status)
+	}
+}
+
+// Server errors aren't replayed, so a retry runs the handler again
+func TestIdempotentServerErrorsAreNotStored(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	calls := 0
+	handler := app.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			app.serverErrorResponse(w, r, http.ErrAbortHandler)
+			return
+		}
+		app.writeJSON(w, r, http.StatusCreated, envelope{"call": calls}, nil)
+	})
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/Notes", nil)
+		r.Header.Set("Idempotency-Key", "retry-me")
+		r = app.contextSetUser(r, alice.User)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	wantStatus(t, send(), http.StatusInternalServerError)
+	wantStatus(t, send(), http.StatusCreated)
+	w := send()
+	wantStatus(t, w, http.StatusCreated)
+	if w.Header().Get("Idempotent-Replayed") != "true" || calls != 2 {
+		t.Errorf("the second success wasn't replayed; the handler ran %d times", calls)
+	}
+}
@@ -0,0 +1,390 @@
+// Filename: cmd/api/import.go
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+const (
+	// The largest CSV file that can be imported
+	maxImportBytes = 10 << 20
+	// The most rows a single import may hold
+	maxImportRows = 10_000
+	// Imports with more rows than this run in the background
+	importBackgroundRows = 1000
+	// Background jobs still pending or running after this long are failed.
+	// The largest import takes a few minutes, so their process has stopped.
+	importJobTimeout = 15 * time.Minute
+	// How often stale jobs are looked for
+	importSweepEvery = time.Minute
+)
+
+// The errors recorded for jobs that couldn't finish
+var (
+	importServerError = map[string]map[string]string{"import": {"error": "the server encountered a problem and could not import the file"}}
+	importInterrupted = map[string]map[string]string{"import": {"error": "the import was interrupted, please try again"}}
+)
+
+// The Note fields CSV columns can be mapped to
+var importFields = []string{"task_name", "description", "category", "priority", "status"}
+
+// An importRow is a Note read from a line of the CSV file
+type importRow struct {
+	line int
+	note *data.Note
+}
+
+// importNotesHandler for the "POST /v1/Notes/import" endpoint. The file is
+// sent either as the "file" part of a multipart form, with the mapping from
+// CSV column headers to Note fields as JSON in the "mapping" part, or as a
+// text/csv or text/plain body with the mapping in the mapping query
+// parameter. Columns named after a field need no mapping. With
+// ?format=todotxt the file is read as todo.txt instead. Nothing is imported
+// unless every row is valid.
+func (app *application) importNotesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	err := app.checkQueryParams(qs, "dry_run", "mapping", "format")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	format := app.readString(qs, "format", "csv")
+	v.Check(validator.In(format, "csv", "todotxt"), "format", "must be csv or todotxt")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	file, mappingJSON, err := app.readImportUpload(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+	var rows []importRow
+	var rowErrors map[string]map[string]string
+	if format == "todotxt" {
+		v.Check(mappingJSON == "", "mapping", "can't be used with the todotxt format")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		rows, rowErrors, err = readTodoTxtRows(file, app.noteKeys(r), v)
+	} else {
+		mapping := map[string]string{}
+		if mappingJSON != "" {
+			err = json.Unmarshal([]byte(mappingJSON), &mapping)
+			if err != nil {
+				app.badRequestResponse(w, r, errors.New("mapping must be a JSON object of column headers to fields"))
+				return
+			}
+		}
+		rows, rowErrors, err = readImportRows(file, mapping, app.noteKeys(r), v)
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if dryRun {
+		env := envelope{"import": map[string]interface{}{
+			"dry_run":    true,
+			"total_rows": len(rows) + len(rowErrors),
+			"valid_rows": len(rows),
+			"errors":     rowErrors,
+		}}
+		err = app.writeJSON(w, r, http.StatusOK, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", rowErrors)
+		return
+	}
+
+	tenant := app.contextGetTenant(r)
+	if len(rows) > importBackgroundRows {
+		job := &data.ImportJob{UserID: tenant.UserID, WorkspaceID: tenant.WorkspaceID, TotalRows: len(rows)}
+		err = app.models.Imports.Insert(job)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.background(func() {
+			app.runImportJob(job, tenant, rows)
+		})
+		headers := make(http.Header)
+		headers.Set("Location", app.versionedPath(r, fmt.Sprintf("/v1/imports/%d", job.ID)))
+		err = app.writeJSON(w, r, http.StatusAccepted, envelope{"import_job": job}, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	imported, failures, err := app.importRows(tenant, rows)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if len(failures) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "import_failed", failures)
+		return
+	}
+	env := envelope{"import": map[string]interface{}{
+		"total_rows":    len(rows),
+		"imported_rows": imported,
+	}}
+	err = app.writeJSON(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showImportJobHandler for the "GET /v1/imports/:id" endpoint
+func (app *application) showImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	job, err := app.models.Imports.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"import_job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readImportUpload() returns the CSV file and column mapping of an import
+func (app *application) readImportUpload(w http.ResponseWriter, r *http.Request) (io.ReadCloser, string, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+		err := r.ParseMultipartForm(maxImportBytes)
+		if err != nil {
+			return nil, "", fmt.Errorf("the upload must be a multipart form of no more than %d bytes", maxImportBytes)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("the form must have a file part holding the CSV file")
+		}
+		return file, r.FormValue("mapping"), nil
+	case "text/csv", "text/plain":
+		return http.MaxBytesReader(w, r.Body, maxImportBytes), r.URL.Query().Get("mapping"), nil
+	}
+	return nil, "", errors.New("the upload must be multipart/form-data, text/csv or text/plain")
+}
+
+// readImportRows() reads the Notes from a CSV file. Problems with the file as
+// a whole are added to the validator, and invalid rows are returned keyed by
+// line number.
+func readImportRows(file io.Reader, mapping map[string]string, keys data.NoteKeys, v *validator.Validator) ([]importRow, map[string]map[string]string, error) {
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			v.AddError("file", "must have a header row")
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("the file is not valid CSV: %v", err)
+	}
+	// Work out which field each column holds
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		field, ok := mapping[name]
+		if !ok && validator.In(strings.ToLower(name), importFields...) {
+			field = strings.ToLower(name)
+		}
+		if field == "" {
+			continue
+		}
+		if !validator.In(field, importFields...) {
+			v.AddError("mapping", fmt.Sprintf("unknown field %q, valid fields are %s", field, strings.Join(importFields, ", ")))
+			continue
+		}
+		if seen[field] {
+			v.AddError("mapping", fmt.Sprintf("more than one column maps to %q", field))
+			continue
+		}
+		seen[field] = true
+		columns[i] = field
+	}
+	for column := range mapping {
+		v.Check(validator.In(column, header...), "mapping", fmt.Sprintf("the file has no column named %q", column))
+	}
+	if !v.Valid() {
+		return nil, nil, nil
+	}
+
+	rows := []importRow{}
+	rowErrors := map[string]map[string]string{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("the file is not valid CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(rows)+len(rowErrors) == maxImportRows {
+			v.AddError("file", fmt.Sprintf("must not have more than %d rows", maxImportRows))
+			return nil, nil, nil
+		}
+		Note := &data.Note{}
+		for i, value := range record {
+			switch columns[i] {
+			case "task_name":
+				Note.Task_Name = value
+			case "description":
+				Note.Description = value
+			case "category":
+				Note.Category = value
+			case "priority":
+				Note.Priority = value
+			case "status":
+				Note.Status = parseStatusCell(value)
+			}
+		}
+		rv := validator.New()
+		if data.ValidateNoteKeys(rv, Note, keys); !rv.Valid() {
+			rowErrors[strconv.Itoa(line)] = rv.Errors
+			continue
+		}
+		rows = append(rows, importRow{line: line, note: Note})
+	}
+	if len(rows)+len(rowErrors) == 0 {
+		v.AddError("file", "must have at least one row")
+	}
+	return rows, rowErrors, nil
+}
+
+// parseStatusCell() reads the status list from a cell. It is either a JSON
+// array, as written by the CSV export, or comma separated.
+func parseStatusCell(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	var status []string
+	if strings.HasPrefix(value, "[") && json.Unmarshal([]byte(value), &status) == nil {
+		return status
+	}
+	status = strings.Split(value, ",")
+	for i := range status {
+		status[i] = strings.TrimSpace(status[i])
+	}
+	return status
+}
+
+// importRows() inserts the Notes of an import in a single transaction. If any
+// row fails none are kept and the failures are returned keyed by line number.
+func (app *application) importRows(tenant data.Tenant, rows []importRow) (int, map[string]map[string]string, error) {
+	notes := make([]*data.Note, len(rows))
+	for i, row := range rows {
+		notes[i] = row.note
+	}
+	errs, err := app.models.Notes.InsertMany(tenant, notes, true)
+	if err != nil && !errors.Is(err, data.ErrBulkRolledBack) {
+		return 0, nil, err
+	}
+	failures := map[string]map[string]string{}
+	for i, rowErr := range errs {
+		if rowErr != nil {
+			app.logError(nil, rowErr)
+			failures[strconv.Itoa(rows[i].line)] = map[string]string{"row": "could not be imported"}
+		}
+	}
+	if len(failures) > 0 {
+		return 0, failures, nil
+	}
+	return len(rows), nil, nil
+}
+
+// runImportJob() imports the rows of a background job and records the outcome
+func (app *application) runImportJob(job *data.ImportJob, tenant data.Tenant, rows []importRow) {
+	err := app.models.Imports.SetRunning(job.ID)
+	if err != nil {
+		// A job that isn't pending any more has been given up on. Otherwise
+		// the database is failing, and the job is failed if it can still be
+		// recorded, or left for sweepImportJobs() if not.
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logError(nil, err)
+			app.finishImportJob(job.ID, data.ImportFailed, 0, importServerError)
+		}
+		return
+	}
+	// A panic fails the job before background() recovers from it
+	defer func() {
+		if p := recover(); p != nil {
+			app.finishImportJob(job.ID, data.ImportFailed, 0, importServerError)
+			panic(p)
+		}
+	}()
+	status := data.ImportSucceeded
+	imported, failures, err := app.importRows(tenant, rows)
+	if err != nil {
+		app.logError(nil, err)
+		failures = importServerError
+	}
+	if len(failures) > 0 {
+		status = data.ImportFailed
+	}
+	app.finishImportJob(job.ID, status, imported, failures)
+}
+
+// finishImportJob() records the outcome of a job, logging any error
+func (app *application) finishImportJob(id int64, status string, imported int, failures map[string]map[string]string) {
+	err := app.models.Imports.Finish(id, status, imported, failures)
+	if err != nil {
+		app.logError(nil, err)
+	}
+}
+
+// sweepImportJobs() fails the background jobs whose process stopped before
+// they finished, such as those running when the server was restarted. It
+// runs until the program exits.
+func (app *application) sweepImportJobs() {
+	ticker := time.NewTicker(importSweepEvery)
+	defer ticker.Stop()
+	for {
+		n, err := app.models.Imports.FailStale(importJobTimeout, importInterrupted)
+		if err != nil {
+			app.logError(nil, err)
+		} else if n > 0 {
+			app.logger.Printf("failed %d interrupted import jobs", n)
+		}
+		<-ticker.C
+	}
+}
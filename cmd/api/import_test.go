@@ -0,0 +1,156 @@
+// Filename: cmd/api/import_test.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+func TestReadImportRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		mapping map[string]string
+		want    []data.Note
+		rowErrs map[string]map[string]string
+		errs    map[string]string
+	}{
+		{
+			name: "columns named after fields",
+			csv:  "Task_Name,description,category,priority,status\nwash,dishes,home,low,\"todo, doing\"\n",
+			want: []data.Note{{Task_Name: "wash", Description: "dishes", Category: "home", Priority: "low", Status: []string{"todo", "doing"}}},
+		},
+		{
+			name:    "mapped columns, with others left out",
+			csv:     "Title,Notes,Area,Urgency,State,Owner\nwash,dishes,home,low,\"[\"\"todo\"\"]\",alice\n",
+			mapping: map[string]string{"Title": "task_name", "Notes": "description", "Area": "category", "Urgency": "priority", "State": "status"},
+			want:    []data.Note{{Task_Name: "wash", Description: "dishes", Category: "home", Priority: "low", Status: []string{"todo"}}},
+		},
+		{
+			name:    "a mapping wins over a column name",
+			csv:     "task_name,title,description,category,priority,status\nold,new,d,c,p,s\n",
+			mapping: map[string]string{"task_name": "", "title": "task_name"},
+			want:    []data.Note{{Task_Name: "new", Description: "d", Category: "c", Priority: "p", Status: []string{"s"}}},
+		},
+		{
+			name: "invalid rows are keyed by line",
+			csv:  "task_name,description,category,priority,status\nok,d,c,p,s\n,d,c,p,s\nok,d,c,p,\"a,a\"\n",
+			want: []data.Note{{Task_Name: "ok", Description: "d", Category: "c", Priority: "p", Status: []string{"s"}}},
+			rowErrs: map[string]map[string]string{
+				"3": {"name": "must be provided"},
+				"4": {"mode": "must not contain duplicate entries"},
+			},
+		},
+		{
+			name:    "unknown field",
+			csv:     "a\nx\n",
+			mapping: map[string]string{"a": "owner"},
+			errs:    map[string]string{"mapping": `unknown field "owner", valid fields are task_name, description, category, priority, status`},
+		},
+		{
+			name:    "two columns for one field",
+			csv:     "task_name,title\nx,y\n",
+			mapping: map[string]string{"title": "task_name"},
+			errs:    map[string]string{"mapping": `more than one column maps to "task_name"`},
+		},
+		{
+			name:    "missing column",
+			csv:     "task_name\nx\n",
+			mapping: map[string]string{"title": "task_name"},
+			errs:    map[string]string{"mapping": `the file has no column named "title"`},
+		},
+		{
+			name: "no header",
+			csv:  "",
+			errs: map[string]string{"file": "must have a header row"},
+		},
+		{
+			name: "no rows",
+			csv:  "task_name\n",
+			errs: map[string]string{"file": "must have at least one row"},
+		},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		rows, rowErrs, err := readImportRows(strings.NewReader(tt.csv), tt.mapping, data.LegacyNoteKeys, v)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.errs != nil {
+			if !reflect.DeepEqual(v.Errors, tt.errs) {
+				t.Errorf("%s: got errors %v, want %v", tt.name, v.Errors, tt.errs)
+			}
+			continue
+		}
+		if !v.Valid() {
+			t.Errorf("%s: got errors %v", tt.name, v.Errors)
+			continue
+		}
+		got := make([]data.Note, len(rows))
+		for i, row := range rows {
+			got[i] = *row.note
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if tt.rowErrs == nil {
+			tt.rowErrs = map[string]map[string]string{}
+		}
+		if !reflect.DeepEqual(rowErrs, tt.rowErrs) {
+			t.Errorf("%s: got row errors %v, want %v", tt.name, rowErrs, tt.rowErrs)
+		}
+	}
+}
+
+func TestReadImportRowsInvalidCSV(t *testing.T) {
+	_, _, err := readImportRows(strings.NewReader("task_name\n\"open\n"), nil, data.LegacyNoteKeys, validator.New())
+	if err == nil || !strings.HasPrefix(err.Error(), "the file is not valid CSV") {
+		t.Errorf("got %v, want a CSV error", err)
+	}
+}
+
+// A dry run reports what would be imported, and an import with an invalid
+// row imports nothing
+func TestImportDryRunAndRowErrors(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	file := "task_name,description,category,priority,status\nwash,dishes,home,low,todo\n,dishes,home,low,todo\n"
+	count := func() float64 {
+		w := app.do(t, http.MethodGet, "/v1/Notes", alice.token, "")
+		wantStatus(t, w, http.StatusOK)
+		return float64(len(decodeBody(t, w)["Notes"].([]interface{})))
+	}
+
+	w := app.do(t, http.MethodPost, "/v1/Notes/import?dry_run=true", alice.token, file, "Content-Type", "text/csv")
+	wantStatus(t, w, http.StatusOK)
+	summary := decodeBody(t, w)["import"].(map[string]interface{})
+	if summary["total_rows"] != float64(2) || summary["valid_rows"] != float64(1) {
+		t.Errorf("got summary %v", summary)
+	}
+	if errs := summary["errors"].(map[string]interface{}); fmt.Sprint(errs["3"]) != "map[name:must be provided]" {
+		t.Errorf("got errors %v, want line 3 to be reported", errs)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("the dry run imported %v Notes", n)
+	}
+
+	w = app.do(t, http.MethodPost, "/v1/Notes/import", alice.token, file, "Content-Type", "text/csv")
+	wantStatus(t, w, http.StatusUnprocessableEntity)
+	if n := count(); n != 0 {
+		t.Errorf("an import with an invalid row imported %v Notes", n)
+	}
+
+	w = app.do(t, http.MethodPost, "/v1/Notes/import", alice.token, strings.Replace(file, ",dishes", "dry,dishes", 1), "Content-Type", "text/csv")
+	wantStatus(t, w, http.StatusCreated)
+	if n := count(); n != 2 {
+		t.Errorf("got %v Notes, want 2", n)
+	}
+}
@@ -14,6 +14,9 @@ import (
 
 	_ "github.com/lib/pq"
 	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/graphql"
+	"quiz3.desireamagwula.net/internal/oidc"
+	"quiz3.desireamagwula.net/internal/openapi"
 )
 
 const version = "1.0.0"
@@ -29,6 +32,30 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	oidc struct {
+		issuer       string
+		clientID     string
+		clientSecret string
+		redirectURL  string
+	}
+	session struct {
+		cookies      bool
+		secureCookie bool
+	}
+	preconditions struct {
+		strict bool
+	}
+	openapi struct {
+		validate bool
+	}
+	// When version 1 of the API was deprecated and when it will be removed
+	v1 struct {
+		deprecation time.Time
+		sunset      time.Time
+	}
+	graphql struct {
+		limits graphql.Limits
+	}
 }
 
 // DEpendency injection
@@ -36,6 +63,10 @@ type application struct {
 	config config
 	logger *log.Logger
 	models data.Models
+	oidc   *oidc.Provider
+	spec   *openapi.Spec
+	// The schema served at /v1/graphql
+	graphql *graphql.Schema
 }
 
 func main() {
@@ -47,10 +78,33 @@ func main() {
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "Postgresql max open CONNECTIONS")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "Postgresql idle open CONNECTIONS")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgresQL max connection idle time")
+	// Single sign-on is enabled when an issuer is given
+	flag.StringVar(&cfg.oidc.issuer, "oidc-issuer", os.Getenv("TODO_OIDC_ISSUER"), "OpenID Connect issuer URL")
+	flag.StringVar(&cfg.oidc.clientID, "oidc-client-id", os.Getenv("TODO_OIDC_CLIENT_ID"), "OpenID Connect client ID")
+	flag.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", os.Getenv("TODO_OIDC_CLIENT_SECRET"), "OpenID Connect client secret")
+	flag.StringVar(&cfg.oidc.redirectURL, "oidc-redirect-url", "http://localhost:4000/v1/oidc/callback", "OpenID Connect redirect URL")
+	// Cookie sessions for browsers are opt-in
+	flag.BoolVar(&cfg.session.cookies, "session-cookies", false, "Enable cookie based browser sessions")
+	flag.BoolVar(&cfg.session.secureCookie, "session-cookie-secure", true, "Only send session cookies over HTTPS")
+	flag.BoolVar(&cfg.preconditions.strict, "strict-preconditions", false, "Require If-Match when updating or deleting Notes")
+	flag.BoolVar(&cfg.openapi.validate, "validate-requests", false, "Validate requests against the OpenAPI document")
+	flag.IntVar(&cfg.graphql.limits.MaxDepth, "graphql-max-depth", 10, "Deepest nesting of fields a GraphQL query may have")
+	flag.IntVar(&cfg.graphql.limits.MaxComplexity, "graphql-max-complexity", 1000, "Most fields a GraphQL query may resolve, with lists counted for their size")
+	deprecation := flag.String("v1-deprecation", "2026-10-19", "Date version 1 of the API was deprecated (YYYY-MM-DD)")
+	sunset := flag.String("v1-sunset", "2027-04-30", "Date version 1 of the API will be removed (YYYY-MM-DD)")
 	flag.Parse()
 
 	// create a logger
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	var err error
+	cfg.v1.deprecation, err = time.Parse("2006-01-02", *deprecation)
+	if err != nil {
+		logger.Fatalf("invalid -v1-deprecation date: %v", err)
+	}
+	cfg.v1.sunset, err = time.Parse("2006-01-02", *sunset)
+	if err != nil {
+		logger.Fatalf("invalid -v1-sunset date: %v", err)
+	}
 	// CReate the connection pool
 	db, err := openDB(cfg)
 	if err != nil {
@@ -67,6 +121,22 @@ func main() {
 		logger: logger,
 		models: data.NewModels(db),
 	}
+	if cfg.oidc.issuer != "" {
+		app.oidc = oidc.NewProvider(cfg.oidc.issuer, cfg.oidc.clientID, cfg.oidc.clientSecret, cfg.oidc.redirectURL)
+	}
+	app.graphql, err = app.graphqlSchema()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	app.spec, err = openapi.Load()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// Fail the import jobs left behind by a server that stopped
+	app.background(app.sweepImportJobs)
+	// Forget old failed logins
+	app.background(app.sweepLoginThrottles)
 
 	// create new serve mux
 	mux := http.NewServeMux()
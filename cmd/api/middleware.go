@@ -0,0 +1,269 @@
+// Filename: cmd/api/middleware.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"quiz3.desireamagwula.net/internal/codec"
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// negotiatesOwnFormat() reports whether the responses on a path have formats
+// of their own, as the calendar feed, exports, the OpenAPI document and
+// GraphQL do. Those paths skip negotiation and report errors as JSON.
+func negotiatesOwnFormat(path string) bool {
+	return path == "/v1/calendar.ics" || path == "/v1/openapi.json" || path == "/v1/graphql" || strings.HasSuffix(path, "/Notes/export")
+}
+
+// negotiate() chooses the response format from the Accept header, or from
+// the format query parameter, which takes precedence for clients that can't
+// set headers. Requests for a format we can't produce get 406 Not Acceptable
+// before any work is done.
+func (app *application) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Errors are problem details for clients that ask for them by name
+		if codec.Accepts(r.Header.Get("Accept"), codec.ProblemJSON) {
+			r = app.contextSetProblemDetails(r)
+		}
+		if negotiatesOwnFormat(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		var encoder *codec.Encoder
+		var err error
+		// On imports the format parameter names the format of the upload
+		format := r.URL.Query().Get("format")
+		if strings.HasSuffix(r.URL.Path, "/Notes/import") {
+			format = ""
+		}
+		if format != "" {
+			encoder, err = codec.ByName(format, codec.Encoders)
+		} else {
+			encoder, err = codec.Negotiate(r.Header.Get("Accept"), codec.Encoders)
+		}
+		if err != nil {
+			app.notAcceptableResponse(w, r, codec.Encoders)
+			return
+		}
+		r = app.contextSetEncoder(r, encoder)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate() identifies the user from the bearer token, if one was sent
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response varies depending on the Authorization header
+		w.Header().Add("Vary", "Authorization")
+		authorizationHeader := r.Header.Get("Authorization")
+		// Without a header, browsers may be logged in with a session cookie
+		if authorizationHeader == "" && app.config.session.cookies {
+			w.Header().Add("Vary", "Cookie")
+			if cookie, err := r.Cookie(sessionCookieName); err == nil {
+				app.authenticateBrowserSession(w, r, next, cookie.Value)
+				return
+			}
+		}
+		// No header means the client is anonymous
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The header should be of the form "Bearer <token>"
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		token := headerParts[1]
+		// API keys are recognised by their prefix
+		if data.IsAPIKey(token) {
+			app.authenticateAPIKey(w, r, next, token)
+			return
+		}
+		v := validator.New()
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		// Look up the owner of the token
+		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateAPIKey() identifies the user from one of their API keys
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plaintext string) {
+	key, err := app.models.APIKeys.Authenticate(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user, err := app.models.Users.Get(key.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	r = app.contextSetUser(r, user)
+	r = app.contextSetAPIKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
+// authenticateBrowserSession() identifies the user from a session cookie.
+// Unsafe requests must repeat the CSRF token of the session in a header, which
+// a cross-site form or script cannot do. A cookie of an expired or revoked
+// session is cleared and the client carries on anonymously, so that it can
+// still log in again.
+func (app *application) authenticateBrowserSession(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.clearSessionCookie(w)
+		next.ServeHTTP(w, app.contextSetUser(r, data.AnonymousUser))
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeBrowserSession, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.clearSessionCookie(w)
+			next.ServeHTTP(w, app.contextSetUser(r, data.AnonymousUser))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		ok, err := app.models.Tokens.CheckCSRF(token, r.Header.Get(csrfHeaderName))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			app.invalidCSRFTokenResponse(w, r)
+			return
+		}
+	}
+	r = app.contextSetUser(r, user)
+	next.ServeHTTP(w, r)
+}
+
+// requireAuthenticatedUser() rejects anonymous clients. API keys are only
+// accepted on routes that checked their scopes with requireScope().
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		if app.contextGetAPIKey(r) != nil && !app.contextGetScopeChecked(r) {
+			app.apiKeyNotPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireScope() checks that an API key used for the request holds the scope.
+// Requests authenticated with a login token hold every scope.
+func (app *application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := app.contextGetAPIKey(r)
+		if key != nil {
+			if !key.HasScope(scope) {
+				app.apiKeyNotPermittedResponse(w, r)
+				return
+			}
+			r = app.contextSetScopeChecked(r)
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireWorkspaceMember() loads the workspace named by the :wid parameter and
+// checks that the user holds at least the given role in it. Workspaces the user
+// does not belong to are reported as not found so their existence is not leaked.
+func (app *application) requireWorkspaceMember(role string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readWorkspaceIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		user := app.contextGetUser(r)
+		workspace, err := app.models.Workspaces.GetForMember(id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.RoleAtLeast(workspace.Role, role) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		r = app.contextSetWorkspace(r, workspace)
+		next.ServeHTTP(w, r)
+	}
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requirePersonalWorkspace() scopes the un-prefixed routes to the personal
+// workspace of the authenticated user
+func (app *application) requirePersonalWorkspace(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		workspace, err := app.models.Workspaces.GetPersonal(user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		r = app.contextSetWorkspace(r, workspace)
+		next.ServeHTTP(w, r)
+	}
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requireAdmin() only lets administrators through
+func (app *application) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if !user.IsAdmin {
+			app.adminRequiredResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return app.requireAuthenticatedUser(fn)
+}
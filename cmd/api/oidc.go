@@ -0,0 +1,225 @@
+// Filename: cmd/api/oidc.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/oidc"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// oidcLoginCookieName is the cookie that ties a login to the browser that
+// started it, so that a stolen code and state can't be redeemed elsewhere
+const oidcLoginCookieName = "todo_oidc_login"
+
+// oidcLoginHandler for the "GET /v1/oidc/login" endpoint. It redirects the
+// client to the identity provider.
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Generate the secrets of this login attempt
+	login := &data.OIDCLogin{Expiry: time.Now().Add(10 * time.Minute)}
+	var err error
+	for _, dst := range []*string{&login.State, &login.Nonce, &login.CodeVerifier, &login.Binding} {
+		*dst, err = oidc.RandomString()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	// Clear out abandoned attempts before storing the new one
+	err = app.models.Identities.DeleteExpiredLogins()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Identities.InsertLogin(login)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	url, err := app.oidc.AuthCodeURL(r.Context(), login.State, login.Nonce, oidc.CodeChallenge(login.CodeVerifier))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Lax, since the provider sends the browser back with a top level GET
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookieName,
+		Value:    login.Binding,
+		Path:     "/v1/oidc/callback",
+		Expires:  login.Expiry,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// oidcCallbackHandler for the "GET /v1/oidc/callback" endpoint. It completes
+// the login and issues the same authentication token, or two-factor
+// challenge, as a password login.
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	qs := r.URL.Query()
+	// The provider reports failures such as a cancelled login in the query string
+	if providerError := qs.Get("error"); providerError != "" {
+		app.badRequestResponse(w, r, errors.New("identity provider returned "+providerError))
+		return
+	}
+	v := validator.New()
+	v.Check(qs.Get("code") != "", "code", "must be provided")
+	v.Check(qs.Get("state") != "", "state", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	cookie, err := r.Cookie(oidcLoginCookieName)
+	if err != nil || cookie.Value == "" {
+		v.AddError("state", "the login must be completed in the browser that started it")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	login, err := app.models.Identities.TakeLogin(qs.Get("state"), cookie.Value)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("state", "unknown or expired login attempt, or it was started in another browser")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The binding has been used up
+	clearOIDCLoginCookie(w)
+	// Trade the code for tokens and validate the ID token
+	tokens, err := app.oidc.Exchange(r.Context(), qs.Get("code"), login.CodeVerifier)
+	if err != nil {
+		app.logError(r, err)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	claims, err := app.oidc.Verify(r.Context(), tokens.IDToken, login.Nonce)
+	if err != nil {
+		app.logError(r, err)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	user, err := app.userForClaims(claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidClaims):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Users with 2FA enabled finish at "POST /v1/tokens/two-factor", as
+	// they do after a password login
+	if app.sendTwoFactorChallenge(w, r, user) {
+		return
+	}
+	token, err := app.models.Tokens.NewSession(user.ID, 24*time.Hour, r.UserAgent(), app.clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// clearOIDCLoginCookie() tells the browser to forget the login binding
+func clearOIDCLoginCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookieName,
+		Value:    "",
+		Path:     "/v1/oidc/callback",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+var errInvalidClaims = errors.New("id token is missing usable claims")
+
+// userForClaims() finds the user linked to the external account. On first
+// login the account is linked to the user with the same verified email
+// address, or a new user is created. Concurrent first logins end up with
+// the same user.
+func (app *application) userForClaims(claims *oidc.Claims) (*data.User, error) {
+	userID, err := app.models.Identities.GetUserID(app.oidc.Issuer, claims.Subject)
+	switch {
+	case err == nil:
+		return app.models.Users.Get(userID)
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, err
+	}
+	// Only trust addresses the provider has verified
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errInvalidClaims
+	}
+	user, err := app.models.Users.GetByEmail(claims.Email)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		user, err = app.createExternalUser(claims)
+		// Another login created the user first
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			user, err = app.models.Users.GetByEmail(claims.Email)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	identity := &data.Identity{
+		Issuer:  app.oidc.Issuer,
+		Subject: claims.Subject,
+		UserID:  user.ID,
+	}
+	err = app.models.Identities.Insert(identity)
+	if err != nil {
+		return nil, err
+	}
+	// Another login linked the account first
+	if identity.UserID != user.ID {
+		return app.models.Users.Get(identity.UserID)
+	}
+	return user, nil
+}
+
+// createExternalUser() creates a user without a password, along with their
+// personal workspace
+func (app *application) createExternalUser(claims *oidc.Claims) (*data.User, error) {
+	user := &data.User{
+		Name:  claims.Name,
+		Email: claims.Email,
+	}
+	if user.Name == "" {
+		user.Name = claims.Email
+	}
+	v := validator.New()
+	if data.ValidateExternalUser(v, user); !v.Valid() {
+		return nil, errInvalidClaims
+	}
+	workspace := &data.Workspace{
+		Name:     user.Name,
+		Personal: true,
+	}
+	err := app.models.Users.InsertWithWorkspace(user, workspace)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
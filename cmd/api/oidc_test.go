@@ -0,0 +1,220 @@
+// Filename: cmd/api/oidc_test.go
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/oidc"
+	"quiz3.desireamagwula.net/internal/oidc/oidctest"
+	"quiz3.desireamagwula.net/internal/totp"
+)
+
+// newTestIdP() points the application at a mock identity provider
+func (app *application) newTestIdP(t *testing.T) *oidctest.Server {
+	t.Helper()
+	idp := oidctest.NewServer(t, "notes-api")
+	app.oidc = oidc.NewProvider(idp.Issuer(), idp.ClientID, "", "http://localhost:4000/v1/oidc/callback")
+	return idp
+}
+
+// oidcLogin() goes through the login redirect and the provider, and returns
+// the response of the callback
+func (app *application) oidcLogin(t *testing.T, idp *oidctest.Server) map[string]interface{} {
+	t.Helper()
+	w := app.do(t, http.MethodGet, "/v1/oidc/login", "", "")
+	wantStatus(t, w, http.StatusFound)
+	code, state, err := idp.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = app.do(t, http.MethodGet, "/v1/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), "", "", "Cookie", loginCookie(t, w))
+	wantStatus(t, w, http.StatusCreated)
+	return decodeBody(t, w)
+}
+
+// loginCookie() returns the Cookie header a browser sends to the callback
+// after the response of the login redirect
+func loginCookie(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcLoginCookieName {
+			return cookie.Name + "=" + cookie.Value
+		}
+	}
+	t.Fatalf("no %s cookie in %v", oidcLoginCookieName, w.Header()["Set-Cookie"])
+	return ""
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	for _, target := range []string{"/v1/oidc/login", "/v1/oidc/callback?code=c&state=s"} {
+		w := app.do(t, http.MethodGet, target, "", "")
+		wantStatus(t, w, http.StatusNotFound)
+	}
+}
+
+// The first login creates a user, later logins find the same user through
+// the linked identity
+func TestOIDCLogin(t *testing.T) {
+	app := newTestDBApplication(t)
+	idp := app.newTestIdP(t)
+	idp.Claims["email"] = "carol@example.com"
+	idp.Claims["email_verified"] = true
+	idp.Claims["name"] = "Carol"
+
+	body := app.oidcLogin(t, idp)
+	token, _ := body["authentication_token"].(map[string]interface{})
+	plaintext, _ := token["token"].(string)
+	if plaintext == "" {
+		t.Fatalf("no token in %v", body)
+	}
+	w := app.do(t, http.MethodGet, "/v1/workspaces", plaintext, "")
+	wantStatus(t, w, http.StatusOK)
+
+	// The email address is only used to link the first login
+	idp.Claims["email"] = "changed@example.com"
+	app.oidcLogin(t, idp)
+	user, err := app.models.Users.GetByEmail("carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Carol" {
+		t.Errorf("got user %+v", user)
+	}
+}
+
+// An existing account is only linked by a verified email address
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	app := newTestDBApplication(t)
+	idp := app.newTestIdP(t)
+	alice := app.newTestUser(t, "Alice")
+	idp.Claims["email"] = alice.Email
+
+	w := app.do(t, http.MethodGet, "/v1/oidc/login", "", "")
+	code, state, err := idp.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = app.do(t, http.MethodGet, "/v1/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), "", "", "Cookie", loginCookie(t, w))
+	wantStatus(t, w, http.StatusUnauthorized)
+
+	idp.Claims["email_verified"] = true
+	app.oidcLogin(t, idp)
+}
+
+// A state is only accepted once
+func TestOIDCCallbackState(t *testing.T) {
+	app := newTestDBApplication(t)
+	idp := app.newTestIdP(t)
+	idp.Claims["email"] = "dave@example.com"
+	idp.Claims["email_verified"] = true
+
+	w := app.do(t, http.MethodGet, "/v1/oidc/login", "", "")
+	code, state, err := idp.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := loginCookie(t, w)
+	callback := "/v1/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+	wantStatus(t, app.do(t, http.MethodGet, callback, "", "", "Cookie", cookie), http.StatusCreated)
+	wantStatus(t, app.do(t, http.MethodGet, callback, "", "", "Cookie", cookie), http.StatusUnprocessableEntity)
+	wantStatus(t, app.do(t, http.MethodGet, "/v1/oidc/callback?code=c&state=made-up", "", "", "Cookie", cookie), http.StatusUnprocessableEntity)
+}
+
+// A code and state intercepted on the way back from the provider can't be
+// redeemed without the cookie of the browser that started the login
+func TestOIDCCallbackBinding(t *testing.T) {
+	app := newTestDBApplication(t)
+	idp := app.newTestIdP(t)
+	idp.Claims["email"] = "erin@example.com"
+	idp.Claims["email_verified"] = true
+
+	w := app.do(t, http.MethodGet, "/v1/oidc/login", "", "")
+	wantStatus(t, w, http.StatusFound)
+	var set *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcLoginCookieName {
+			set = cookie
+		}
+	}
+	if set == nil || !set.HttpOnly || !set.Secure || set.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("got cookie %+v, want an HttpOnly, Secure, SameSite=Lax cookie", set)
+	}
+	code, state, err := idp.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := "/v1/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+
+	// The attacker's browser has no cookie, or the cookie of a login of its own
+	wantStatus(t, app.do(t, http.MethodGet, callback, "", ""), http.StatusUnprocessableEntity)
+	other := loginCookie(t, app.do(t, http.MethodGet, "/v1/oidc/login", "", ""))
+	wantStatus(t, app.do(t, http.MethodGet, callback, "", "", "Cookie", other), http.StatusUnprocessableEntity)
+
+	// The failed attempts don't use up the login of the victim
+	w = app.do(t, http.MethodGet, callback, "", "", "Cookie", set.Name+"="+set.Value)
+	wantStatus(t, w, http.StatusCreated)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcLoginCookieName && cookie.MaxAge >= 0 {
+			t.Errorf("the callback didn't clear the cookie: %+v", cookie)
+		}
+	}
+}
+
+// Two first logins to the same account end up linked to the same user
+func TestOIDCIdentityInsertConflict(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	bob := app.newTestUser(t, "Bob")
+	first := &data.Identity{Issuer: "https://idp.example.com", Subject: "sub", UserID: alice.ID}
+	if err := app.models.Identities.Insert(first); err != nil {
+		t.Fatal(err)
+	}
+	second := &data.Identity{Issuer: "https://idp.example.com", Subject: "sub", UserID: bob.ID}
+	if err := app.models.Identities.Insert(second); err != nil {
+		t.Fatalf("second insert: %v", err)
+	}
+	if second.UserID != alice.ID {
+		t.Errorf("got user %d, want the first link's user %d", second.UserID, alice.ID)
+	}
+}
+
+// Users with two-factor authentication get the same challenge as after a
+// password login
+func TestOIDCLoginWithTwoFactor(t *testing.T) {
+	app := newTestDBApplication(t)
+	idp := app.newTestIdP(t)
+	alice := app.newTestUser(t, "Alice")
+	idp.Claims["email"] = alice.Email
+	idp.Claims["email_verified"] = true
+
+	w := app.do(t, http.MethodPost, "/v1/users/me/totp", alice.token, "")
+	wantStatus(t, w, http.StatusCreated)
+	secret, _ := decodeBody(t, w)["totp"].(map[string]interface{})["secret"].(string)
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = app.do(t, http.MethodPost, "/v1/users/me/totp/confirm", alice.token, `{"code":"`+code+`"}`)
+	wantStatus(t, w, http.StatusOK)
+	if codes, _ := decodeBody(t, w)["recovery_codes"].([]interface{}); len(codes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(codes))
+	}
+
+	w = app.do(t, http.MethodGet, "/v1/oidc/login", "", "")
+	authCode, state, err := idp.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = app.do(t, http.MethodGet, "/v1/oidc/callback?"+url.Values{"code": {authCode}, "state": {state}}.Encode(), "", "", "Cookie", loginCookie(t, w))
+	wantStatus(t, w, http.StatusAccepted)
+	if _, ok := decodeBody(t, w)["two_factor_token"]; !ok {
+		t.Errorf("no two_factor_token in %s", w.Body.String())
+	}
+}
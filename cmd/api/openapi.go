@@ -0,0 +1,114 @@
+// Filename: cmd/api/openapi.go
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"quiz3.desireamagwula.net/internal/openapi"
+)
+
+// The largest request body the validation middleware reads, the same limit
+// readJSON() applies
+const maxValidatedBody = 1_048_576
+
+// A routeTable is a router that remembers its routes, so that they can be
+// checked against the OpenAPI document
+type routeTable struct {
+	*httprouter.Router
+	routes []route
+}
+
+type route struct {
+	method string
+	path   string
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{Router: httprouter.New()}
+}
+
+// HandlerFunc() registers and records a route
+func (rt *routeTable) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	rt.routes = append(rt.routes, route{method: method, path: path})
+	rt.Router.HandlerFunc(method, path, handler)
+}
+
+// Segments() registers static routes such as "POST /v1/Notes/bulk" through
+// the ":id" route of the same method, for methods that also have deeper
+// routes such as "POST /v1/Notes/:id/comments". httprouter doesn't allow a
+// static segment next to a parameter (see segmentOr()). Any other id gets
+// 405 Method Not Allowed, as it would without the ":id" route. The static
+// routes are recorded, since they are the ones the document describes.
+func (rt *routeTable) Segments(method, path string, handlers map[string]http.HandlerFunc) {
+	for segment := range handlers {
+		rt.routes = append(rt.routes, route{method: method, path: strings.Replace(path, ":id", segment, 1)})
+	}
+	rt.Router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		if handler, ok := handlers[httprouter.ParamsFromContext(r.Context()).ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+		allowed := []string{}
+		for _, other := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			if other == method {
+				continue
+			}
+			if handle, _, _ := rt.Lookup(other, r.URL.Path); handle != nil {
+				allowed = append(allowed, other)
+			}
+		}
+		if len(allowed) == 0 {
+			rt.NotFound.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		rt.MethodNotAllowed.ServeHTTP(w, r)
+	})
+}
+
+// openapiHandler for the "GET /v1/openapi.json" endpoint
+func (app *application) openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapi.Document)
+}
+
+// validateRequests() checks the parameters and JSON bodies of requests
+// against the OpenAPI document before they reach the handlers, when the
+// server runs with -validate-requests. Uploads aren't read, and version 2
+// requests, whose bodies use other names, are left to the handlers.
+func (app *application) validateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.openapi.validate || app.contextGetVersion(r) == apiV2 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var body []byte
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if r.Body != nil && !strings.HasPrefix(mediaType, "multipart/") && !strings.HasPrefix(mediaType, "text/") {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxValidatedBody+1))
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+			// Hand the handler the whole body, including anything past the
+			// limit, so it reports oversized bodies itself
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			if len(body) > maxValidatedBody {
+				body = nil
+			}
+		}
+		if errs := app.spec.ValidateRequest(r, body); errs != nil {
+			app.failedValidationResponse(w, r, errs)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
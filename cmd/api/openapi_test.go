@@ -0,0 +1,63 @@
+// Filename: cmd/api/openapi_test.go
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Every registered route is described in the OpenAPI document
+func TestRoutesDocumented(t *testing.T) {
+	app := newTestApplication(t)
+	for _, rt := range app.registerRoutes().routes {
+		// The document writes :id as {id}
+		segments := strings.Split(rt.path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") {
+				segments[i] = "{" + segment[1:] + "}"
+			}
+		}
+		if !app.spec.Has(rt.method, strings.Join(segments, "/")) {
+			t.Errorf("%s %s is missing from the OpenAPI document", rt.method, rt.path)
+		}
+	}
+}
+
+// With -validate-requests, bodies and parameters that don't match the
+// document are rejected before the handlers run
+func TestValidateRequests(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.openapi.validate = true
+	tests := []struct {
+		method, target, body string
+		status               int
+		errs                 map[string]string
+	}{
+		{http.MethodPost, "/v1/Notes", `{"task_name":1,"extra":true}`, http.StatusUnprocessableEntity,
+			map[string]string{"task_name": "must be a string", "extra": "is not a known field"}},
+		{http.MethodGet, "/v1/Notes?page=abc", "", http.StatusUnprocessableEntity, map[string]string{"page": "must be a number"}},
+		{http.MethodPost, "/v1/Notes/1/comments", `{"body":""}`, http.StatusUnprocessableEntity, map[string]string{"body": "must be provided"}},
+		// Valid requests reach the handler, which wants a user
+		{http.MethodGet, "/v1/Notes?page=2", "", http.StatusUnauthorized, nil},
+		// Version 2 bodies are left to the handlers
+		{http.MethodPost, "/v2/Notes", `{"task_name":1}`, http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		w := app.do(t, tt.method, tt.target, "", tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: got status %d, want %d; body: %s", tt.method, tt.target, w.Code, tt.status, w.Body.String())
+			continue
+		}
+		if tt.errs == nil {
+			continue
+		}
+		errs, _ := decodeBody(t, w)["error"].(map[string]interface{})
+		for key, msg := range tt.errs {
+			if errs[key] != msg {
+				t.Errorf("%s %s: got %q for %s, want %q", tt.method, tt.target, errs[key], key, msg)
+			}
+		}
+	}
+}
@@ -4,21 +4,85 @@ package main
 
 import (
 	"net/http"
-	"github.com/julienschmidt/httprouter"
+	"quiz3.desireamagwula.net/internal/data"
 )
 
 
-func (app *application) routes() *httprouter.Router {
+func (app *application) routes() http.Handler {
+	router := app.registerRoutes()
+	return app.apiVersion(app.negotiate(app.authenticate(app.validateRequests(router))))
+}
+
+// registerRoutes() builds the router. Every route must be described in the
+// OpenAPI document, which TestRoutesDocumented checks.
+func (app *application) registerRoutes() *routeTable {
 	// Create
-	router := httprouter.New()
+	router := newRouteTable()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/Notes", app.listNotesHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/Notes", app.createNoteHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/Notes/:id", app.showNoteHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/Notes/:id", app.updateNoteHandler)
-    router.HandlerFunc(http.MethodDelete, "/v1/Notes/:id", app.deleteNoteHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openapiHandler)
+	// Notes in the personal workspace of the authenticated user. API keys
+	// can reach these routes if they hold the matching scope.
+	router.HandlerFunc(http.MethodGet, "/v1/Notes", app.requireScope(data.ScopeNotesRead, app.requirePersonalWorkspace(app.listNotesHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/Notes", app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.idempotent(app.createNoteHandler))))
+	router.Segments(http.MethodPost, "/v1/Notes/:id", map[string]http.HandlerFunc{
+		"bulk":   app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.idempotent(app.bulkCreateNotesHandler))),
+		"import": app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.importNotesHandler)),
+	})
+	router.HandlerFunc(http.MethodGet, "/v1/Notes/:id", app.requireScope(data.ScopeNotesRead, app.requirePersonalWorkspace(app.segmentOr("export", app.exportNotesHandler, app.showNoteHandler))))
+	router.HandlerFunc(http.MethodPatch, "/v1/Notes/:id", app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.segmentOr("bulk", app.bulkUpdateNotesHandler, app.updateNoteHandler))))
+    router.HandlerFunc(http.MethodDelete, "/v1/Notes/:id", app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.segmentOr("bulk", app.bulkDeleteNotesHandler, app.deleteNoteHandler))))
+	// Comments and checklists of Notes, which ?include= embeds in listings
+	router.HandlerFunc(http.MethodPost, "/v1/Notes/:id/comments", app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.createCommentHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/Notes/:id/checklist", app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.createChecklistItemHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/Notes/:id/checklist/:item", app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.updateChecklistItemHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/calendar/import", app.requireScope(data.ScopeNotesWrite, app.requirePersonalWorkspace(app.importCalendarHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/calendar.ics", app.calendarFeedHandler)
+	// GraphQL over the Notes of every workspace of the user. Mutations check
+	// the notes:write scope and the role of the user themselves.
+	router.HandlerFunc(http.MethodGet, "/v1/graphql", app.requireScope(data.ScopeNotesRead, app.requireAuthenticatedUser(app.graphqlHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/graphql", app.requireScope(data.ScopeNotesRead, app.requireAuthenticatedUser(app.graphqlHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/imports/:id", app.requireScope(data.ScopeNotesWrite, app.requireAuthenticatedUser(app.showImportJobHandler)))
+	// Users and authentication
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/two-factor", app.createTwoFactorTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp", app.requireAuthenticatedUser(app.enrollTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp/confirm", app.requireAuthenticatedUser(app.confirmTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/sessions", app.createBrowserSessionHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/sessions", app.deleteBrowserSessionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.deleteAllSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireAuthenticatedUser(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/calendar-feed", app.requireAuthenticatedUser(app.createCalendarFeedHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/calendar-feed", app.requireAuthenticatedUser(app.deleteCalendarFeedHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/login", app.oidcLoginHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/callback", app.oidcCallbackHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireAuthenticatedUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireAuthenticatedUser(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireAuthenticatedUser(app.deleteAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/lockout", app.requireAdmin(app.unlockUserHandler))
+	// Workspaces and their memberships
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces", app.requireAuthenticatedUser(app.listWorkspacesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces", app.requireAuthenticatedUser(app.createWorkspaceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:wid", app.requireWorkspaceMember(data.RoleViewer, app.showWorkspaceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:wid/members", app.requireWorkspaceMember(data.RoleViewer, app.listWorkspaceMembersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces/:wid/members", app.requireWorkspaceMember(data.RoleAdmin, app.addWorkspaceMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:wid/members/:id", app.requireWorkspaceMember(data.RoleAdmin, app.removeWorkspaceMemberHandler))
+	// Notes in a shared workspace
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:wid/Notes", app.requireScope(data.ScopeNotesRead, app.requireWorkspaceMember(data.RoleViewer, app.listNotesHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces/:wid/Notes", app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.idempotent(app.createNoteHandler))))
+	router.Segments(http.MethodPost, "/v1/workspaces/:wid/Notes/:id", map[string]http.HandlerFunc{
+		"bulk":   app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.idempotent(app.bulkCreateNotesHandler))),
+		"import": app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.importNotesHandler)),
+	})
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:wid/Notes/:id", app.requireScope(data.ScopeNotesRead, app.requireWorkspaceMember(data.RoleViewer, app.segmentOr("export", app.exportNotesHandler, app.showNoteHandler))))
+	router.HandlerFunc(http.MethodPatch, "/v1/workspaces/:wid/Notes/:id", app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.segmentOr("bulk", app.bulkUpdateNotesHandler, app.updateNoteHandler))))
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:wid/Notes/:id", app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.segmentOr("bulk", app.bulkDeleteNotesHandler, app.deleteNoteHandler))))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces/:wid/Notes/:id/comments", app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.createCommentHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces/:wid/Notes/:id/checklist", app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.createChecklistItemHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/workspaces/:wid/Notes/:id/checklist/:item", app.requireScope(data.ScopeNotesWrite, app.requireWorkspaceMember(data.RoleMember, app.updateChecklistItemHandler)))
 
 	return router
-}
\ No newline at end of file
+}
@@ -0,0 +1,166 @@
+// Filename: cmd/api/sessions.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// The name of the cookie holding browser sessions and the header that must
+// repeat the CSRF token on unsafe requests
+const (
+	sessionCookieName = "todo_session"
+	csrfHeaderName    = "X-CSRF-Token"
+)
+
+// listSessionsHandler for the "GET /v1/users/me/sessions" endpoint
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	sessions, err := app.models.Tokens.GetSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSessionHandler for the "DELETE /v1/users/me/sessions/:id" endpoint
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	err = app.models.Tokens.DeleteSessionForUser(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAllSessionsHandler for the "DELETE /v1/users/me/sessions" endpoint.
+// It logs the user out everywhere, including the session making the request.
+func (app *application) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := app.models.Tokens.DeleteAllSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "all sessions successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createBrowserSessionHandler for the "POST /v1/sessions" endpoint. It logs
+// in like "POST /v1/tokens/authentication" but keeps the token in an HttpOnly
+// cookie and returns a CSRF token instead.
+func (app *application) createBrowserSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.config.session.cookies {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, ok := app.authenticatePassword(w, r, input.Email, input.Password)
+	if !ok {
+		return
+	}
+	if app.sendTwoFactorChallenge(w, r, user) {
+		return
+	}
+	app.startBrowserSession(w, r, user)
+}
+
+// startBrowserSession() creates a browser session, sets its cookie and sends
+// the CSRF token to the client
+func (app *application) startBrowserSession(w http.ResponseWriter, r *http.Request, user *data.User) {
+	token, err := app.models.Tokens.NewBrowserSession(user.ID, 24*time.Hour, r.UserAgent(), app.clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token.Plaintext,
+		Path:     "/",
+		Expires:  token.Expiry,
+		HttpOnly: true,
+		Secure:   app.config.session.secureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+	env := envelope{"session": map[string]interface{}{
+		"csrf_token": token.CSRFToken,
+		"expiry":     token.Expiry,
+	}}
+	err = app.writeJSON(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteBrowserSessionHandler for the "DELETE /v1/sessions" endpoint. It
+// ends the browser session of the request and clears the cookie.
+func (app *application) deleteBrowserSessionHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || !app.config.session.cookies {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Tokens.DeleteToken(data.ScopeBrowserSession, cookie.Value)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.clearSessionCookie(w)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "successfully logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// clearSessionCookie() tells the browser to forget its session cookie
+func (app *application) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   app.config.session.secureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,114 @@
+// Filename: cmd/api/sessions_test.go
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wantClearedCookie() fails the test unless the response deletes the
+// session cookie
+func wantClearedCookie(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookieName && cookie.MaxAge < 0 {
+			return
+		}
+	}
+	t.Errorf("the session cookie wasn't cleared; Set-Cookie: %q", w.Header().Values("Set-Cookie"))
+}
+
+// A malformed cookie is dropped and the request carries on anonymously
+func TestMalformedSessionCookie(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.session.cookies = true
+	w := app.do(t, http.MethodGet, "/v1/healthcheck", "", "", "Cookie", sessionCookieName+"=garbage")
+	wantStatus(t, w, http.StatusOK)
+	wantClearedCookie(t, w)
+}
+
+// The cookie of a session that has ended doesn't lock the browser out: it
+// can still log in and out, and other requests are anonymous
+func TestStaleSessionCookie(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.session.cookies = true
+	alice := app.newTestUser(t, "Alice")
+	login := `{"email":"` + alice.Email + `","password":"pa55word1234"}`
+
+	w := app.do(t, http.MethodPost, "/v1/sessions", "", login)
+	wantStatus(t, w, http.StatusCreated)
+	cookie := sessionCookieName + "=" + w.Result().Cookies()[0].Value
+	csrf, _ := decodeBody(t, w)["session"].(map[string]interface{})["csrf_token"].(string)
+	w = app.do(t, http.MethodDelete, "/v1/users/me/sessions", "", "", "Cookie", cookie, csrfHeaderName, csrf)
+	wantStatus(t, w, http.StatusOK)
+
+	w = app.do(t, http.MethodGet, "/v1/users/me/sessions", "", "", "Cookie", cookie)
+	wantStatus(t, w, http.StatusUnauthorized)
+	wantClearedCookie(t, w)
+	w = app.do(t, http.MethodDelete, "/v1/sessions", "", "", "Cookie", cookie)
+	wantStatus(t, w, http.StatusOK)
+	wantClearedCookie(t, w)
+	w = app.do(t, http.MethodPost, "/v1/sessions", "", login, "Cookie", cookie)
+	wantStatus(t, w, http.StatusCreated)
+}
+
+// browserLogin() logs the user in with a session cookie and returns the
+// Cookie header and the CSRF token
+func (app *application) browserLogin(t *testing.T, user *testUser) (string, string) {
+	t.Helper()
+	w := app.do(t, http.MethodPost, "/v1/sessions", "", `{"email":"`+user.Email+`","password":"pa55word1234"}`)
+	wantStatus(t, w, http.StatusCreated)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			csrf, _ := decodeBody(t, w)["session"].(map[string]interface{})["csrf_token"].(string)
+			return cookie.Name + "=" + cookie.Value, csrf
+		}
+	}
+	t.Fatalf("no session cookie in %q", w.Header().Values("Set-Cookie"))
+	return "", ""
+}
+
+// Unsafe requests with a session cookie need the CSRF token of that session,
+// which a cross-site form or script can't send
+func TestSessionCSRF(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.session.cookies = true
+	alice := app.newTestUser(t, "Alice")
+	cookie, csrf := app.browserLogin(t, alice)
+	_, otherCSRF := app.browserLogin(t, alice)
+	body := `{"task_name":"from the browser","description":"d","category":"c","priority":"low","status":["todo"]}`
+
+	tests := []struct {
+		name    string
+		headers []string
+		want    int
+	}{
+		{"no token", []string{"Cookie", cookie}, http.StatusForbidden},
+		{"made-up token", []string{"Cookie", cookie, csrfHeaderName, "made-up"}, http.StatusForbidden},
+		{"token of another session", []string{"Cookie", cookie, csrfHeaderName, otherCSRF}, http.StatusForbidden},
+		{"token of the session", []string{"Cookie", cookie, csrfHeaderName, csrf}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := app.do(t, http.MethodPost, "/v1/Notes", "", body, tt.headers...)
+			wantStatus(t, w, tt.want)
+			if tt.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "CSRF") {
+				t.Errorf("got %s, want a CSRF error", w.Body.String())
+			}
+		})
+	}
+	// Only the request with the token got through
+	w := app.do(t, http.MethodGet, "/v1/Notes", "", "", "Cookie", cookie)
+	wantStatus(t, w, http.StatusOK)
+	if notes := decodeBody(t, w)["Notes"].([]interface{}); len(notes) != 1 {
+		t.Errorf("got %d Notes, want 1", len(notes))
+	}
+	// Every unsafe method is checked, including logging out everywhere
+	w = app.do(t, http.MethodDelete, "/v1/users/me/sessions", "", "", "Cookie", cookie)
+	wantStatus(t, w, http.StatusForbidden)
+	w = app.do(t, http.MethodGet, "/v1/users/me/sessions", "", "", "Cookie", cookie)
+	wantStatus(t, w, http.StatusOK)
+}
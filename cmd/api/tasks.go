@@ -2,11 +2,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/jsonpatch"
+	"quiz3.desireamagwula.net/internal/query"
 	"quiz3.desireamagwula.net/internal/validator"
 )
 
@@ -44,23 +52,26 @@ func (app *application) createNoteHandler(w http.ResponseWriter, r *http.Request
 	v := validator.New()
 
 	// Check the map to determine if there were any validation errors
-	if data.ValidateNote(v, Note); !v.Valid() {
+	if app.validateNote(r, v, Note); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// CReate a Note
-	err = app.models.Notes.Insert(Note)
+	// CReate a Note in the workspace being accessed
+	tenant := app.contextGetTenant(r)
+	err = app.models.Notes.Insert(tenant, Note)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// CReate a location header for the newly created
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/Notes/%d", Note.ID))
+	headers.Set("Location", fmt.Sprintf("%s/%d", app.versionedPath(r, r.URL.Path), Note.ID))
+	headers.Set("ETag", noteETag(Note, app.representation(r)))
 	//Write the JSON response with 201 - Created status code with the body
 	// being the Note data and the header being the headers map
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"Note": Note}, headers)
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"Note": Note}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 
@@ -71,17 +82,18 @@ func (app *application) createNoteHandler(w http.ResponseWriter, r *http.Request
 func (app *application) showNoteHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.noteNotFoundResponse(w, r)
 		return
 	}
 
 	// Fetch the specific Note
-	Note, err := app.models.Notes.Get(id)
+	tenant := app.contextGetTenant(r)
+	Note, err := app.models.Notes.Get(tenant, id)
 	// Handle errors
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.noteNotFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -89,8 +101,15 @@ func (app *application) showNoteHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Clients holding the current version get an empty 304
+	etag := noteETag(Note, app.representation(r))
+	if app.notModified(w, r, etag) {
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
 	// Write the sdata returned by Get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"Note": Note}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"Note": Note}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -101,55 +120,82 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 	// Get the id for the Note that needs updating
 	id, err := app.readIDParam(r)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.noteNotFoundResponse(w, r)
 		return
 	}
 	// Fetch the orginal record from the database
-	Note, err := app.models.Notes.Get(id)
+	tenant := app.contextGetTenant(r)
+	Note, err := app.models.Notes.Get(tenant, id)
 	// Handle errors
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.noteNotFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// Create an input struct to hold data read in from the client
-	// We update input struct to use pointers because pointers have a
-	// default value of nil
-	// If a field remains nil then we know that the client did not update it
-	var input struct {
-		Task_Name    *string  `json:"task_name"`
-		Description   *string  `json:"description"`
-		Category *string  `json:"category"`
-		Priority   *string  `json:"priority"`
-		Status    []string `json:"status"`
-	}
-
-	// Initialize a new json.Decoder instance
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	// Refuse to overwrite changes the client hasn't seen
+	ifMatch := r.Header.Get("If-Match") != ""
+	if !app.checkIfMatch(w, r, Note) {
 		return
 	}
-	// Check for updates
-	if input.Task_Name != nil {
-		Note.Task_Name = *input.Task_Name
-	}
-	if input.Description != nil {
-		Note.Description = *input.Description
-	}
-	if input.Category != nil {
-		Note.Category = *input.Category
-	}
-	if input.Priority != nil {
-		Note.Priority = *input.Priority
-	}
-	if input.Status != nil {
-		Note.Status = input.Status
+
+	// JSON Patch and JSON Merge Patch documents are applied to the whole
+	// Note. Any other body is read as the fields to change.
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case jsonPatchContentType, mergePatchContentType:
+		err = app.applyNotePatch(w, r, contentType, Note)
+		if err != nil {
+			var opErr *jsonpatch.OperationError
+			switch {
+			case errors.Is(err, jsonpatch.ErrTestFailed):
+				app.patchTestFailedResponse(w, r, err)
+			case errors.As(err, &opErr), errors.Is(err, errInvalidPatchResult):
+				app.failedValidationResponse(w, r, map[string]string{"patch": err.Error()})
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+	default:
+		// Create an input struct to hold data read in from the client
+		// We update input struct to use pointers because pointers have a
+		// default value of nil
+		// If a field remains nil then we know that the client did not update it
+		var input struct {
+			Task_Name    *string  `json:"task_name"`
+			Description   *string  `json:"description"`
+			Category *string  `json:"category"`
+			Priority   *string  `json:"priority"`
+			Status    []string `json:"status"`
+		}
+
+		// Initialize a new json.Decoder instance
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		// Check for updates
+		if input.Task_Name != nil {
+			Note.Task_Name = *input.Task_Name
+		}
+		if input.Description != nil {
+			Note.Description = *input.Description
+		}
+		if input.Category != nil {
+			Note.Category = *input.Category
+		}
+		if input.Priority != nil {
+			Note.Priority = *input.Priority
+		}
+		if input.Status != nil {
+			Note.Status = input.Status
+		}
 	}
 
 	// Perform validation on the updated Note. If validation fails, then
@@ -158,14 +204,16 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 	v := validator.New()
 
 	// Check the map to determine if there were any validation errors
-	if data.ValidateNote(v, Note); !v.Valid() {
+	if app.validateNote(r, v, Note); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	// Let's pass the updated Note record to the Update() method
-	err = app.models.Notes.Update(Note)
+	err = app.models.Notes.Update(tenant, Note)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && ifMatch:
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -173,29 +221,111 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+	headers := make(http.Header)
+	headers.Set("ETag", noteETag(Note, app.representation(r)))
 	// Write the data returned by Get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"Note": Note}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"Note": Note}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
 
+// The media types of the patch formats accepted by updateNoteHandler
+const (
+	jsonPatchContentType  = "application/json-patch+json"
+	mergePatchContentType = "application/merge-patch+json"
+)
+
+var errInvalidPatchResult = errors.New("patch result is not a valid Note")
+
+// applyNotePatch() applies a JSON Patch or JSON Merge Patch from the request
+// body to a Note. Patches address the fields by their request names, e.g.
+// "/task_name" or "/status/-".
+func (app *application) applyNotePatch(w http.ResponseWriter, r *http.Request, contentType string, Note *data.Note) error {
+	maxBytes := 1_048_576
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		return fmt.Errorf("The body must not be larger than %d bytes", maxBytes)
+	}
+	type patchable struct {
+		Task_Name   string   `json:"task_name"`
+		Description string   `json:"description"`
+		Category    string   `json:"category"`
+		Priority    string   `json:"priority"`
+		Status      []string `json:"status"`
+	}
+	doc, err := json.Marshal(patchable{
+		Task_Name:   Note.Task_Name,
+		Description: Note.Description,
+		Category:    Note.Category,
+		Priority:    Note.Priority,
+		Status:      Note.Status,
+	})
+	if err != nil {
+		return err
+	}
+	if contentType == jsonPatchContentType {
+		doc, err = jsonpatch.Apply(doc, body)
+	} else {
+		doc, err = jsonpatch.ApplyMerge(doc, body)
+	}
+	if err != nil {
+		return err
+	}
+	// Read the result back, rejecting fields a Note doesn't have
+	var patched patchable
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&patched)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidPatchResult, err)
+	}
+	Note.Task_Name = patched.Task_Name
+	Note.Description = patched.Description
+	Note.Category = patched.Category
+	Note.Priority = patched.Priority
+	Note.Status = patched.Status
+	return nil
+}
+
 func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
 
 	id, err := app.readIDParam(r)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.noteNotFoundResponse(w, r)
 		return
 	}
+	tenant := app.contextGetTenant(r)
+	// A conditional delete needs the current version of the Note, and only
+	// deletes the Note if it is still at that version
+	var version int32
+	if r.Header.Get("If-Match") != "" || app.config.preconditions.strict {
+		Note, err := app.models.Notes.Get(tenant, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.noteNotFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !app.checkIfMatch(w, r, Note) {
+			return
+		}
+		version = Note.Version
+	}
 	// Delete the Note from the Database. Send a 404 not found status cide to the client
 	// if not found
-
-	err = app.models.Notes.Delete(id)
+	err = app.models.Notes.Delete(tenant, id, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.noteNotFoundResponse(w, r)
+		// The Note changed since its tag was checked
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -203,50 +333,163 @@ func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	// Return 200 Status OK to the client with a success message
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Note successfuly deleted"}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "Note successfuly deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
 
+// The query parameters that filter Notes
+var noteFilterParams = []string{
+	"task_name", "description", "category", "priority", "status",
+	"created_after", "created_before", "q",
+}
+
+// The query parameters accepted when listing Notes
+var noteListParams = append([]string{
+	"page", "page_size", "cursor", "sort", "fields", "include", "format",
+}, noteFilterParams...)
+
+// The sort values and fields Notes can be listed with
+var (
+	noteSortList  = []string{"id", "task_name", "description", "-id", "-task_name", "-description"}
+	noteFieldList = []string{"id", "task_name", "description", "category", "priority", "status", "version"}
+)
+
+// sparseNote() keeps only the requested fields of a Note. The keys are the
+// same as in the full representation.
+func sparseNote(Note *data.Note, fields []string) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "id":
+			m["id"] = Note.ID
+		case "task_name":
+			m["task_name"] = Note.Task_Name
+		case "description":
+			m["desription"] = Note.Description
+		case "category":
+			m["category"] = Note.Category
+		case "priority":
+			m["priority"] = Note.Priority
+		case "status":
+			m["status"] = Note.Status
+		case "version":
+			m["version"] = Note.Version
+		}
+	}
+	return m
+}
+
+// readNoteFilter() reads the query parameters that filter Notes
+func (app *application) readNoteFilter(qs url.Values, v *validator.Validator) data.NoteFilter {
+	filter := data.NoteFilter{
+		Task_Name:     app.readString(qs, "task_name", ""),
+		Description:   app.readString(qs, "description", ""),
+		Category:      app.readString(qs, "category", ""),
+		Priority:      app.readString(qs, "priority", ""),
+		Status:        app.readCSV(qs, "status", []string{}),
+		CreatedAfter:  app.readTime(qs, "created_after", v),
+		CreatedBefore: app.readTime(qs, "created_before", v),
+	}
+	// The q parameter holds an expression in the query language
+	if q := qs.Get("q"); q != "" {
+		var err error
+		filter.Query, err = query.Parse(q, data.NoteQueryFields)
+		if err != nil {
+			v.AddError("q", err.Error())
+		}
+	}
+	data.ValidateNoteFilter(v, filter)
+	return filter
+}
+
 // Allows the client to see a listing of Notes based on a set of criterias
 
 func (app *application) listNotesHandler(w http.ResponseWriter, r *http.Request) {
 	// Create an input struct to hold our query paraneters
 	var input struct {
-		Task_Name  string
-		Description string
-		Status  []string
+		data.NoteFilter
 		data.Filters
 	}
 	v := validator.New()
 	// Get the url values map
 	qs := r.URL.Query()
+	// Reject parameters we don't know rather than silently ignoring them
+	err := app.checkQueryParams(qs, noteListParams...)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
 	// Use the helper methods to extfract the values
-	input.Task_Name = app.readString(qs, "name", "")
-	input.Description = app.readString(qs, "level", "")
-	input.Status = app.readCSV(qs, "mode", []string{})
+	input.NoteFilter = app.readNoteFilter(qs, v)
 	//Get the page information
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// A cursor parameter, even an empty one, switches to cursor pagination
+	input.Filters.UseCursor = qs.Has("cursor")
+	input.Filters.Cursor = qs.Get("cursor")
 	// Get the sort info
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	// Specify the allowed sort values
-	input.Filters.SortList = []string{"id", "task_name", "description", "-id", "-task_name", "-description"}
+	input.Filters.SortList = noteSortList
+	// Get the fields to return and the related resources to embed
+	input.Filters.Fields = app.readCSV(qs, "fields", []string{})
+	input.Filters.FieldList = noteFieldList
+	includes := app.readCSV(qs, "include", []string{})
+	for _, include := range includes {
+		if !validator.In(include, noteIncludeList...) {
+			v.AddError("include", fmt.Sprintf("unknown related resource %q, Notes can include %s", include, strings.Join(noteIncludeList, ", ")))
+		}
+	}
 	// CHeck for validation error
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	// Get a listing of all Notes
-	Notes, metadata, err := app.models.Notes.GetAll(input.Task_Name, input.Description, input.Status, input.Filters)
+	tenant := app.contextGetTenant(r)
+	Notes, metadata, err := app.models.Notes.GetAll(tenant, input.NoteFilter, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	// Send a JSON response containing all the Notes
-	err = app.writeJSON(w, http.StatusOK, envelope{"Notes": Notes, "metadata ": metadata}, nil)
+	related, err := app.loadNoteIncludes(tenant, Notes, includes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Comments and checklist items don't change the version of their Note,
+	// so the tag covers them too
+	etag, err := listETag(Notes, metadata, app.representation(r), related)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if app.notModified(w, r, etag) {
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+	// Send a JSON response containing all the Notes, or only the fields
+	// that were asked for along with the related resources
+	env := envelope{"Notes": Notes, "metadata ": metadata}
+	if len(input.Filters.Fields) > 0 || len(related) > 0 {
+		fields := input.Filters.Fields
+		if len(fields) == 0 {
+			fields = noteFieldList
+		}
+		sparse := make([]map[string]interface{}, len(Notes))
+		for i, Note := range Notes {
+			sparse[i] = sparseNote(Note, fields)
+			for include, byNote := range related {
+				sparse[i][include] = byNote[Note.ID]
+			}
+		}
+		env["Notes"] = sparse
+	}
+	err = app.writeJSON(w, r, http.StatusOK, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
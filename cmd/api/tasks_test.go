@@ -0,0 +1,183 @@
+// Filename: cmd/api/tasks_test.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// Paging through the listing with cursors, newest first, returns every Note
+// once, and cursors that were edited or issued for another sort are refused
+func TestListNotesCursor(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	var want []float64
+	for i := 0; i < 5; i++ {
+		note := app.newTestNote(t, alice, alice.workspace.ID, fmt.Sprintf("note %d", i))
+		want = append([]float64{float64(note.ID)}, want...)
+	}
+	var got []float64
+	cursor := ""
+	for {
+		w := app.do(t, http.MethodGet, "/v1/Notes?sort=-id&page_size=2&cursor="+url.QueryEscape(cursor), alice.token, "")
+		wantStatus(t, w, http.StatusOK)
+		body := decodeBody(t, w)
+		for _, note := range body["Notes"].([]interface{}) {
+			got = append(got, note.(map[string]interface{})["id"].(float64))
+		}
+		cursor, _ = body["metadata "].(map[string]interface{})["next_cursor"].(string)
+		if cursor == "" {
+			break
+		}
+		// A cursor can't be used with another sort
+		w = app.do(t, http.MethodGet, "/v1/Notes?sort=id&page_size=2&cursor="+url.QueryEscape(cursor), alice.token, "")
+		wantStatus(t, w, http.StatusUnprocessableEntity)
+		// Nor can it be edited
+		w = app.do(t, http.MethodGet, "/v1/Notes?sort=-id&page_size=2&cursor="+url.QueryEscape(cursor[1:]), alice.token, "")
+		wantStatus(t, w, http.StatusUnprocessableEntity)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got ids %v, want %v", got, want)
+	}
+}
+
+func TestCheckQueryParams(t *testing.T) {
+	app := newTestApplication(t)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"task_name=a&description=b&category=c&priority=d&status=e&created_after=2024-01-01&created_before=2025-01-01&q=x", ""},
+		{"page=1&page_size=5&sort=-id&fields=id&include=comments&format=csv&cursor=", ""},
+		// The keys the listing used to read by mistake
+		{"name=a&level=b&mode=c", "unknown query parameter(s) level, mode, name; valid parameters are " + strings.Join(noteListParams, ", ")},
+		{"task_name=a&workspace_id=2", "unknown query parameter(s) workspace_id; valid parameters are " + strings.Join(noteListParams, ", ")},
+		// Keys are case sensitive
+		{"Task_Name=a", "unknown query parameter(s) Task_Name; valid parameters are " + strings.Join(noteListParams, ", ")},
+	}
+	for _, tt := range tests {
+		qs, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := app.checkQueryParams(qs, noteListParams...); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// Each filter parameter feeds the field of the same name
+func TestReadNoteFilter(t *testing.T) {
+	app := newTestApplication(t)
+	qs, _ := url.ParseQuery("task_name=milk&description=shop&category=home&priority=high&status=todo,doing&created_after=2024-01-01&created_before=2024-02-01T12:00:00Z")
+	v := validator.New()
+	got := app.readNoteFilter(qs, v)
+	want := data.NoteFilter{
+		Task_Name:     "milk",
+		Description:   "shop",
+		Category:      "home",
+		Priority:      "high",
+		Status:        []string{"todo", "doing"},
+		CreatedAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if !v.Valid() || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v (errors %v), want %+v", got, v.Errors, want)
+	}
+
+	for query, key := range map[string]string{
+		"created_after=yesterday":                            "created_after",
+		"created_before=2024-13-01":                          "created_before",
+		"created_after=2024-02-01&created_before=2024-01-01": "created_after",
+		"created_after=2024-01-01&created_before=2024-01-01": "created_after",
+		"q=task_name:":     "q",
+		"q=workspace_id:1": "q",
+	} {
+		qs, _ := url.ParseQuery(query)
+		v := validator.New()
+		app.readNoteFilter(qs, v)
+		if _, ok := v.Errors[key]; !ok {
+			t.Errorf("%q: got errors %v, want one for %s", query, v.Errors, key)
+		}
+	}
+}
+
+// Only the listed sort values reach the ORDER BY clause
+func TestNoteSortList(t *testing.T) {
+	for _, sort := range noteSortList {
+		v := validator.New()
+		data.ValidateSortAndFields(v, data.Filters{Sort: sort, SortList: noteSortList})
+		if !v.Valid() {
+			t.Errorf("%q was rejected: %v", sort, v.Errors)
+		}
+	}
+	for _, sort := range []string{"", "workspace_id", "--id", "id desc", "id;drop table notes", "ID", "+id", "-"} {
+		v := validator.New()
+		data.ValidateSortAndFields(v, data.Filters{Sort: sort, SortList: noteSortList})
+		if v.Errors["sort"] != "invalid sort value" {
+			t.Errorf("%q: got errors %v, want an invalid sort value", sort, v.Errors)
+		}
+	}
+}
+
+// The listing filters on every Note field and on the creation time
+func TestListNotesFilters(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	create := func(body string) {
+		wantStatus(t, app.do(t, http.MethodPost, "/v1/Notes", alice.token, body), http.StatusCreated)
+	}
+	create(`{"task_name":"Buy milk","description":"from the shop","category":"Home","priority":"high","status":["todo"]}`)
+	create(`{"task_name":"Write report","description":"for the team","category":"Work","priority":"low","status":["doing","blocked"]}`)
+	create(`{"task_name":"Buy stamps","description":"post office","category":"Errands","priority":"low","status":["done"]}`)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Buy milk", "Write report", "Buy stamps"}},
+		{"task_name=buy", []string{"Buy milk", "Buy stamps"}},
+		{"description=team", []string{"Write report"}},
+		{"category=home", []string{"Buy milk"}},
+		{"priority=LOW", []string{"Write report", "Buy stamps"}},
+		{"status=blocked", []string{"Write report"}},
+		{"status=doing,blocked", []string{"Write report"}},
+		{"status=todo,done", []string{}},
+		{"task_name=buy&priority=low", []string{"Buy stamps"}},
+		{"created_after=2000-01-01", []string{"Buy milk", "Write report", "Buy stamps"}},
+		{"created_before=2000-01-01", []string{}},
+		{"created_after=2999-01-01", []string{}},
+	}
+	for _, tt := range tests {
+		w := app.do(t, http.MethodGet, "/v1/Notes?sort=id&"+tt.query, alice.token, "")
+		wantStatus(t, w, http.StatusOK)
+		got := []string{}
+		for _, note := range decodeBody(t, w)["Notes"].([]interface{}) {
+			got = append(got, note.(map[string]interface{})["task_name"].(string))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	w := app.do(t, http.MethodGet, "/v1/Notes?name=milk", alice.token, "")
+	wantStatus(t, w, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), "valid parameters are") {
+		t.Errorf("got %s, want the valid parameters listed", w.Body.String())
+	}
+	wantStatus(t, app.do(t, http.MethodGet, "/v1/Notes?sort=category", alice.token, ""), http.StatusUnprocessableEntity)
+}
@@ -0,0 +1,129 @@
+// Filename: cmd/api/testutils_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/openapi"
+	"quiz3.desireamagwula.net/internal/testdb"
+)
+
+// newTestApplication() returns an application without a database, for
+// tests that don't reach the models
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+	app := &application{
+		logger: log.New(io.Discard, "", 0),
+	}
+	app.config.env = "testing"
+	app.config.v1.deprecation = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	app.config.v1.sunset = time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC)
+	app.config.graphql.limits.MaxDepth = 10
+	app.config.graphql.limits.MaxComplexity = 1000
+	var err error
+	app.spec, err = openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.graphql, err = app.graphqlSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// newTestDBApplication() returns an application backed by a migrated test
+// database. The test is skipped if there is no test database.
+func newTestDBApplication(t *testing.T) *application {
+	t.Helper()
+	app := newTestApplication(t)
+	app.models = data.NewModels(testdb.Open(t))
+	return app
+}
+
+// A testUser is a registered user with a personal workspace and a token
+type testUser struct {
+	*data.User
+	workspace *data.Workspace
+	token     string
+}
+
+// newTestUser() registers a user and logs them in
+func (app *application) newTestUser(t *testing.T, name string) *testUser {
+	t.Helper()
+	user := &data.User{Name: name, Email: strings.ToLower(name) + "@example.com"}
+	if err := user.Password.Set("pa55word1234"); err != nil {
+		t.Fatal(err)
+	}
+	workspace := &data.Workspace{Name: name, Personal: true}
+	if err := app.models.Users.InsertWithWorkspace(user, workspace); err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testUser{User: user, workspace: workspace, token: token.Plaintext}
+}
+
+// newTestNote() adds a Note to a workspace of the user
+func (app *application) newTestNote(t *testing.T, user *testUser, workspaceID int64, name string) *data.Note {
+	t.Helper()
+	note := &data.Note{
+		Task_Name:   name,
+		Description: "a note for testing",
+		Category:    "testing",
+		Priority:    "low",
+		Status:      []string{"todo"},
+	}
+	err := app.models.Notes.Insert(data.Tenant{UserID: user.ID, WorkspaceID: workspaceID}, note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return note
+}
+
+// do() sends a request through the full middleware chain. The token is
+// sent as a bearer token if it isn't empty.
+func (app *application) do(t *testing.T, method, target, token, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	return w
+}
+
+// decodeBody() decodes a JSON response body
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// wantStatus() fails the test if the response doesn't have the status
+func wantStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d; body: %s", w.Code, status, w.Body.String())
+	}
+}
@@ -0,0 +1,255 @@
+// Filename: cmd/api/todotxt.go
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"quiz3.desireamagwula.net/internal/codec"
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/todotxt"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// A todo.txt line without a +project goes in this category
+const todoTxtDefaultCategory = "inbox"
+
+// The Note priority for each todo.txt priority letter. Other letters are
+// kept as they are.
+var todoTxtPriorities = map[byte]string{'A': "high", 'B': "medium", 'C': "low"}
+
+// todoTxtEncoder streams Notes as the lines of a todo.txt file
+var todoTxtEncoder = codec.NewRecordEncoder("todotxt", "text/plain; charset=utf-8", func(w io.Writer) codec.RecordWriter {
+	return &todoTxtWriter{w: bufio.NewWriter(w)}
+})
+
+type todoTxtWriter struct {
+	w *bufio.Writer
+}
+
+func (tw *todoTxtWriter) Write(v interface{}) error {
+	Note, ok := v.(*data.Note)
+	if !ok {
+		return errors.New("todo.txt can only be written from whole Notes")
+	}
+	_, err := tw.w.WriteString(todoTxtLine(Note) + "\n")
+	return err
+}
+
+func (tw *todoTxtWriter) Flush() error {
+	return tw.w.Flush()
+}
+
+// The most statuses a Note may have, as ValidateNote() checks
+const maxNoteStatuses = 5
+
+// The longest description a Note may have, as ValidateNote() checks
+const maxNoteDescription = 200
+
+// noteFromTask() reads a Note from a todo.txt line. The words of the text
+// are the task name and the first +project is the category. The status is
+// done or todo, followed by the @contexts and any due: date while there is
+// room. The description is the text of the line, as todo.txt calls it, or
+// the task name when the text is too long. The line itself is kept, so that
+// exporting the Note unchanged gives it back.
+func noteFromTask(line string) *data.Note {
+	_, Note, _ := splitTask(line)
+	return Note
+}
+
+// splitTask() parses a todo.txt line into the task, the Note it imports as
+// and the words of the text the Note fields have no room for: further
+// +projects, the @contexts past the status limit and any other key:value
+// tags
+func splitTask(line string) (todotxt.Task, *data.Note, []string) {
+	t := todotxt.Parse(line)
+	Note := &data.Note{
+		Category:    todoTxtDefaultCategory,
+		Priority:    "none",
+		TodoTxtLine: line,
+	}
+	name := []string{}
+	extra := []string{}
+	project := ""
+	contexts := []string{}
+	due := ""
+	for _, word := range strings.Fields(t.Text) {
+		key, value, isTag := todoTxtTag(word)
+		switch {
+		case len(word) > 1 && word[0] == '+' && project == "":
+			project = word[1:]
+		case len(word) > 1 && word[0] == '@':
+			if !validator.In(word, contexts...) {
+				contexts = append(contexts, word)
+			}
+		case isTag && key == "due" && due == "":
+			due = word
+		case isTag && key == "pri" && t.Done && len(value) == 1:
+			// Completed tasks keep their priority in a pri: tag
+			t.Priority = value[0]
+		case isTag || (len(word) > 1 && word[0] == '+'):
+			extra = append(extra, word)
+		default:
+			name = append(name, word)
+		}
+	}
+	Note.Task_Name = strings.Join(name, " ")
+	Note.Description = strings.TrimSpace(t.Text)
+	if len(Note.Description) > maxNoteDescription {
+		Note.Description = Note.Task_Name
+	}
+	if project != "" {
+		Note.Category = project
+	}
+	if t.Priority != 0 {
+		Note.Priority = string(t.Priority)
+		if priority, ok := todoTxtPriorities[t.Priority]; ok {
+			Note.Priority = priority
+		}
+	}
+	Note.Status = []string{"todo"}
+	if t.Done {
+		Note.Status = []string{"done"}
+	}
+	room := maxNoteStatuses - len(Note.Status)
+	if due != "" {
+		room--
+	}
+	for i, context := range contexts {
+		if i < room {
+			Note.Status = append(Note.Status, context)
+		} else {
+			extra = append(extra, context)
+		}
+	}
+	if due != "" {
+		Note.Status = append(Note.Status, due)
+	}
+	return t, Note, extra
+}
+
+// todoTxtTag() splits a key:value tag, reporting whether the word is one
+// the way todotxt.Task.Value() reads them
+func todoTxtTag(word string) (string, string, bool) {
+	key, value, ok := strings.Cut(word, ":")
+	if !ok || key == "" || value == "" || strings.Contains(value, ":") || strings.HasPrefix(value, "//") {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// todoTxtLine() writes a Note as a todo.txt line. A Note imported from
+// todo.txt whose fields are still the ones its line imports as is written as
+// that line, word for word.
+func todoTxtLine(Note *data.Note) string {
+	if Note.TodoTxtLine != "" {
+		_, imported, _ := splitTask(Note.TodoTxtLine)
+		if Note.Task_Name == imported.Task_Name && Note.Description == imported.Description &&
+			Note.Category == imported.Category && Note.Priority == imported.Priority &&
+			strings.Join(Note.Status, "\n") == strings.Join(imported.Status, "\n") {
+			return Note.TodoTxtLine
+		}
+	}
+	return taskFromNote(Note).String()
+}
+
+// taskFromNote() builds a todo.txt line from the fields of a Note. The task
+// name is the text, followed by whatever the other fields hold that it
+// doesn't mention. A Note imported from todo.txt and edited since keeps the
+// dates of its line and the words the fields have no room for. The
+// description has no place in todo.txt.
+func taskFromNote(Note *data.Note) todotxt.Task {
+	t := todotxt.Task{Text: Note.Task_Name}
+	details := []string{}
+	if Note.TodoTxtLine != "" {
+		original, _, extra := splitTask(Note.TodoTxtLine)
+		t.Created, t.Completed = original.Created, original.Completed
+		details = extra
+	}
+	for _, status := range Note.Status {
+		if strings.EqualFold(status, "done") {
+			t.Done = true
+		}
+	}
+	if !t.Done {
+		t.Completed = ""
+	}
+	for letter, priority := range todoTxtPriorities {
+		if strings.EqualFold(Note.Priority, priority) {
+			t.Priority = letter
+		}
+	}
+	if len(Note.Priority) == 1 && Note.Priority[0] >= 'A' && Note.Priority[0] <= 'Z' {
+		t.Priority = Note.Priority[0]
+	}
+	extra := []string{}
+	project := strings.Join(strings.Fields(Note.Category), "-")
+	if project != "" && project != todoTxtDefaultCategory && !validator.In(project, t.Projects()...) {
+		extra = append(extra, "+"+project)
+	}
+	contexts := t.Contexts()
+	_, hasDue := t.Value("due")
+	for _, status := range Note.Status {
+		switch {
+		case strings.HasPrefix(status, "@") && len(status) > 1:
+			if !validator.In(status[1:], contexts...) {
+				extra = append(extra, status)
+			}
+		case strings.HasPrefix(status, "due:") && !hasDue:
+			extra = append(extra, status)
+		}
+	}
+	for _, word := range details {
+		if !validator.In(word, extra...) {
+			extra = append(extra, word)
+		}
+	}
+	if t.Done && t.Priority != 0 {
+		if _, ok := t.Value("pri"); !ok {
+			extra = append(extra, "pri:"+string(t.Priority))
+		}
+	}
+	if len(extra) > 0 {
+		t.Text = strings.TrimSpace(t.Text + " " + strings.Join(extra, " "))
+	}
+	return t
+}
+
+// readTodoTxtRows() reads the Notes from a todo.txt file for an import. Blank
+// lines are skipped, and invalid Notes are returned keyed by line number,
+// with their errors under the given keys.
+func readTodoTxtRows(file io.Reader, keys data.NoteKeys, v *validator.Validator) ([]importRow, map[string]map[string]string, error) {
+	scanner := bufio.NewScanner(file)
+	rows := []importRow{}
+	rowErrors := map[string]map[string]string{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if len(rows)+len(rowErrors) == maxImportRows {
+			v.AddError("file", "must not have more than "+strconv.Itoa(maxImportRows)+" tasks")
+			return nil, nil, nil
+		}
+		Note := noteFromTask(text)
+		rv := validator.New()
+		if data.ValidateNoteKeys(rv, Note, keys); !rv.Valid() {
+			rowErrors[strconv.Itoa(line)] = rv.Errors
+			continue
+		}
+		rows = append(rows, importRow{line: line, note: Note})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(rows)+len(rowErrors) == 0 {
+		v.AddError("file", "must have at least one task")
+	}
+	return rows, rowErrors, nil
+}
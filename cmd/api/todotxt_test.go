@@ -0,0 +1,135 @@
+// Filename: cmd/api/todotxt_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// roundTrip() imports each line of a todo.txt file as a Note and exports
+// the Notes again
+func roundTrip(t *testing.T, file string) string {
+	t.Helper()
+	var out strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(file, "\n"), "\n") {
+		Note := noteFromTask(line)
+		v := validator.New()
+		if data.ValidateNoteKeys(v, Note, data.FieldNoteKeys); !v.Valid() {
+			t.Errorf("%q: got errors %v for %+v", line, v.Errors, Note)
+		}
+		out.WriteString(todoTxtLine(Note) + "\n")
+	}
+	return out.String()
+}
+
+// Every line of testdata/todo.txt imports as a valid Note, and exporting the
+// Notes gives the file back byte for byte
+func TestTodoTxtRoundTrip(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "todo.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := roundTrip(t, string(input)); got != string(input) {
+		t.Errorf("exported\n%s\nwant\n%s", got, input)
+	}
+}
+
+func TestNoteFromTask(t *testing.T) {
+	line := "x 2024-01-02 2024-01-01 Call Mom +Family +Kids @phone @home due:2024-01-05 pri:A rec:1w"
+	Note := noteFromTask(line)
+	want := data.Note{
+		Task_Name:   "Call Mom",
+		Description: "Call Mom +Family +Kids @phone @home due:2024-01-05 pri:A rec:1w",
+		Category:    "Family",
+		Priority:    "high",
+		Status:      []string{"done", "@phone", "@home", "due:2024-01-05"},
+		TodoTxtLine: line,
+	}
+	if !reflect.DeepEqual(*Note, want) {
+		t.Errorf("got %+v, want %+v", *Note, want)
+	}
+
+	// Contexts past the status limit are only in the line
+	Note = noteFromTask("Tidy @a @b @c @d @e @f due:2024-01-01")
+	if want := []string{"todo", "@a", "@b", "@c", "due:2024-01-01"}; !reflect.DeepEqual(Note.Status, want) {
+		t.Errorf("got status %q, want %q", Note.Status, want)
+	}
+
+	// A text too long for the description leaves the task name there
+	Note = noteFromTask("Pack " + strings.Repeat("tag:value ", 25))
+	if Note.Description != "Pack" {
+		t.Errorf("got description %q", Note.Description)
+	}
+
+	// A line of tags alone has no task name
+	v := validator.New()
+	if data.ValidateNoteKeys(v, noteFromTask("+Home @phone"), data.FieldNoteKeys); v.Errors["task_name"] != "must be provided" {
+		t.Errorf("got errors %v", v.Errors)
+	}
+}
+
+// A Note edited since it was imported is written from its fields, keeping
+// the dates of its line and the words the fields had no room for
+func TestTodoTxtLineAfterEdit(t *testing.T) {
+	tests := []struct {
+		line string
+		edit func(Note *data.Note)
+		want string
+	}{
+		{
+			"(C) 2024-01-01 Renew passport +Admin +Travel @town due:2024-03-01 t:2024-02-01",
+			func(Note *data.Note) { Note.Priority = "high" },
+			"(A) 2024-01-01 Renew passport +Admin @town due:2024-03-01 +Travel t:2024-02-01",
+		},
+		// Without a completion date a done task can't have a creation date
+		{
+			"2024-01-01 Tidy @a @b @c @d @e @f due:2024-01-01",
+			func(Note *data.Note) { Note.Status[0] = "done" },
+			"x Tidy @a @b @c due:2024-01-01 @d @e @f",
+		},
+		{
+			"x 2024-01-04 2024-01-02 Plan the trip +Travel pri:B rec:1y",
+			func(Note *data.Note) { Note.Task_Name = "Plan the holiday" },
+			"x 2024-01-04 2024-01-02 Plan the holiday +Travel rec:1y pri:B",
+		},
+		{
+			"x 2024-01-04 2024-01-02 Plan the trip +Travel",
+			func(Note *data.Note) { Note.Status = []string{"todo"} },
+			"2024-01-02 Plan the trip +Travel",
+		},
+		// The description isn't written, but editing it still counts
+		{
+			"Read a book @home",
+			func(Note *data.Note) { Note.Description = "a long one" },
+			"Read a book @home",
+		},
+	}
+	for _, tt := range tests {
+		Note := noteFromTask(tt.line)
+		tt.edit(Note)
+		if got := todoTxtLine(Note); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// A Note that didn't come from todo.txt gets a line from its fields alone
+func TestTaskFromNote(t *testing.T) {
+	Note := &data.Note{
+		Task_Name:   "Buy milk",
+		Description: "from the shop on the corner",
+		Category:    "errands today",
+		Priority:    "medium",
+		Status:      []string{"done", "in progress", "@shop"},
+	}
+	if got, want := todoTxtLine(Note), "x Buy milk +errands-today @shop pri:B"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+// Filename: cmd/api/tokens.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// How often failed logins past the reset period are deleted
+const throttleSweepEvery = time.Hour
+
+// createAuthenticationTokenHandler for the "POST /v1/tokens/authentication" endpoint
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Validate the email and password
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, ok := app.authenticatePassword(w, r, input.Email, input.Password)
+	if !ok {
+		return
+	}
+	if app.sendTwoFactorChallenge(w, r, user) {
+		return
+	}
+	// Generate a new token with a 24-hour expiry time
+	token, err := app.models.Tokens.NewSession(user.ID, 24*time.Hour, r.UserAgent(), app.clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Return the authentication token to the client
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// authenticatePassword() checks an email and password while applying the
+// login throttles. It sends the error response itself and reports whether the
+// credentials were valid.
+func (app *application) authenticatePassword(w http.ResponseWriter, r *http.Request, email, password string) (*data.User, bool) {
+	accountKey := data.AccountThrottleKey(email)
+	ipKey := data.IPThrottleKey(app.clientIP(r))
+	// Count the attempt before looking at the password, and refuse to look
+	// at it while a lock is in force. The address goes first so that an
+	// address that is locked out doesn't add to the count of the account.
+	throttles := []struct {
+		key    string
+		policy data.ThrottlePolicy
+	}{
+		{ipKey, data.IPThrottle},
+		{accountKey, data.AccountThrottle},
+	}
+	for _, throttle := range throttles {
+		lockedUntil, err := app.models.Lockouts.Attempt(throttle.key, throttle.policy)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+		if !lockedUntil.IsZero() {
+			app.loginLockedResponse(w, r, lockedUntil)
+			return nil, false
+		}
+	}
+	// Get the user details based on the provided email
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	// Check if the password matches
+	match := false
+	if user != nil {
+		match, err = user.Password.Matches(password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+	}
+	// Unknown accounts are counted too so they can't be told apart
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return nil, false
+	}
+	// A successful login clears the account. The address only gets this
+	// attempt back, so that one known password doesn't reset the count for
+	// the ones being guessed.
+	err = app.models.Lockouts.Clear(accountKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	err = app.models.Lockouts.Forgive(ipKey, data.IPThrottle)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// sweepLoginThrottles() forgets the failed logins that are past the reset
+// period, most of which were counted for unknown accounts. It runs until the
+// program exits.
+func (app *application) sweepLoginThrottles() {
+	resetAfter := data.AccountThrottle.ResetAfter
+	if data.IPThrottle.ResetAfter > resetAfter {
+		resetAfter = data.IPThrottle.ResetAfter
+	}
+	ticker := time.NewTicker(throttleSweepEvery)
+	defer ticker.Stop()
+	for {
+		n, err := app.models.Lockouts.DeleteStale(resetAfter)
+		if err != nil {
+			app.logError(nil, err)
+		} else if n > 0 {
+			app.logger.Printf("deleted %d stale login throttles", n)
+		}
+		<-ticker.C
+	}
+}
+
+// sendTwoFactorChallenge() answers a login with a two-factor token if the
+// user has two-factor authentication enabled. The short lived token is traded
+// for a login at "POST /v1/tokens/two-factor". It reports whether a response
+// was sent.
+func (app *application) sendTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	totp, err := app.models.TOTP.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+	if totp == nil || !totp.Enabled {
+		return false
+	}
+	token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+	err = app.writeJSON(w, r, http.StatusAccepted, envelope{"two_factor_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+	return true
+}
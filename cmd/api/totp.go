@@ -0,0 +1,196 @@
+// Filename: cmd/api/totp.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/totp"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// The issuer shown in authenticator apps
+const totpIssuer = "Todo API"
+
+// enrollTOTPHandler for the "POST /v1/users/me/totp" endpoint. It returns a
+// new secret that only takes effect once a code is confirmed.
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.TOTP.Enroll(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			v := validator.New()
+			v.AddError("totp", "two-factor authentication is already enabled")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{"totp": map[string]string{
+		"secret": secret,
+		"uri":    totp.URI(totpIssuer, user.Email, secret),
+	}}
+	err = app.writeJSON(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTOTPHandler for the "POST /v1/users/me/totp/confirm" endpoint. The
+// first valid code enables two-factor authentication and returns the
+// recovery codes.
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	settings, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if settings.Enabled {
+		v.AddError("totp", "two-factor authentication is already enabled")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Recovery codes are created in the same transaction that enables 2FA
+	var codes []string
+	step, ok := totp.Validate(settings.Secret, input.Code, time.Now())
+	if ok && step > settings.LastUsedStep {
+		codes, err = app.models.TOTP.Enable(user.ID, step, 10)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if codes == nil {
+		v.AddError("code", "is invalid or has already been used")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTwoFactorTokenHandler for the "POST /v1/tokens/two-factor" endpoint.
+// It completes a login with a one-time or recovery code.
+func (app *application) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TwoFactorToken string `json:"two_factor_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		SessionCookie  bool   `json:"session_cookie"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.TwoFactorToken)
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeTwoFactor, input.TwoFactorToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	settings, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if settings.IsLocked() {
+		app.twoFactorLockedResponse(w, r)
+		return
+	}
+	var ok bool
+	if input.RecoveryCode != "" {
+		ok, err = app.models.TOTP.UseRecoveryCode(user.ID, input.RecoveryCode)
+		if err == nil && ok {
+			err = app.models.TOTP.ResetFailures(user.ID)
+		}
+	} else {
+		ok, err = app.checkTOTPCode(settings, input.Code)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		err = app.models.TOTP.RecordFailure(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	// The two-factor token has served its purpose
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Logins started at "POST /v1/sessions" finish with a cookie
+	if input.SessionCookie && app.config.session.cookies {
+		app.startBrowserSession(w, r, user)
+		return
+	}
+	token, err := app.models.Tokens.NewSession(user.ID, 24*time.Hour, r.UserAgent(), app.clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkTOTPCode() validates a code and marks its time step as used. A code
+// from a step that was already used is rejected.
+func (app *application) checkTOTPCode(settings *data.TOTP, code string) (bool, error) {
+	step, ok := totp.Validate(settings.Secret, code, time.Now())
+	if !ok || step <= settings.LastUsedStep {
+		return false, nil
+	}
+	return app.models.TOTP.UseStep(settings.UserID, step)
+}
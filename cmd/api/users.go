@@ -0,0 +1,64 @@
+// Filename: cmd/api/users.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// registerUserHandler for the "POST /v1/users" endpoint
+func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Hold the data from the request body
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Copy the data to a new user struct
+	user := &data.User{
+		Name:  input.Name,
+		Email: input.Email,
+	}
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Perform validation
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Insert the user in the database. Every user gets a personal workspace
+	// for the /v1/Notes routes, created along with them.
+	workspace := &data.Workspace{
+		Name:     user.Name,
+		Personal: true,
+	}
+	err = app.models.Users.InsertWithWorkspace(user, workspace)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Write a 201 Created status
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
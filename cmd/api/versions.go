@@ -0,0 +1,100 @@
+// Filename: cmd/api/versions.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"quiz3.desireamagwula.net/internal/codec"
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// The versions of the API. Version 2 serves the same routes as version 1,
+// under /v2, with consistent names in its bodies.
+const (
+	apiV1 = 1
+	apiV2 = 2
+)
+
+// v2Paths renames the keys of version 1 responses for version 2: those of
+// the envelopes and of the Notes in them. Everything else, such as error
+// maps and embedded resources, keeps its keys.
+var v2Paths = map[string]string{
+	"Note":                      "note",
+	"Note/desription":           "description",
+	"Notes":                     "notes",
+	"Notes/*/desription":        "description",
+	"metadata ":                 "metadata",
+	"results/*/Note":            "note",
+	"results/*/Note/desription": "description",
+	// The records of exports are Notes
+	"desription": "description",
+}
+
+// apiVersion() works out which version of the API a request is for. Version
+// 2 requests are handed on with their version 1 path, so that one router
+// serves both, and version 1 responses announce that it is deprecated.
+func (app *application) apiVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2" || strings.HasPrefix(r.URL.Path, "/v2/"):
+			r = app.contextSetVersion(r, apiV2)
+			u := *r.URL
+			u.Path = "/v1" + strings.TrimPrefix(u.Path, "/v2")
+			if u.RawPath != "" {
+				u.RawPath = "/v1" + strings.TrimPrefix(u.RawPath, "/v2")
+			}
+			r.URL = &u
+		case r.URL.Path == "/v1" || strings.HasPrefix(r.URL.Path, "/v1/"):
+			r = app.contextSetVersion(r, apiV1)
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", app.config.v1.deprecation.Unix()))
+			w.Header().Set("Sunset", app.config.v1.sunset.UTC().Format(http.TimeFormat))
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, "/v2"+strings.TrimPrefix(r.URL.EscapedPath(), "/v1")))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// versionedPath() gives a version 1 path in the version of the request, for
+// Location headers and links
+func (app *application) versionedPath(r *http.Request, path string) string {
+	if app.contextGetVersion(r) == apiV2 && strings.HasPrefix(path, "/v1/") {
+		return "/v2" + strings.TrimPrefix(path, "/v1")
+	}
+	return path
+}
+
+// versionedValue() renames the keys of a response body for the version of
+// the request
+func (app *application) versionedValue(r *http.Request, v interface{}) (interface{}, error) {
+	if app.contextGetVersion(r) != apiV2 {
+		return v, nil
+	}
+	return codec.RenamePaths(v, v2Paths)
+}
+
+// noteKeys() returns the keys Note validation errors are reported under.
+// Version 1 keeps the keys it has always used.
+func (app *application) noteKeys(r *http.Request) data.NoteKeys {
+	if app.contextGetVersion(r) == apiV2 {
+		return data.FieldNoteKeys
+	}
+	return data.LegacyNoteKeys
+}
+
+// validateNote() validates a Note, reporting errors under the keys of the
+// version of the request
+func (app *application) validateNote(r *http.Request, v *validator.Validator, Note *data.Note) {
+	data.ValidateNoteKeys(v, Note, app.noteKeys(r))
+}
+
+// notesKey() is the name of the list of Notes in bulk request bodies
+func (app *application) notesKey(r *http.Request) string {
+	if app.contextGetVersion(r) == apiV2 {
+		return "notes"
+	}
+	return "Notes"
+}
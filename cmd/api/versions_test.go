@@ -0,0 +1,85 @@
+// Filename: cmd/api/versions_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"quiz3.desireamagwula.net/internal/data"
+)
+
+// Version 2 renames the envelope and Note keys it names differently, and
+// leaves the keys of everything else alone
+func TestVersionedValue(t *testing.T) {
+	app := newTestApplication(t)
+	r := app.contextSetVersion(httptest.NewRequest(http.MethodGet, "/v1/Notes", nil), apiV2)
+	note := &data.Note{ID: 1, Description: "d", Status: []string{}}
+	env := envelope{
+		"Notes":     []interface{}{note, map[string]interface{}{"desription": "d", "comments": []map[string]string{{"Note": "kept"}}}},
+		"metadata ": data.Metadata{},
+		"results":   []bulkResult{{Note: note}, {Error: map[string]string{"desription": "kept", "Notes": "kept"}}},
+		"error":     map[string]string{"Notes": "kept", "metadata ": "kept"},
+	}
+	value, err := app.versionedValue(r, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, _ := json.Marshal(value)
+	var got map[string]interface{}
+	json.Unmarshal(js, &got)
+
+	notes := got["notes"].([]interface{})
+	for i, n := range notes {
+		if n.(map[string]interface{})["description"] != "d" {
+			t.Errorf("Note %d: got %v", i, n)
+		}
+	}
+	if comment := notes[1].(map[string]interface{})["comments"].([]interface{})[0].(map[string]interface{}); comment["Note"] != "kept" {
+		t.Errorf("got comment %v", comment)
+	}
+	if _, ok := got["metadata"]; !ok {
+		t.Errorf("got %v, want metadata", got)
+	}
+	results := got["results"].([]interface{})
+	if results[0].(map[string]interface{})["note"].(map[string]interface{})["description"] != "d" {
+		t.Errorf("got result %v", results[0])
+	}
+	if fmt.Sprint(results[1].(map[string]interface{})["error"]) != "map[Notes:kept desription:kept]" {
+		t.Errorf("got result %v", results[1])
+	}
+	if fmt.Sprint(got["error"]) != "map[Notes:kept metadata :kept]" {
+		t.Errorf("got error %v", got["error"])
+	}
+}
+
+// The items of a bulk request are under the key of the version, exactly
+func TestBulkItemsKey(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	item := `[{"task_name":"a","description":"b","category":"c","priority":"low","status":["todo"]}]`
+	tests := []struct {
+		target, key string
+		status      int
+	}{
+		{"/v1/Notes/bulk", "Notes", http.StatusCreated},
+		{"/v1/Notes/bulk", "notes", http.StatusBadRequest},
+		{"/v2/Notes/bulk", "notes", http.StatusCreated},
+		{"/v2/Notes/bulk", "Notes", http.StatusBadRequest},
+		{"/v2/Notes/bulk", "NOTES", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := app.do(t, http.MethodPost, tt.target, alice.token, fmt.Sprintf(`{%q:%s}`, tt.key, item))
+		if w.Code != tt.status {
+			t.Errorf("%s with %q: got status %d, want %d; body: %s", tt.target, tt.key, w.Code, tt.status, w.Body.String())
+		}
+	}
+	w := app.do(t, http.MethodPost, "/v2/Notes/bulk", alice.token, `{}`)
+	wantStatus(t, w, http.StatusUnprocessableEntity)
+	if errs := decodeBody(t, w)["error"].(map[string]interface{}); errs["notes"] != "must contain at least one entry" {
+		t.Errorf("got errors %v", errs)
+	}
+}
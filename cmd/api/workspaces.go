@@ -0,0 +1,167 @@
+// Filename: cmd/api/workspaces.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// createWorkspaceHandler for the "POST /v1/workspaces" endpoint
+func (app *application) createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	workspace := &data.Workspace{
+		Name: input.Name,
+	}
+	v := validator.New()
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// The creator becomes the owner of the workspace
+	user := app.contextGetUser(r)
+	err = app.models.Workspaces.Insert(workspace, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", app.versionedPath(r, fmt.Sprintf("/v1/workspaces/%d", workspace.ID)))
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"workspace": workspace}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWorkspacesHandler for the "GET /v1/workspaces" endpoint
+func (app *application) listWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	workspaces, err := app.models.Workspaces.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"workspaces": workspaces}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWorkspaceHandler for the "GET /v1/workspaces/:wid" endpoint
+func (app *application) showWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	// The membership middleware has already loaded the workspace
+	workspace := app.contextGetWorkspace(r)
+	err := app.writeJSON(w, r, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWorkspaceMembersHandler for the "GET /v1/workspaces/:wid/members" endpoint
+func (app *application) listWorkspaceMembersHandler(w http.ResponseWriter, r *http.Request) {
+	workspace := app.contextGetWorkspace(r)
+	members, err := app.models.Workspaces.GetMembers(workspace.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addWorkspaceMemberHandler for the "POST /v1/workspaces/:wid/members" endpoint
+func (app *application) addWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidateRole(v, input.Role)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only owners may hand out the admin role
+	workspace := app.contextGetWorkspace(r)
+	if input.Role == data.RoleAdmin && workspace.Role != data.RoleOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	// Look up the user being added
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	member := &data.Member{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Role:        input.Role,
+	}
+	err = app.models.Workspaces.AddMember(member)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateMember):
+			v.AddError("email", "this user is already a member of the workspace")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeWorkspaceMemberHandler for the "DELETE /v1/workspaces/:wid/members/:id" endpoint
+func (app *application) removeWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	workspace := app.contextGetWorkspace(r)
+	err = app.models.Workspaces.RemoveMember(workspace.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Filename: cmd/api/workspaces_test.go
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"quiz3.desireamagwula.net/internal/data"
+	"quiz3.desireamagwula.net/internal/testdb"
+)
+
+// Notes are only reachable through the workspace they belong to. IDs from
+// another workspace are reported as not found, so that their existence
+// isn't leaked.
+func TestNotesAreScopedToTheirWorkspace(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	bob := app.newTestUser(t, "Bob")
+	note := app.newTestNote(t, alice, alice.workspace.ID, "alice's note")
+
+	shared := &data.Workspace{Name: "Shared"}
+	if err := app.models.Workspaces.Insert(shared, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	sharedNote := app.newTestNote(t, alice, shared.ID, "shared note")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"owner reads own note", http.MethodGet, fmt.Sprintf("/v1/Notes/%d", note.ID), alice.token, "", http.StatusOK},
+		{"other user reads it", http.MethodGet, fmt.Sprintf("/v1/Notes/%d", note.ID), bob.token, "", http.StatusNotFound},
+		{"other user updates it", http.MethodPatch, fmt.Sprintf("/v1/Notes/%d", note.ID), bob.token, `{"priority":"high"}`, http.StatusNotFound},
+		{"other user deletes it", http.MethodDelete, fmt.Sprintf("/v1/Notes/%d", note.ID), bob.token, "", http.StatusNotFound},
+		{"through own workspace", http.MethodGet, fmt.Sprintf("/v1/workspaces/%d/Notes/%d", bob.workspace.ID, note.ID), bob.token, "", http.StatusNotFound},
+		{"through the owner's workspace", http.MethodGet, fmt.Sprintf("/v1/workspaces/%d/Notes/%d", alice.workspace.ID, note.ID), bob.token, "", http.StatusNotFound},
+		{"shared note through personal routes", http.MethodGet, fmt.Sprintf("/v1/Notes/%d", sharedNote.ID), alice.token, "", http.StatusNotFound},
+		{"shared note through another workspace", http.MethodGet, fmt.Sprintf("/v1/workspaces/%d/Notes/%d", alice.workspace.ID, sharedNote.ID), alice.token, "", http.StatusNotFound},
+		{"shared note through its workspace", http.MethodGet, fmt.Sprintf("/v1/workspaces/%d/Notes/%d", shared.ID, sharedNote.ID), alice.token, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := app.do(t, tt.method, tt.path, tt.token, tt.body)
+			wantStatus(t, w, tt.status)
+		})
+	}
+
+	// The Note is untouched by the requests that were refused
+	got, err := app.models.Notes.Get(data.Tenant{UserID: alice.ID, WorkspaceID: alice.workspace.ID}, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Priority != note.Priority || got.Version != note.Version {
+		t.Errorf("got %+v, want the Note unchanged", got)
+	}
+}
+
+// Listings only contain the Notes of the workspace asked for
+func TestListingsAreScopedToTheirWorkspace(t *testing.T) {
+	app := newTestDBApplication(t)
+	alice := app.newTestUser(t, "Alice")
+	bob := app.newTestUser(t, "Bob")
+	app.newTestNote(t, alice, alice.workspace.ID, "first")
+	app.newTestNote(t, alice, alice.workspace.ID, "second")
+	app.newTestNote(t, bob, bob.workspace.ID, "third")
+
+	for _, tc := range []struct {
+		user *testUser
+		want int
+	}{{alice, 2}, {bob, 1}} {
+		w := app.do(t, http.MethodGet, "/v1/Notes", tc.user.token, "")
+		wantStatus(t, w, http.StatusOK)
+		notes, _ := decodeBody(t, w)["Notes"].([]interface{})
+		if len(notes) != tc.want {
+			t.Errorf("%s got %d Notes, want %d", tc.user.Name, len(notes), tc.want)
+		}
+	}
+	// Bob can't list a workspace he isn't a member of
+	w := app.do(t, http.MethodGet, fmt.Sprintf("/v1/workspaces/%d/Notes", alice.workspace.ID), bob.token, "")
+	wantStatus(t, w, http.StatusNotFound)
+}
+
+// Registering gives the user a personal workspace for the /v1/Notes routes
+func TestRegisterCreatesPersonalWorkspace(t *testing.T) {
+	app := newTestDBApplication(t)
+	w := app.do(t, http.MethodPost, "/v1/users", "", `{"name":"Carol","email":"carol@example.com","password":"pa55word1234"}`)
+	wantStatus(t, w, http.StatusCreated)
+	user, err := app.models.Users.GetByEmail("carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspace, err := app.models.Workspaces.GetPersonal(user.ID)
+	if err != nil {
+		t.Fatalf("no personal workspace: %v", err)
+	}
+	if workspace.Role != data.RoleOwner {
+		t.Errorf("got role %q, want owner", workspace.Role)
+	}
+	// A second registration with the same email creates nothing
+	w = app.do(t, http.MethodPost, "/v1/users", "", `{"name":"Carol","email":"carol@example.com","password":"pa55word1234"}`)
+	wantStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+// Notes from a database that predates users end up in the Default workspace,
+// which the first account to register takes over
+func TestBaselineNotesAfterUpgrade(t *testing.T) {
+	app := newTestApplication(t)
+	db := testdb.OpenSeeded(t, "000003", func(db *sql.DB) {
+		_, err := db.Exec(`
+			INSERT INTO notes (task_name, description, category, priority, status)
+			VALUES ('old one', 'from the baseline', 'home', 'low', '{todo}'),
+			       ('old two', 'from the baseline', 'work', 'high', '{done}')
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	app.models = data.NewModels(db)
+	carol := app.newTestUser(t, "Carol")
+	dave := app.newTestUser(t, "Dave")
+
+	defaultWorkspace := func(user *testUser) map[string]interface{} {
+		w := app.do(t, http.MethodGet, "/v1/workspaces", user.token, "")
+		wantStatus(t, w, http.StatusOK)
+		for _, workspace := range decodeBody(t, w)["workspaces"].([]interface{}) {
+			workspace := workspace.(map[string]interface{})
+			if workspace["name"] == "Default" {
+				return workspace
+			}
+		}
+		return nil
+	}
+	workspace := defaultWorkspace(carol)
+	if workspace == nil || workspace["role"] != data.RoleOwner {
+		t.Fatalf("got Default workspace %v, want Carol as its owner", workspace)
+	}
+	if other := defaultWorkspace(dave); other != nil {
+		t.Errorf("Dave also got the Default workspace: %v", other)
+	}
+
+	w := app.do(t, http.MethodGet, fmt.Sprintf("/v1/workspaces/%v/Notes?sort=id", workspace["id"]), carol.token, "")
+	wantStatus(t, w, http.StatusOK)
+	notes := decodeBody(t, w)["Notes"].([]interface{})
+	if len(notes) != 2 || notes[0].(map[string]interface{})["task_name"] != "old one" {
+		t.Errorf("got Notes %v, want the two from the baseline", notes)
+	}
+}
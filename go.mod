@@ -1,8 +1,9 @@
 module quiz3.desireamagwula.net
 
-go 1.19
+go 1.20
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.2
+	golang.org/x/crypto v0.9.0
 )
@@ -0,0 +1,238 @@
+// Filename: internal/codec/codec.go
+
+// Package codec encodes API responses in the formats clients can ask for
+// with the Accept header: JSON, CSV, NDJSON, YAML and MessagePack.
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotAcceptable means none of the formats the client accepts is supported
+var ErrNotAcceptable = errors.New("not acceptable")
+
+// An Encoder writes a value in one format
+type Encoder struct {
+	// The short name used with ?format=
+	Name string
+	// The media type sent in the Content-Type header
+	ContentType string
+	// Other media types that select the encoder
+	Aliases []string
+	Encode  func(w io.Writer, v interface{}) error
+	// Formats with a row per record can also be written a record at a time
+	newRecordWriter func(w io.Writer) RecordWriter
+}
+
+// A RecordWriter writes records one at a time, for responses streamed as
+// they are read
+type RecordWriter interface {
+	Write(v interface{}) error
+	// Flush() writes out anything buffered
+	Flush() error
+}
+
+// NewRecordWriter() returns a writer of records in the encoder's format
+func (e *Encoder) NewRecordWriter(w io.Writer) (RecordWriter, error) {
+	if e.newRecordWriter == nil {
+		return nil, ErrNotAcceptable
+	}
+	return e.newRecordWriter(w), nil
+}
+
+// Streamable() reports whether records can be written one at a time
+func (e *Encoder) Streamable() bool {
+	return e.newRecordWriter != nil
+}
+
+// NewRecordEncoder() returns an encoder for a format that can only be written
+// a record at a time, such as one specific to a single resource. It can't
+// encode whole responses, so it is never part of the registry.
+func NewRecordEncoder(name, contentType string, newRecordWriter func(w io.Writer) RecordWriter) *Encoder {
+	return &Encoder{
+		Name:        name,
+		ContentType: contentType,
+		Encode: func(w io.Writer, v interface{}) error {
+			return ErrNotAcceptable
+		},
+		newRecordWriter: newRecordWriter,
+	}
+}
+
+// ProblemJSON is the media type of RFC 9457 problem details. Clients that
+// accept it get their errors in that format, and JSON otherwise.
+const ProblemJSON = "application/problem+json"
+
+// Encoders is the registry of formats, in order of preference
+var Encoders = []*Encoder{
+	{Name: "json", ContentType: "application/json", Aliases: []string{ProblemJSON}, Encode: encodeJSON},
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Encode: encodeCSV, newRecordWriter: newCSVWriter},
+	{Name: "ndjson", ContentType: "application/x-ndjson", Encode: encodeNDJSON, newRecordWriter: newNDJSONWriter},
+	{Name: "yaml", ContentType: "application/yaml", Aliases: []string{"application/x-yaml", "text/yaml"}, Encode: encodeYAML},
+	{Name: "msgpack", ContentType: "application/msgpack", Aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, Encode: encodeMsgPack},
+}
+
+// JSON is the encoder used when the client has no preference
+var JSON = Encoders[0]
+
+// ByName() returns the encoder for a ?format= value from a list of encoders
+func ByName(name string, encoders []*Encoder) (*Encoder, error) {
+	for _, e := range encoders {
+		if strings.EqualFold(e.Name, name) {
+			return e, nil
+		}
+	}
+	return nil, ErrNotAcceptable
+}
+
+// mediaType() returns the media type of the encoder without parameters
+func (e *Encoder) mediaType() string {
+	t, _, _ := mime.ParseMediaType(e.ContentType)
+	return t
+}
+
+// matches() reports whether a media range from an Accept header selects the
+// encoder and how specific the match is
+func (e *Encoder) matches(mediaRange string) (bool, int) {
+	mediaType := e.mediaType()
+	switch {
+	case mediaRange == "*/*":
+		return true, 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")), 1
+	case mediaRange == mediaType:
+		return true, 2
+	}
+	for _, alias := range e.Aliases {
+		if mediaRange == alias {
+			return true, 2
+		}
+	}
+	return false, 0
+}
+
+type acceptRange struct {
+	mediaRange string
+	q          float64
+}
+
+// parseAccept() reads the media ranges of an Accept header, skipping any
+// that are malformed
+func parseAccept(accept string) []acceptRange {
+	ranges := []acceptRange{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaRange: mediaRange, q: q})
+	}
+	return ranges
+}
+
+// Accepts() reports whether an Accept header names a media type itself, with
+// a quality above zero. Wildcards don't count.
+func Accepts(accept, mediaType string) bool {
+	for _, r := range parseAccept(accept) {
+		if r.mediaRange == mediaType && r.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate() picks an encoder from a list for an Accept header. The quality
+// values of the most specific matching range count, and ties go to the order
+// of the list. An empty header accepts the first encoder.
+func Negotiate(accept string, encoders []*Encoder) (*Encoder, error) {
+	if strings.TrimSpace(accept) == "" {
+		return encoders[0], nil
+	}
+	ranges := parseAccept(accept)
+	type candidate struct {
+		encoder *Encoder
+		q       float64
+		order   int
+	}
+	candidates := []candidate{}
+	for i, e := range encoders {
+		best, q := -1, 0.0
+		for _, r := range ranges {
+			if ok, specificity := e.matches(r.mediaRange); ok && specificity > best {
+				best, q = specificity, r.q
+			}
+		}
+		if best >= 0 && q > 0 {
+			candidates = append(candidates, candidate{encoder: e, q: q, order: i})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNotAcceptable
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].encoder, nil
+}
+
+// encodeJSON() writes indented JSON, as the API always has
+func encodeJSON(w io.Writer, v interface{}) error {
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+	_, err = w.Write(js)
+	return err
+}
+
+// encodeNDJSON() writes one JSON value per line for each record
+func encodeNDJSON(w io.Writer, v interface{}) error {
+	value, err := toValue(v)
+	if err != nil {
+		return err
+	}
+	rw := newNDJSONWriter(w)
+	for _, record := range records(value) {
+		err = rw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	return rw.Flush()
+}
+
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func newNDJSONWriter(w io.Writer) RecordWriter {
+	return &ndjsonWriter{w: w}
+}
+
+func (nw *ndjsonWriter) Write(v interface{}) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+	_, err = nw.w.Write(js)
+	return err
+}
+
+func (nw *ndjsonWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,274 @@
+// Filename: internal/codec/codec_test.go
+
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// A listing as the API writes it, with the members in order
+var testListing = json.RawMessage(`{
+	"Notes": [
+		{"id": 1, "task_name": "Buy milk", "owner": {"name": "Alice"}, "status": ["todo"], "due": null},
+		{"id": 2, "task_name": "Say \"hi\", twice", "owner": {"name": "Bob"}, "status": [], "due": "2024-01-01"}
+	],
+	"metadata ": {"current_page": 1}
+}`)
+
+// encode() runs an encoder over a value written as JSON
+func encode(t *testing.T, name string, v json.RawMessage) string {
+	t.Helper()
+	e, err := ByName(name, Encoders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := e.Encode(&b, v); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestEncodeCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want string
+	}{
+		{"listing", string(testListing), "" +
+			"id,task_name,owner.name,status,due\n" +
+			`1,Buy milk,Alice,"[""todo""]",` + "\n" +
+			`2,"Say ""hi"", twice",Bob,[],2024-01-01` + "\n"},
+		// A single Note is one row
+		{"single", `{"Note": {"id": 3, "done": true}}`, "id,done\n3,true\n"},
+		// Columns first seen in a later record are added to the header
+		{"ragged", `{"Notes": [{"a": 1}, {"b": 2}]}`, "a,b\n1,\n,2\n"},
+		{"scalar", `"text"`, "value\ntext\n"},
+		{"empty", `{"Notes": []}`, ""},
+	}
+	for _, tt := range tests {
+		if got := encode(t, "csv", json.RawMessage(tt.v)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCSVRecordWriter(t *testing.T) {
+	var b bytes.Buffer
+	rw, err := Encoders[1].NewRecordWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []string{`{"id": 1, "tags": {"a": "x"}}`, `{"id": 2, "tags": {"a": "y"}, "extra": 1}`} {
+		if err := rw.Write(json.RawMessage(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// The columns come from the first record
+	if want := "id,tags.a\n1,x\n2,y\n"; b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestEncodeNDJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want string
+	}{
+		{"listing", string(testListing), "" +
+			`{"id":1,"task_name":"Buy milk","owner":{"name":"Alice"},"status":["todo"],"due":null}` + "\n" +
+			`{"id":2,"task_name":"Say \"hi\", twice","owner":{"name":"Bob"},"status":[],"due":"2024-01-01"}` + "\n"},
+		{"single", `{"Note": {"id": 3}}`, `{"id":3}` + "\n"},
+		// Without a single array or object the whole response is the record
+		{"several members", `{"a": 1, "b": {"c": 2}}`, `{"a":1,"b":{"c":2}}` + "\n"},
+		{"empty", `{"Notes": []}`, ""},
+	}
+	for _, tt := range tests {
+		if got := encode(t, "ndjson", json.RawMessage(tt.v)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	var b bytes.Buffer
+	rw, err := Encoders[2].NewRecordWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []interface{}{map[string]int{"id": 1}, "two", nil} {
+		if err := rw.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"id\":1}\n\"two\"\nnull\n"; b.String() != want {
+		t.Errorf("record writer: got %q, want %q", b.String(), want)
+	}
+}
+
+func TestEncodeYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want string
+	}{
+		{"listing", string(testListing), `---
+Notes:
+  -
+    id: 1
+    task_name: "Buy milk"
+    owner:
+      name: "Alice"
+    status:
+      - "todo"
+    due: null
+  -
+    id: 2
+    task_name: "Say \"hi\", twice"
+    owner:
+      name: "Bob"
+    status: []
+    due: "2024-01-01"
+"metadata ":
+  current_page: 1
+`},
+		// Keys YAML would read as something other than a string are quoted
+		{"keys", `{"true": 1, "No": 2, "~": 3, "a b": 4, "1st": 5, "a.b-c_d": 6, "": 7}`, `---
+"true": 1
+"No": 2
+"~": 3
+"a b": 4
+"1st": 5
+a.b-c_d: 6
+"": 7
+`},
+		{"scalars", `{"s": "line\nnext: é", "f": 1.5, "b": false, "o": {}, "m": [[1, 2], []]}`, `---
+s: "line\nnext: é"
+f: 1.5
+b: false
+o: {}
+m:
+  -
+    - 1
+    - 2
+  - []
+`},
+		{"top-level scalar", `"text"`, "---\n\"text\"\n"},
+		{"top-level empty array", `[]`, "---\n[]\n"},
+	}
+	for _, tt := range tests {
+		if got := encode(t, "yaml", json.RawMessage(tt.v)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeMsgPack(t *testing.T) {
+	tests := []struct {
+		v    string
+		want string
+	}{
+		{`null`, "c0"},
+		{`true`, "c3"},
+		{`false`, "c2"},
+		// Integers in their shortest form
+		{`0`, "00"},
+		{`127`, "7f"},
+		{`128`, "cc80"},
+		{`256`, "cd0100"},
+		{`65536`, "ce00010000"},
+		{`4294967296`, "cf0000000100000000"},
+		{`-1`, "ff"},
+		{`-32`, "e0"},
+		{`-33`, "d0df"},
+		{`-129`, "d1ff7f"},
+		{`-32769`, "d2ffff7fff"},
+		{`-2147483649`, "d3ffffffff7fffffff"},
+		// Other numbers as 64-bit floats
+		{`1.5`, "cb3ff8000000000000"},
+		{`1e300`, "cb7e37e43c8800759c"},
+		{`""`, "a0"},
+		{`"abc"`, "a3616263"},
+		{`"` + strings.Repeat("a", 32) + `"`, "d920" + strings.Repeat("61", 32)},
+		{`"` + strings.Repeat("a", 256) + `"`, "da0100" + strings.Repeat("61", 256)},
+		{`[]`, "90"},
+		{`[1, [true]]`, "920191c3"},
+		{`[` + strings.Repeat("0,", 15) + `0]`, "dc0010" + strings.Repeat("00", 16)},
+		{`{}`, "80"},
+		// Members keep their order
+		{`{"b": 1, "a": null}`, "82a16201a161c0"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString([]byte(encode(t, "msgpack", json.RawMessage(tt.v)))); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "json"},
+		{"*/*", "json"},
+		{"text/csv", "csv"},
+		{"text/*", "csv"},
+		{"application/x-yaml", "yaml"},
+		{"application/vnd.msgpack", "msgpack"},
+		{"application/problem+json", "json"},
+		// The highest quality wins, then the order of the registry
+		{"application/json;q=0.5, application/x-ndjson", "ndjson"},
+		{"application/yaml, text/csv", "csv"},
+		// The most specific range decides the quality of an encoder
+		{"*/*;q=0.9, application/json;q=0", "csv"},
+		{"application/*;q=0.1, application/msgpack", "msgpack"},
+		// Malformed ranges are skipped
+		{"text/csv;q=2, application/yaml", "yaml"},
+		{"nonsense, text/csv", "csv"},
+	}
+	for _, tt := range tests {
+		e, err := Negotiate(tt.accept, Encoders)
+		if err != nil {
+			t.Errorf("%q: %v", tt.accept, err)
+			continue
+		}
+		if e.Name != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.accept, e.Name, tt.want)
+		}
+	}
+
+	for _, accept := range []string{"text/html", "application/json;q=0", "*/*;q=0", "nonsense"} {
+		if e, err := Negotiate(accept, Encoders); err != ErrNotAcceptable {
+			t.Errorf("%q: got %v, %v, want ErrNotAcceptable", accept, e, err)
+		}
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"application/problem+json", true},
+		{"application/json, application/problem+json;q=0.1", true},
+		{"application/problem+json;q=0", false},
+		{"*/*", false},
+		{"application/*", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Accepts(tt.accept, ProblemJSON); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
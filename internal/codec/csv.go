@@ -0,0 +1,134 @@
+// Filename: internal/codec/csv.go
+
+package codec
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// encodeCSV() writes the records as CSV with a header row. Nested objects
+// are flattened into dotted column names and arrays are written as JSON.
+func encodeCSV(w io.Writer, v interface{}) error {
+	value, err := toValue(v)
+	if err != nil {
+		return err
+	}
+	rows := []map[string]string{}
+	columns := []string{}
+	seen := map[string]bool{}
+	for _, record := range records(value) {
+		row := map[string]string{}
+		err := flatten("", record, row, func(column string) {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	cw := csv.NewWriter(w)
+	if len(columns) > 0 {
+		err = cw.Write(columns)
+		if err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		err = cw.Write(line(columns, row))
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// line() puts the cells of a row in column order
+func line(columns []string, row map[string]string) []string {
+	cells := make([]string, len(columns))
+	for i, column := range columns {
+		cells[i] = row[column]
+	}
+	return cells
+}
+
+// csvWriter streams records as CSV. The columns are taken from the first
+// record, so records are expected to share their shape.
+type csvWriter struct {
+	cw      *csv.Writer
+	columns []string
+}
+
+func newCSVWriter(w io.Writer) RecordWriter {
+	return &csvWriter{cw: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(v interface{}) error {
+	value, err := toValue(v)
+	if err != nil {
+		return err
+	}
+	row := map[string]string{}
+	first := c.columns == nil
+	err = flatten("", value, row, func(column string) {
+		if first {
+			c.columns = append(c.columns, column)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if first {
+		err = c.cw.Write(c.columns)
+		if err != nil {
+			return err
+		}
+	}
+	return c.cw.Write(line(c.columns, row))
+}
+
+func (c *csvWriter) Flush() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+// flatten() writes the cells of a value into a row, calling column for each
+// column in the order they are found
+func flatten(prefix string, v interface{}, row map[string]string, column func(string)) error {
+	name := prefix
+	if name == "" {
+		name = "value"
+	}
+	switch v := v.(type) {
+	case Object:
+		for _, member := range v {
+			key := member.Key
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			err := flatten(key, member.Value, row, column)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		js, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		row[name] = string(js)
+	case nil:
+		row[name] = ""
+	default:
+		row[name] = fmt.Sprint(v)
+	}
+	column(name)
+	return nil
+}
@@ -0,0 +1,145 @@
+// Filename: internal/codec/msgpack.go
+
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// encodeMsgPack() writes a value in the MessagePack format. Numbers that fit
+// in an int64 are written as integers and the rest as 64-bit floats.
+func encodeMsgPack(w io.Writer, v interface{}) error {
+	value, err := toValue(v)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	err = writeMsgPack(bw, value)
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeMsgPack(w *bufio.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.WriteByte(0xc0)
+	case bool:
+		if v {
+			w.WriteByte(0xc3)
+		} else {
+			w.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeMsgPackInt(w, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		w.WriteByte(0xcb)
+		writeUint(w, math.Float64bits(f), 8)
+	case string:
+		n := len(v)
+		switch {
+		case n < 32:
+			w.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			w.WriteByte(0xd9)
+			w.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			w.WriteByte(0xda)
+			writeUint(w, uint64(n), 2)
+		default:
+			w.WriteByte(0xdb)
+			writeUint(w, uint64(n), 4)
+		}
+		w.WriteString(v)
+	case []interface{}:
+		writeMsgPackHeader(w, len(v), 0x90, 0xdc, 0xdd)
+		for _, element := range v {
+			err := writeMsgPack(w, element)
+			if err != nil {
+				return err
+			}
+		}
+	case Object:
+		writeMsgPackHeader(w, len(v), 0x80, 0xde, 0xdf)
+		for _, member := range v {
+			err := writeMsgPack(w, member.Key)
+			if err != nil {
+				return err
+			}
+			err = writeMsgPack(w, member.Value)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("codec: cannot encode %T as MessagePack", v)
+	}
+	return nil
+}
+
+// writeMsgPackHeader() writes the length of an array or map
+func writeMsgPackHeader(w *bufio.Writer, n int, fix, header16, header32 byte) {
+	switch {
+	case n < 16:
+		w.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(header16)
+		writeUint(w, uint64(n), 2)
+	default:
+		w.WriteByte(header32)
+		writeUint(w, uint64(n), 4)
+	}
+}
+
+// writeMsgPackInt() writes an integer in its shortest form
+func writeMsgPackInt(w *bufio.Writer, i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		w.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		w.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		w.WriteByte(0xcc)
+		w.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		w.WriteByte(0xcd)
+		writeUint(w, uint64(i), 2)
+	case i >= 0 && i <= math.MaxUint32:
+		w.WriteByte(0xce)
+		writeUint(w, uint64(i), 4)
+	case i >= 0:
+		w.WriteByte(0xcf)
+		writeUint(w, uint64(i), 8)
+	case i >= math.MinInt8:
+		w.WriteByte(0xd0)
+		w.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		w.WriteByte(0xd1)
+		writeUint(w, uint64(i), 2)
+	case i >= math.MinInt32:
+		w.WriteByte(0xd2)
+		writeUint(w, uint64(i), 4)
+	default:
+		w.WriteByte(0xd3)
+		writeUint(w, uint64(i), 8)
+	}
+}
+
+// writeUint() writes the low size bytes of u in big-endian order
+func writeUint(w *bufio.Writer, u uint64, size int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], u)
+	w.Write(b[8-size:])
+}
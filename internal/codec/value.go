@@ -0,0 +1,157 @@
+// Filename: internal/codec/value.go
+
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Responses are first marshalled to JSON, so that the struct tags and
+// MarshalJSON methods the API already has decide what every format holds,
+// and then decoded into a tree of generic values that keeps the order of
+// object members. The values are Object, []interface{}, json.Number, string,
+// bool and nil.
+
+// An Object is a JSON object with its members in their original order
+type Object []Member
+
+type Member struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON() writes the members in order
+func (o Object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// toValue() turns v into a generic value by way of JSON
+func toValue(v interface{}) (interface{}, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch delim {
+	case '{':
+		object := Object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, Member{Key: key.(string), Value: value})
+		}
+		_, err = dec.Token()
+		return object, err
+	case '[':
+		array := []interface{}{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = dec.Token()
+		return array, err
+	}
+	return nil, fmt.Errorf("codec: unexpected delimiter %v", delim)
+}
+
+// records() picks out the rows of a response for the row based formats. If
+// the response holds a single array its elements are the rows, if it holds a
+// single object that object is the row, and otherwise the whole response is
+// one row. Other members, such as pagination metadata, are left out.
+func records(v interface{}) []interface{} {
+	object, ok := v.(Object)
+	if !ok {
+		return []interface{}{v}
+	}
+	var array []interface{}
+	arrays := 0
+	for _, member := range object {
+		if a, ok := member.Value.([]interface{}); ok {
+			array = a
+			arrays++
+		}
+	}
+	switch {
+	case arrays == 1:
+		return array
+	case len(object) == 1:
+		if inner, ok := object[0].Value.(Object); ok {
+			return []interface{}{inner}
+		}
+	}
+	return []interface{}{object}
+}
+
+// RenamePaths() turns v into a generic value with the keys at the given
+// paths renamed. A path lists the keys from the top, separated by slashes,
+// with * standing for any element of an array, as in "Notes/*/desription".
+// Other keys are kept, however deep they are, so that data such as error
+// maps keyed by field or line keeps its keys.
+func RenamePaths(v interface{}, paths map[string]string) (interface{}, error) {
+	value, err := toValue(v)
+	if err != nil {
+		return nil, err
+	}
+	renamePaths(value, "", paths)
+	return value, nil
+}
+
+func renamePaths(value interface{}, prefix string, paths map[string]string) {
+	switch v := value.(type) {
+	case Object:
+		for i := range v {
+			path := prefix + v[i].Key
+			if name, ok := paths[path]; ok {
+				v[i].Key = name
+			}
+			renamePaths(v[i].Value, path+"/", paths)
+		}
+	case []interface{}:
+		for _, item := range v {
+			renamePaths(item, prefix+"*/", paths)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Filename: internal/codec/value_test.go
+
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRenamePaths(t *testing.T) {
+	v := map[string]interface{}{
+		"Notes": []map[string]interface{}{
+			{"id": 1, "desription": "a", "comments": []map[string]string{{"desription": "kept"}}},
+		},
+		"Note":  map[string]string{"desription": "b"},
+		"error": map[string]string{"Notes": "kept", "desription": "kept"},
+	}
+	value, err := RenamePaths(v, map[string]string{
+		"Notes":              "notes",
+		"Notes/*/desription": "description",
+		"Note":               "note",
+		"Note/desription":    "description",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"note":{"description":"b"},"notes":[{"comments":[{"desription":"kept"}],"description":"a","id":1}],"error":{"Notes":"kept","desription":"kept"}}`
+	if string(js) != want {
+		t.Errorf("got  %s\nwant %s", js, want)
+	}
+}
@@ -0,0 +1,138 @@
+// Filename: internal/codec/yaml.go
+
+package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Keys that can be written without quotes
+var plainKeyRX = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// encodeYAML() writes a value as a YAML document in block style. Strings are
+// double quoted with JSON escaping, which YAML reads the same way.
+func encodeYAML(w io.Writer, v interface{}) error {
+	value, err := toValue(v)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("---\n")
+	if isCollection(value) {
+		err = writeYAMLBlock(bw, value, 0)
+	} else {
+		err = writeYAMLScalar(bw, value)
+		bw.WriteByte('\n')
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// isEmptyCollection() reports whether a value is written inline as {} or []
+func isEmptyCollection(v interface{}) bool {
+	switch v := v.(type) {
+	case Object:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func isCollection(v interface{}) bool {
+	switch v.(type) {
+	case Object, []interface{}:
+		return !isEmptyCollection(v)
+	}
+	return false
+}
+
+// writeYAMLBlock() writes a non-empty object or array at an indentation level
+func writeYAMLBlock(w *bufio.Writer, v interface{}, indent int) error {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case Object:
+		for _, member := range v {
+			w.WriteString(pad)
+			writeYAMLKey(w, member.Key)
+			w.WriteByte(':')
+			err := writeYAMLChild(w, member.Value, indent+1)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, element := range v {
+			w.WriteString(pad)
+			w.WriteByte('-')
+			err := writeYAMLChild(w, element, indent+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeYAMLChild() writes the value after a key or a dash
+func writeYAMLChild(w *bufio.Writer, v interface{}, indent int) error {
+	if !isCollection(v) {
+		w.WriteByte(' ')
+		err := writeYAMLScalar(w, v)
+		w.WriteByte('\n')
+		return err
+	}
+	w.WriteByte('\n')
+	return writeYAMLBlock(w, v, indent)
+}
+
+func writeYAMLKey(w *bufio.Writer, key string) {
+	if plainKeyRX.MatchString(key) && !isYAMLKeyword(key) {
+		w.WriteString(key)
+		return
+	}
+	js, _ := json.Marshal(key)
+	w.Write(js)
+}
+
+// isYAMLKeyword() reports whether a plain word would be read as something
+// other than a string
+func isYAMLKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "y", "n", "~":
+		return true
+	}
+	return false
+}
+
+func writeYAMLScalar(w *bufio.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("null")
+	case bool:
+		if v {
+			w.WriteString("true")
+		} else {
+			w.WriteString("false")
+		}
+	case json.Number:
+		w.WriteString(v.String())
+	case Object:
+		w.WriteString("{}")
+	case []interface{}:
+		w.WriteString("[]")
+	default:
+		js, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.Write(js)
+	}
+	return nil
+}
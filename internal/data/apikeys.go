@@ -0,0 +1,207 @@
+// Filename: internal/data/apikeys.go
+
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// API key scopes
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+)
+
+// APIKeyScopes lists the scopes an API key can be given
+var APIKeyScopes = []string{ScopeNotesRead, ScopeNotesWrite}
+
+// APIKeyPrefix starts every API key so that they are easy to recognise, both
+// by the authentication middleware and by secret scanners
+const APIKeyPrefix = "todo_"
+
+type APIKey struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Plaintext  string     `json:"key,omitempty"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// HasScope() checks if the key was granted a scope
+func (k *APIKey) HasScope(scope string) bool {
+	return validator.In(scope, k.Scopes...)
+}
+
+// IsAPIKey() tells API keys apart from other bearer tokens
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// generateAPIKey() creates a key of the form todo_<prefix>_<secret>. The
+// prefix identifies the key in listings, the whole key is only stored hashed.
+func generateAPIKey(key *APIKey) error {
+	randomBytes := make([]byte, 25)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	key.Prefix = APIKeyPrefix + encoded[:8]
+	key.Plaintext = key.Prefix + "_" + encoded[8:]
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+	return nil
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 200, "name", "must not be more than 200 bytes long")
+
+	v.Check(len(key.Scopes) >= 1, "scopes", "must contain at least one entry")
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate entries")
+	for _, scope := range key.Scopes {
+		v.Check(validator.In(scope, APIKeyScopes...), "scopes", "must only contain notes:read or notes:write")
+	}
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// New() generates and stores a key. The plaintext is only available on the
+// returned value.
+func (m APIKeyModel) New(key *APIKey) error {
+	err := generateAPIKey(key)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	args := []interface{}{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Scopes), key.Expiry}
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForUser() lists the keys of a user
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, created_at, user_id, name, prefix, scopes, expiry, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id ASC
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Delete() revokes a key belonging to a user
+func (m APIKeyModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Authenticate() looks up an unexpired key and records that it was used
+func (m APIKeyModel) Authenticate(plaintext string) (*APIKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE hash = $1
+		AND (expiry IS NULL OR expiry > NOW())
+		RETURNING id, created_at, user_id, name, prefix, scopes, expiry, last_used_at
+	`
+	var key APIKey
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.Expiry,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &key, nil
+}
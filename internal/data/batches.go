@@ -0,0 +1,194 @@
+// Filename: internal/data/batches.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The methods in this file read the notes of many workspaces, or many notes,
+// in a single query so that callers can batch their lookups. The workspaces
+// are filtered on explicitly, and must be ones the user is a member of; the
+// row level security policies only hide the workspaces of other users.
+
+// GetMany() returns the notes of a workspace with the given ids, by id. Ids
+// that don't exist are missing from the map.
+func (m NoteModel) GetMany(t Tenant, ids []int64) (map[int64]*Note, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM notes
+		WHERE workspace_id = $1 AND id = ANY($2)
+	`, strings.Join(noteColumns, ", "))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	notes := map[int64]*Note{}
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, t.WorkspaceID, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var note Note
+			dest := []interface{}{}
+			for _, column := range noteColumns {
+				dest = append(dest, note.scanDest(column))
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			notes[note.ID] = &note
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// GetAllForWorkspaces() lists the notes matching the filters in each of the
+// workspaces, by workspace id. Every workspace gets its own page, ranked by
+// the sort order, so the filters must be in cursor mode.
+func (m NoteModel) GetAllForWorkspaces(userID int64, workspaceIDs []int64, filter NoteFilter, filters Filters) (map[int64][]*Note, map[int64]Metadata, error) {
+	conditions, args, err := listConditions(filter, filters, filters.limit(), 0, pq.Array(workspaceIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT workspace_id, %s
+		FROM (
+			SELECT workspace_id, %s,
+			ROW_NUMBER() OVER (PARTITION BY workspace_id ORDER BY %s %s, id ASC) AS position
+			FROM notes
+			WHERE workspace_id = ANY($10)
+			%s
+		) ranked
+		WHERE position > $9 AND position <= $9 + $8
+		ORDER BY workspace_id, position`,
+		strings.Join(noteColumns, ", "), strings.Join(noteColumns, ", "),
+		filters.sortColumn(), filters.sortOrder(), conditions)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	notes := map[int64][]*Note{}
+	err = withTenant(ctx, m.DB, Tenant{UserID: userID}, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var workspaceID int64
+			var note Note
+			dest := []interface{}{&workspaceID}
+			for _, column := range noteColumns {
+				dest = append(dest, note.scanDest(column))
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			notes[workspaceID] = append(notes[workspaceID], &note)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := map[int64]Metadata{}
+	for _, workspaceID := range workspaceIDs {
+		notes[workspaceID], metadata[workspaceID] = calculateCursorMetadata(notes[workspaceID], filters)
+	}
+	return notes, metadata, nil
+}
+
+// CursorFor() returns the cursor that starts a page after the note, in the
+// filters' sort order
+func (f Filters) CursorFor(note *Note) string {
+	return encodeCursor(cursor{
+		Sort:  f.Sort,
+		Value: note.sortValue(f.sortColumn()),
+		ID:    note.ID,
+	})
+}
+
+// A TagCount is the number of notes carrying a status
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// A NoteSummary counts the notes of a workspace, in total and by status
+type NoteSummary struct {
+	Count int        `json:"count"`
+	Tags  []TagCount `json:"tags"`
+}
+
+// Summaries() counts the notes of each of the workspaces, by workspace id.
+// Every workspace asked for is in the map, with zero counts if it is empty.
+func (m NoteModel) Summaries(userID int64, workspaceIDs []int64) (map[int64]*NoteSummary, error) {
+	countQuery := `
+		SELECT workspace_id, COUNT(*)
+		FROM notes
+		WHERE workspace_id = ANY($1)
+		GROUP BY workspace_id
+	`
+	tagQuery := `
+		SELECT workspace_id, tag, COUNT(*)
+		FROM notes, unnest(status) AS tag
+		WHERE workspace_id = ANY($1)
+		GROUP BY workspace_id, tag
+		ORDER BY workspace_id, COUNT(*) DESC, tag ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	summaries := map[int64]*NoteSummary{}
+	for _, workspaceID := range workspaceIDs {
+		summaries[workspaceID] = &NoteSummary{Tags: []TagCount{}}
+	}
+	err := withTenant(ctx, m.DB, Tenant{UserID: userID}, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, countQuery, pq.Array(workspaceIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var workspaceID int64
+			var count int
+			if err := rows.Scan(&workspaceID, &count); err != nil {
+				return err
+			}
+			if summary, ok := summaries[workspaceID]; ok {
+				summary.Count = count
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows, err = tx.QueryContext(ctx, tagQuery, pq.Array(workspaceIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var workspaceID int64
+			var tag TagCount
+			if err := rows.Scan(&workspaceID, &tag.Tag, &tag.Count); err != nil {
+				return err
+			}
+			if summary, ok := summaries[workspaceID]; ok {
+				summary.Tags = append(summary.Tags, tag)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
@@ -0,0 +1,118 @@
+// Filename: internal/data/bulk.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrBulkRolledBack means an all-or-nothing bulk operation had a failing item
+// and none of its changes were kept
+var ErrBulkRolledBack = errors.New("bulk operation rolled back")
+
+// bulk() runs fn for each of n items in one transaction. Every item runs in
+// its own savepoint so that a failing item is undone without aborting the
+// rest. It returns the error of each item, nil where the item succeeded. In
+// atomic mode any failure rolls back the whole transaction.
+func (m NoteModel) bulk(t Tenant, n int, atomic bool, fn func(ctx context.Context, tx *sql.Tx, i int) error) ([]error, error) {
+	errs := make([]error, n)
+	// Allow a little time per item on top of the usual timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second+time.Duration(n)*20*time.Millisecond)
+	defer cancel()
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		failed := false
+		for i := 0; i < n; i++ {
+			savepoint := fmt.Sprintf("item_%d", i)
+			_, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint)
+			if err != nil {
+				return err
+			}
+			errs[i] = fn(ctx, tx, i)
+			if errs[i] != nil {
+				failed = true
+				_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			} else {
+				_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if atomic && failed {
+			return ErrBulkRolledBack
+		}
+		return nil
+	})
+	return errs, err
+}
+
+// InsertMany() creates several notes in one transaction
+func (m NoteModel) InsertMany(t Tenant, notes []*Note, atomic bool) ([]error, error) {
+	return m.bulk(t, len(notes), atomic, func(ctx context.Context, tx *sql.Tx, i int) error {
+		return insertNote(ctx, tx, t, notes[i])
+	})
+}
+
+// UpdateMany() updates several notes in one transaction. Each note is read
+// and locked, passed to apply to make its changes, and then written back. An
+// error from apply fails the item.
+func (m NoteModel) UpdateMany(t Tenant, ids []int64, atomic bool, apply func(i int, note *Note) error) ([]*Note, []error, error) {
+	notes := make([]*Note, len(ids))
+	errs, err := m.bulk(t, len(ids), atomic, func(ctx context.Context, tx *sql.Tx, i int) error {
+		query := `
+			SELECT id, created_at, task_name, description, category, priority, status, version
+			FROM notes
+			WHERE id = $1 AND workspace_id = $2
+			FOR UPDATE
+		`
+		var note Note
+		err := tx.QueryRowContext(ctx, query, ids[i], t.WorkspaceID).Scan(
+			&note.ID,
+			&note.CreatedAt,
+			&note.Task_Name,
+			&note.Description,
+			&note.Category,
+			&note.Priority,
+			pq.Array(&note.Status),
+			&note.Version,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+		err = apply(i, &note)
+		if err != nil {
+			return err
+		}
+		err = updateNote(ctx, tx, t, &note)
+		if err != nil {
+			return err
+		}
+		notes[i] = &note
+		return nil
+	})
+	return notes, errs, err
+}
+
+// DeleteMany() deletes several notes in one transaction. If versions is not
+// nil each note is only deleted at the version in the same position, and the
+// item fails with ErrEditConflict if it has another.
+func (m NoteModel) DeleteMany(t Tenant, ids []int64, versions []int32, atomic bool) ([]error, error) {
+	return m.bulk(t, len(ids), atomic, func(ctx context.Context, tx *sql.Tx, i int) error {
+		var version int32
+		if versions != nil {
+			version = versions[i]
+		}
+		return deleteNote(ctx, tx, t, ids[i], version)
+	})
+}
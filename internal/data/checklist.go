@@ -0,0 +1,158 @@
+// Filename: internal/data/checklist.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// A ChecklistItem is one step of a note. Items keep the order they were
+// added in.
+type ChecklistItem struct {
+	ID        int64     `json:"id"`
+	NoteID    int64     `json:"note_id"`
+	Text      string    `json:"text"`
+	Done      bool      `json:"done"`
+	Position  int32     `json:"position"`
+	CreatedAt time.Time `json:"-"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateChecklistItem(v *validator.Validator, item *ChecklistItem) {
+	v.Check(strings.TrimSpace(item.Text) != "", "text", "must be provided")
+	v.Check(len(item.Text) <= 200, "text", "must not be more than 200 bytes long")
+}
+
+type ChecklistModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds an item to the end of the checklist of a note in the
+// workspace. It returns ErrRecordNotFound if the note isn't in the workspace.
+func (m ChecklistModel) Insert(t Tenant, item *ChecklistItem) error {
+	query := `
+		INSERT INTO note_checklist_items (note_id, text, done, position)
+		SELECT n.id, $2, $3, COALESCE((SELECT MAX(position) FROM note_checklist_items WHERE note_id = n.id), 0) + 1
+		FROM notes n
+		WHERE n.id = $1 AND n.workspace_id = $4
+		RETURNING id, position, created_at, version
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, item.NoteID, item.Text, item.Done, t.WorkspaceID).Scan(
+			&item.ID, &item.Position, &item.CreatedAt, &item.Version,
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() retrieves an item of a note in the workspace
+func (m ChecklistModel) Get(t Tenant, noteID, id int64) (*ChecklistItem, error) {
+	if noteID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT i.id, i.note_id, i.text, i.done, i.position, i.created_at, i.version
+		FROM note_checklist_items i
+		JOIN notes n ON n.id = i.note_id
+		WHERE i.id = $1 AND i.note_id = $2 AND n.workspace_id = $3
+	`
+	var item ChecklistItem
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, id, noteID, t.WorkspaceID).Scan(
+			&item.ID, &item.NoteID, &item.Text, &item.Done, &item.Position, &item.CreatedAt, &item.Version,
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &item, nil
+}
+
+// Update() saves the text and state of an item. It returns ErrEditConflict
+// if the item changed since it was read.
+func (m ChecklistModel) Update(t Tenant, item *ChecklistItem) error {
+	query := `
+		UPDATE note_checklist_items
+		SET text = $1, done = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		AND note_id IN (SELECT id FROM notes WHERE workspace_id = $5)
+		RETURNING version
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, item.Text, item.Done, item.ID, item.Version, t.WorkspaceID).Scan(&item.Version)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetForNotes() returns the checklists of the notes in order, keyed by note
+// ID. Notes outside the workspace have none.
+func (m ChecklistModel) GetForNotes(t Tenant, noteIDs []int64) (map[int64][]*ChecklistItem, error) {
+	query := `
+		SELECT i.id, i.note_id, i.text, i.done, i.position, i.created_at, i.version
+		FROM note_checklist_items i
+		JOIN notes n ON n.id = i.note_id
+		WHERE i.note_id = ANY($1) AND n.workspace_id = $2
+		ORDER BY i.position, i.id
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	items := make(map[int64][]*ChecklistItem, len(noteIDs))
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, pq.Array(noteIDs), t.WorkspaceID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var item ChecklistItem
+			err := rows.Scan(&item.ID, &item.NoteID, &item.Text, &item.Done, &item.Position, &item.CreatedAt, &item.Version)
+			if err != nil {
+				return err
+			}
+			items[item.NoteID] = append(items[item.NoteID], &item)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,93 @@
+// Filename: internal/data/comments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// A Comment is a remark a member of a workspace left on a note
+type Comment struct {
+	ID        int64     `json:"id"`
+	NoteID    int64     `json:"note_id"`
+	UserID    int64     `json:"user_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(strings.TrimSpace(comment.Body) != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 2000, "body", "must not be more than 2000 bytes long")
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds a comment to a note in the workspace. It returns
+// ErrRecordNotFound if the note isn't in the workspace.
+func (m CommentModel) Insert(t Tenant, comment *Comment) error {
+	query := `
+		INSERT INTO note_comments (note_id, user_id, body)
+		SELECT id, $2, $3 FROM notes WHERE id = $1 AND workspace_id = $4
+		RETURNING id, created_at
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, comment.NoteID, t.UserID, comment.Body, t.WorkspaceID).Scan(&comment.ID, &comment.CreatedAt)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetForNotes() returns the comments of the notes, oldest first, keyed by
+// note ID. Notes outside the workspace have none.
+func (m CommentModel) GetForNotes(t Tenant, noteIDs []int64) (map[int64][]*Comment, error) {
+	query := `
+		SELECT c.id, c.note_id, c.user_id, c.body, c.created_at
+		FROM note_comments c
+		JOIN notes n ON n.id = c.note_id
+		WHERE c.note_id = ANY($1) AND n.workspace_id = $2
+		ORDER BY c.created_at, c.id
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	comments := make(map[int64][]*Comment, len(noteIDs))
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, pq.Array(noteIDs), t.WorkspaceID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var comment Comment
+			err := rows.Scan(&comment.ID, &comment.NoteID, &comment.UserID, &comment.Body, &comment.CreatedAt)
+			if err != nil {
+				return err
+			}
+			comments[comment.NoteID] = append(comments[comment.NoteID], &comment)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
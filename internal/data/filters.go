@@ -3,6 +3,10 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"strings"
 
@@ -14,6 +18,14 @@ type Filters struct {
 	PageSize int
 	Sort     string
 	SortList []string
+	// In cursor mode the page starts after the row the cursor points at.
+	// An empty cursor starts at the first row.
+	UseCursor bool
+	Cursor    string
+	// The fields to return, all of them if empty. Only those in FieldList
+	// are accepted.
+	Fields    []string
+	FieldList []string
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -22,8 +34,83 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 1000, "page", "must be a maximum of 1000")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	ValidateSortAndFields(v, f)
+	// Check that the cursor was issued for the same sort order
+	if f.UseCursor && f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		switch {
+		case err != nil:
+			v.AddError("cursor", "invalid cursor value")
+		case c.Sort != f.Sort:
+			v.AddError("cursor", "was issued for a different sort value")
+		}
+	}
+}
+
+// ValidateSortAndFields() checks the sort and fields parameters, which are
+// also used without pagination
+func ValidateSortAndFields(v *validator.Validator, f Filters) {
 	// Check that the sort parameter matches a value in the sort list
 	v.Check(validator.In(f.Sort, f.SortList...), "sort", "invalid sort value")
+	// Check that every requested field is known
+	for _, field := range f.Fields {
+		if !validator.In(field, f.FieldList...) {
+			v.AddError("fields", fmt.Sprintf("unknown field %q, valid fields are %s", field, strings.Join(f.FieldList, ", ")))
+		}
+	}
+}
+
+// A cursor points at the last row of a page. It holds the value of the sort
+// column and the id, which breaks ties between rows with the same value.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// encodeCursor() turns a cursor into the opaque string handed to clients
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return nil, err
+	}
+	if c.ID < 1 {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+// sortColumnTypes holds the SQL type of the sort columns that are not text
+var sortColumnTypes = map[string]string{
+	"id": "bigint",
+}
+
+// keysetCondition() returns the WHERE clause that skips the rows up to and
+// including the cursor, using the given argument positions for the cursor
+// value and id. Rows are ordered by the sort column and then by id ascending,
+// so a row comes after the cursor if its sort value is past the cursor value,
+// or equal to it with a greater id.
+func (f Filters) keysetCondition(valueArg, idArg int) string {
+	column := f.sortColumn()
+	operator := ">"
+	if f.sortOrder() == "DESC" {
+		operator = "<"
+	}
+	value := fmt.Sprintf("$%d", valueArg)
+	if sqlType, ok := sortColumnTypes[column]; ok {
+		value += "::" + sqlType
+	}
+	return fmt.Sprintf("(%s %s %s OR (%s = %s AND id > $%d))", column, operator, value, column, value, idArg)
 }
 
 // The sort column method safely extracts the sort field query parameter
@@ -45,22 +132,35 @@ func (f Filters) sortOrder() string {
 	return "ASC"
 }
 
-// The limit method determines the limit
+// HasField() reports whether a field was requested
+func (f Filters) HasField(field string) bool {
+	return len(f.Fields) == 0 || validator.In(field, f.Fields...)
+}
+
+// The limit method determines the limit. In cursor mode one extra row is
+// fetched to find out if there is a next page.
 func (f Filters) limit() int {
+	if f.UseCursor {
+		return f.PageSize + 1
+	}
 	return f.PageSize
 }
 
 func (f Filters) offSet() int {
+	if f.UseCursor {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
 
 // THe metadata type contains metadat to help with pagination
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecrods int, page int, pageSize int) Metadata {
@@ -75,3 +175,14 @@ func calculateMetadata(totalRecrods int, page int, pageSize int) Metadata {
 		TotalRecords: totalRecrods,
 	}
 }
+
+// calculateCursorMetadata() trims the extra row fetched in cursor mode and
+// points the next cursor at the last row of the page
+func calculateCursorMetadata(notes []*Note, filters Filters) ([]*Note, Metadata) {
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(notes) > filters.PageSize {
+		notes = notes[:filters.PageSize]
+		metadata.NextCursor = filters.CursorFor(notes[len(notes)-1])
+	}
+	return notes, metadata
+}
@@ -0,0 +1,204 @@
+// Filename: internal/data/filters_test.go
+
+package data
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// The sort values of the Note listing
+var testSortList = []string{"id", "task_name", "description", "-id", "-task_name", "-description"}
+
+func TestCursorRoundTrip(t *testing.T) {
+	note := &Note{ID: 42, Task_Name: "Buy milk", Description: "semi-skimmed, \"two\" pints"}
+	tests := []struct {
+		sort  string
+		value string
+	}{
+		{"id", "42"},
+		{"-id", "42"},
+		{"task_name", "Buy milk"},
+		{"-task_name", "Buy milk"},
+		{"description", `semi-skimmed, "two" pints`},
+		{"-description", `semi-skimmed, "two" pints`},
+	}
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortList: testSortList}
+		encoded := f.CursorFor(note)
+		// The cursor is opaque and safe in a query string
+		if strings.ContainsAny(encoded, "+/=") {
+			t.Errorf("%s: cursor %q isn't URL safe", tt.sort, encoded)
+		}
+		c, err := decodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sort, err)
+		}
+		if want := (cursor{Sort: tt.sort, Value: tt.value, ID: 42}); *c != want {
+			t.Errorf("%s: got %+v, want %+v", tt.sort, *c, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	valid := encodeCursor(cursor{Sort: "id", Value: "7", ID: 7})
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"id","v":"7","id":7}`)) + "="},
+		{"truncated", valid[:len(valid)-3]},
+		{"extra byte", valid + "A"},
+		{"not JSON", raw("id=7")},
+		{"wrong types", raw(`{"s":"id","v":7,"id":"7"}`)},
+		{"no id", raw(`{"s":"id","v":"7"}`)},
+		{"zero id", raw(`{"s":"id","v":"7","id":0}`)},
+		{"negative id", raw(`{"s":"id","v":"7","id":-1}`)},
+	}
+	for _, tt := range tests {
+		if c, err := decodeCursor(tt.cursor); err == nil {
+			t.Errorf("%s: %q decoded to %+v", tt.name, tt.cursor, *c)
+		}
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		want   string
+	}{
+		{"first page", "-task_name", "", ""},
+		{"matching sort", "-task_name", encodeCursor(cursor{Sort: "-task_name", Value: "a", ID: 1}), ""},
+		{"tampered", "-task_name", "Zm9v", "invalid cursor value"},
+		{"other direction", "-task_name", encodeCursor(cursor{Sort: "task_name", Value: "a", ID: 1}), "was issued for a different sort value"},
+		{"other column", "id", encodeCursor(cursor{Sort: "description", Value: "a", ID: 1}), "was issued for a different sort value"},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateFilters(v, Filters{Page: 1, PageSize: 20, Sort: tt.sort, SortList: testSortList, UseCursor: true, Cursor: tt.cursor})
+		if got := v.Errors["cursor"]; got != tt.want {
+			t.Errorf("%s: got cursor error %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Rows are ordered by the sort column in either direction, then by id
+// ascending, so a row comes after the cursor if its sort value is past the
+// cursor value, or equal to it with a greater id
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"id", "(id > $11::bigint OR (id = $11::bigint AND id > $12))"},
+		{"-id", "(id < $11::bigint OR (id = $11::bigint AND id > $12))"},
+		{"task_name", "(task_name > $11 OR (task_name = $11 AND id > $12))"},
+		{"-task_name", "(task_name < $11 OR (task_name = $11 AND id > $12))"},
+		{"description", "(description > $11 OR (description = $11 AND id > $12))"},
+		{"-description", "(description < $11 OR (description = $11 AND id > $12))"},
+	}
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortList: testSortList, UseCursor: true}
+		if got := f.keysetCondition(11, 12); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestListQueryCursor(t *testing.T) {
+	tenant := Tenant{UserID: 1, WorkspaceID: 2}
+	for _, sort := range testSortList {
+		column := strings.TrimPrefix(sort, "-")
+		order := "ASC"
+		if strings.HasPrefix(sort, "-") {
+			order = "DESC"
+		}
+		// Without a cursor the first page isn't restricted
+		f := Filters{PageSize: 20, Sort: sort, SortList: testSortList, UseCursor: true}
+		query, args, _, err := listQuery(tenant, NoteFilter{}, f, "", f.limit(), f.offSet())
+		if err != nil {
+			t.Fatalf("%s: %v", sort, err)
+		}
+		if len(args) != 10 || strings.Contains(query, "$11") {
+			t.Errorf("%s: first page has %d arguments: %s", sort, len(args), query)
+		}
+		if want := fmt.Sprintf("ORDER by %s %s, id ASC", column, order); !strings.Contains(query, want) {
+			t.Errorf("%s: query doesn't contain %q: %s", sort, want, query)
+		}
+		// The cursor value and id follow the fixed arguments
+		f.Cursor = encodeCursor(cursor{Sort: sort, Value: "v", ID: 9})
+		query, args, _, err = listQuery(tenant, NoteFilter{}, f, "", f.limit(), f.offSet())
+		if err != nil {
+			t.Fatalf("%s: %v", sort, err)
+		}
+		if len(args) != 12 || args[10] != "v" || args[11] != int64(9) {
+			t.Errorf("%s: got arguments %v", sort, args[10:])
+		}
+		if want := f.keysetCondition(11, 12); !strings.Contains(query, want) {
+			t.Errorf("%s: query doesn't contain %q: %s", sort, want, query)
+		}
+		if args[7] != f.PageSize+1 || args[8] != 0 {
+			t.Errorf("%s: got limit %v and offset %v, want %d and 0", sort, args[7], args[8], f.PageSize+1)
+		}
+	}
+	f := Filters{PageSize: 20, Sort: "id", SortList: testSortList, UseCursor: true, Cursor: "!!"}
+	if _, _, _, err := listQuery(tenant, NoteFilter{}, f, "", f.limit(), f.offSet()); err == nil {
+		t.Error("a malformed cursor was accepted")
+	}
+}
+
+func TestSortColumnRejectsUnlistedValues(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an unlisted sort value was used")
+		}
+	}()
+	Filters{Sort: "workspace_id", SortList: testSortList}.sortColumn()
+}
+
+// Paging through Notes that share a sort value visits each exactly once,
+// in both directions
+func TestCursorPagingWithTies(t *testing.T) {
+	f := newTenantFixture(t)
+	for _, name := range []string{"b", "a", "b", "c", "b", "a"} {
+		note := &Note{Task_Name: name, Description: "d", Category: "c", Priority: "low", Status: []string{"todo"}}
+		if err := f.models.Notes.Insert(f.alice, note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sort := range []string{"task_name", "-task_name"} {
+		filters := Filters{PageSize: 2, Sort: sort, SortList: testSortList, UseCursor: true}
+		all, _, err := f.models.Notes.GetAll(f.alice, NoteFilter{Status: []string{}}, Filters{Page: 1, PageSize: 100, Sort: sort, SortList: testSortList})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paged []*Note
+		for {
+			notes, metadata, err := f.models.Notes.GetAll(f.alice, NoteFilter{Status: []string{}}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, notes...)
+			if metadata.NextCursor == "" {
+				break
+			}
+			filters.Cursor = metadata.NextCursor
+		}
+		if len(paged) != len(all) {
+			t.Fatalf("%s: got %d Notes, want %d", sort, len(paged), len(all))
+		}
+		for i := range all {
+			if paged[i].ID != all[i].ID {
+				t.Errorf("%s: Note %d is %d, want %d", sort, i, paged[i].ID, all[i].ID)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Filename: internal/data/idempotency.go
+
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+var (
+	// ErrIdempotencyKeyReused means the key was first sent with another request
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+	// ErrIdempotencyKeyInFlight means the first request with the key hasn't finished
+	ErrIdempotencyKeyInFlight = errors.New("idempotency key in use by a request in progress")
+)
+
+// A StoredResponse is the response first sent for an idempotency key
+type StoredResponse struct {
+	Status  int
+	Headers http.Header
+	Body    []byte
+}
+
+// IdempotencyRequestHash() hashes what makes two requests the same: the
+// method, the path and the body
+func IdempotencyRequestHash(method, path string, body []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+func ValidateIdempotencyKey(v *validator.Validator, key string) {
+	v.Check(len(key) <= 255, "Idempotency-Key", "must not be more than 255 bytes long")
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Claim() reserves a key for a request. It returns nil if the caller should
+// process the request, the stored response if it was already processed, or
+// an error if the key belongs to a different request or one still running.
+// The claim lasts for the lease; after that the request is presumed dead and
+// a retry may take the key over.
+func (m IdempotencyModel) Claim(userID int64, key string, requestHash []byte, ttl, lease time.Duration) (*StoredResponse, error) {
+	// Keys that have expired, and claims whose lease ran out, are taken over
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, expiry, locked_until)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status = NULL, headers = NULL,
+		    body = NULL, created_at = NOW(), expiry = EXCLUDED.expiry,
+		    locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.expiry < NOW()
+		   OR (idempotency_keys.status IS NULL AND idempotency_keys.locked_until < NOW())
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	now := time.Now()
+	result, err := m.DB.ExecContext(ctx, query, userID, key, requestHash, now.Add(ttl), now.Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 1 {
+		return nil, nil
+	}
+	return m.get(userID, key, requestHash)
+}
+
+// get() returns the stored response of a key that was already claimed
+func (m IdempotencyModel) get(userID int64, key string, requestHash []byte) (*StoredResponse, error) {
+	query := `
+		SELECT request_hash, status, headers, body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`
+	var (
+		hash    []byte
+		status  sql.NullInt32
+		headers []byte
+		stored  StoredResponse
+	)
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID, key).Scan(&hash, &status, &headers, &stored.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// The first request failed and released the key in the meantime
+			return nil, ErrIdempotencyKeyInFlight
+		default:
+			return nil, err
+		}
+	}
+	if string(hash) != string(requestHash) {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !status.Valid {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	stored.Status = int(status.Int32)
+	err = json.Unmarshal(headers, &stored.Headers)
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// Complete() stores the response sent for a claimed key. The first response
+// stored wins, should a retry have taken over the key after its lease ran out.
+func (m IdempotencyModel) Complete(userID int64, key string, response *StoredResponse) error {
+	headers, err := json.Marshal(response.Headers)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE idempotency_keys
+		SET status = $3, headers = $4, body = $5
+		WHERE user_id = $1 AND key = $2 AND status IS NULL
+	`
+	args := []interface{}{userID, key, response.Status, headers, response.Body}
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Release() gives up a claimed key so the request can be retried
+func (m IdempotencyModel) Release(userID int64, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND status IS NULL
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, key)
+	return err
+}
@@ -0,0 +1,53 @@
+// Filename: internal/data/idempotency_test.go
+
+package data
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/testdb"
+)
+
+func TestIdempotencyClaim(t *testing.T) {
+	models := NewModels(testdb.Open(t))
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := user.Password.Set("pa55word1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Users.InsertWithWorkspace(user, &Workspace{Name: "Alice", Personal: true}); err != nil {
+		t.Fatal(err)
+	}
+	hash := IdempotencyRequestHash(http.MethodPost, "/v1/Notes", []byte(`{}`))
+	other := IdempotencyRequestHash(http.MethodPost, "/v1/Notes", []byte(`{"a":1}`))
+
+	stored, err := models.Idempotency.Claim(user.ID, "k1", hash, time.Hour, time.Minute)
+	if err != nil || stored != nil {
+		t.Fatalf("first claim: got %v, %v", stored, err)
+	}
+	if _, err := models.Idempotency.Claim(user.ID, "k1", hash, time.Hour, time.Minute); !errors.Is(err, ErrIdempotencyKeyInFlight) {
+		t.Errorf("claim while in flight: got %v", err)
+	}
+	if _, err := models.Idempotency.Claim(user.ID, "k1", other, time.Hour, time.Minute); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("claim with another request: got %v", err)
+	}
+	response := &StoredResponse{Status: http.StatusCreated, Headers: http.Header{"Location": {"/v1/Notes/1"}}, Body: []byte(`{}`)}
+	if err := models.Idempotency.Complete(user.ID, "k1", response); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = models.Idempotency.Claim(user.ID, "k1", hash, time.Hour, time.Minute)
+	if err != nil || stored == nil || stored.Status != http.StatusCreated || stored.Headers.Get("Location") != "/v1/Notes/1" {
+		t.Errorf("replay: got %+v, %v", stored, err)
+	}
+
+	// A claim whose lease ran out is taken over by a retry
+	if _, err := models.Idempotency.Claim(user.ID, "k2", hash, time.Hour, -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = models.Idempotency.Claim(user.ID, "k2", hash, time.Hour, time.Minute)
+	if err != nil || stored != nil {
+		t.Errorf("takeover after the lease: got %v, %v", stored, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Filename: internal/data/identities.go
+
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// An Identity links a user to an account at an external identity provider
+type Identity struct {
+	Issuer  string
+	Subject string
+	UserID  int64
+}
+
+// An OIDCLogin holds the secrets of an authorization code login in progress.
+// The binding is kept in a cookie by the browser that started the login.
+type OIDCLogin struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+	Binding      string
+	Expiry       time.Time
+}
+
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// GetUserID() finds the user linked to an external account
+func (m IdentityModel) GetUserID(issuer, subject string) (int64, error) {
+	query := `
+		SELECT user_id
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2
+	`
+	var userID int64
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, issuer, subject).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+// Insert() links a user to an external account. If a concurrent login
+// linked the account first, that link is kept and identity.UserID is set to
+// its user.
+func (m IdentityModel) Insert(identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (issuer, subject, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (issuer, subject) DO NOTHING
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, identity.Issuer, identity.Subject, identity.UserID)
+	if err != nil {
+		return err
+	}
+	// Read the link back in a statement of its own, whose snapshot sees a
+	// row committed by the other login
+	userID, err := m.GetUserID(identity.Issuer, identity.Subject)
+	if err != nil {
+		return err
+	}
+	identity.UserID = userID
+	return nil
+}
+
+// InsertLogin() stores a pending login. Only the hashes of the state and
+// the binding are kept.
+func (m IdentityModel) InsertLogin(login *OIDCLogin) error {
+	query := `
+		INSERT INTO oidc_logins (state_hash, binding_hash, code_verifier, nonce, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	stateHash := sha256.Sum256([]byte(login.State))
+	bindingHash := sha256.Sum256([]byte(login.Binding))
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, stateHash[:], bindingHash[:], login.CodeVerifier, login.Nonce, login.Expiry)
+	return err
+}
+
+// TakeLogin() removes and returns the pending login for a state value, so
+// that every state can only be used once. The binding must match the one
+// the login was started with. A login is left in place when it doesn't, so
+// that someone who only knows the state can't cancel it.
+func (m IdentityModel) TakeLogin(state, binding string) (*OIDCLogin, error) {
+	query := `
+		DELETE FROM oidc_logins
+		WHERE state_hash = $1 AND binding_hash = $2
+		RETURNING code_verifier, nonce, expiry
+	`
+	stateHash := sha256.Sum256([]byte(state))
+	bindingHash := sha256.Sum256([]byte(binding))
+	login := OIDCLogin{State: state, Binding: binding}
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, stateHash[:], bindingHash[:]).Scan(&login.CodeVerifier, &login.Nonce, &login.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if time.Now().After(login.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+	return &login, nil
+}
+
+// DeleteExpiredLogins() clears logins that were never completed
+func (m IdentityModel) DeleteExpiredLogins() error {
+	query := `
+		DELETE FROM oidc_logins
+		WHERE expiry < NOW()
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,160 @@
+// Filename: internal/data/imports.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Import job statuses
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportSucceeded = "succeeded"
+	ImportFailed    = "failed"
+)
+
+// An ImportJob tracks a CSV import running in the background. Errors are keyed
+// by the line number of the row, or "import" for the import as a whole, and
+// then by field.
+type ImportJob struct {
+	ID           int64                        `json:"id"`
+	UserID       int64                        `json:"-"`
+	WorkspaceID  int64                        `json:"workspace_id"`
+	Status       string                       `json:"status"`
+	TotalRows    int                          `json:"total_rows"`
+	ImportedRows int                          `json:"imported_rows"`
+	Errors       map[string]map[string]string `json:"errors"`
+	CreatedAt    time.Time                    `json:"created_at"`
+	FinishedAt   *time.Time                   `json:"finished_at"`
+}
+
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+// Insert() records a new pending job
+func (m ImportJobModel) Insert(job *ImportJob) error {
+	query := `
+		INSERT INTO import_jobs (user_id, workspace_id, total_rows)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, created_at
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	job.Errors = map[string]map[string]string{}
+	return m.DB.QueryRowContext(ctx, query, job.UserID, job.WorkspaceID, job.TotalRows).Scan(&job.ID, &job.Status, &job.CreatedAt)
+}
+
+// Get() returns a job started by the user
+func (m ImportJobModel) Get(id, userID int64) (*ImportJob, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, user_id, workspace_id, status, total_rows, imported_rows, errors, created_at, finished_at
+		FROM import_jobs
+		WHERE id = $1 AND user_id = $2
+	`
+	var job ImportJob
+	var errs []byte
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&job.ID,
+		&job.UserID,
+		&job.WorkspaceID,
+		&job.Status,
+		&job.TotalRows,
+		&job.ImportedRows,
+		&errs,
+		&job.CreatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	err = json.Unmarshal(errs, &job.Errors)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// SetRunning() marks a pending job as started. It returns ErrRecordNotFound
+// if the job isn't pending any more, e.g. because FailStale() gave up on it.
+func (m ImportJobModel) SetRunning(id int64) error {
+	query := `
+		UPDATE import_jobs
+		SET status = $2
+		WHERE id = $1 AND status = $3
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, ImportRunning, ImportPending)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// FailStale() marks the jobs that have been pending or running for longer
+// than the timeout as failed with the error, and returns how many there were.
+// The process running them must have stopped.
+func (m ImportJobModel) FailStale(timeout time.Duration, jobErrors map[string]map[string]string) (int64, error) {
+	errs, err := json.Marshal(jobErrors)
+	if err != nil {
+		return 0, err
+	}
+	query := `
+		UPDATE import_jobs
+		SET status = $1, errors = $2, finished_at = NOW()
+		WHERE status IN ($3, $4) AND created_at < NOW() - $5 * INTERVAL '1 second'
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, ImportFailed, errs, ImportPending, ImportRunning, timeout.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Finish() records the outcome of a job. A job that already has one keeps
+// it.
+func (m ImportJobModel) Finish(id int64, status string, importedRows int, rowErrors map[string]map[string]string) error {
+	errs, err := json.Marshal(rowErrors)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE import_jobs
+		SET status = $2, imported_rows = $3, errors = $4, finished_at = NOW()
+		WHERE id = $1 AND finished_at IS NULL
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, id, status, importedRows, errs)
+	return err
+}
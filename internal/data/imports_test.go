@@ -0,0 +1,62 @@
+// Filename: internal/data/imports_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/testdb"
+)
+
+// Jobs left pending or running by a stopped server are failed, and their
+// process can't start or finish them afterwards
+func TestImportJobFailStale(t *testing.T) {
+	models := NewModels(testdb.Open(t))
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := user.Password.Set("pa55word1234"); err != nil {
+		t.Fatal(err)
+	}
+	workspace := &Workspace{Name: "Alice", Personal: true}
+	if err := models.Users.InsertWithWorkspace(user, workspace); err != nil {
+		t.Fatal(err)
+	}
+	newJob := func() *ImportJob {
+		job := &ImportJob{UserID: user.ID, WorkspaceID: workspace.ID, TotalRows: 1}
+		if err := models.Imports.Insert(job); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	pending, running := newJob(), newJob()
+	if err := models.Imports.SetRunning(running.ID); err != nil {
+		t.Fatal(err)
+	}
+	interrupted := map[string]map[string]string{"import": {"error": "interrupted"}}
+
+	if n, err := models.Imports.FailStale(time.Hour, interrupted); err != nil || n != 0 {
+		t.Errorf("recent jobs: got %d, %v", n, err)
+	}
+	if n, err := models.Imports.FailStale(-time.Hour, interrupted); err != nil || n != 2 {
+		t.Errorf("stale jobs: got %d, %v", n, err)
+	}
+	for _, job := range []*ImportJob{pending, running} {
+		got, err := models.Imports.Get(job.ID, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != ImportFailed || got.FinishedAt == nil || got.Errors["import"]["error"] != "interrupted" {
+			t.Errorf("job %d: got %+v", job.ID, got)
+		}
+	}
+	if err := models.Imports.SetRunning(pending.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("starting a failed job: got %v", err)
+	}
+	if err := models.Imports.Finish(running.ID, ImportSucceeded, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := models.Imports.Get(running.ID, user.ID); got.Status != ImportFailed {
+		t.Errorf("finishing a failed job changed its status to %s", got.Status)
+	}
+}
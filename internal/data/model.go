@@ -13,13 +13,35 @@ var (
 )
 
 type Models struct {
-	Notes NoteModel
+	APIKeys     APIKeyModel
+	Checklists  ChecklistModel
+	Comments    CommentModel
+	Idempotency IdempotencyModel
+	Identities  IdentityModel
+	Imports     ImportJobModel
+	Lockouts    LoginThrottleModel
+	Notes       NoteModel
+	Tokens      TokenModel
+	TOTP        TOTPModel
+	Users       UserModel
+	Workspaces  WorkspaceModel
 }
 
 // NewModels() allows us to create a new MOdels 
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Notes: NoteModel{DB: db},
+		APIKeys:     APIKeyModel{DB: db},
+		Checklists:  ChecklistModel{DB: db},
+		Comments:    CommentModel{DB: db},
+		Idempotency: IdempotencyModel{DB: db},
+		Identities:  IdentityModel{DB: db},
+		Imports:     ImportJobModel{DB: db},
+		Lockouts:    LoginThrottleModel{DB: db},
+		Notes:       NoteModel{DB: db},
+		Tokens:      TokenModel{DB: db},
+		TOTP:        TOTPModel{DB: db},
+		Users:       UserModel{DB: db},
+		Workspaces:  WorkspaceModel{DB: db},
 	}
 } 
\ No newline at end of file
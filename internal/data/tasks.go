@@ -7,9 +7,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	"quiz3.desireamagwula.net/internal/query"
 	"quiz3.desireamagwula.net/internal/validator"
 )
 
@@ -22,6 +25,8 @@ type Note struct {
 	Priority    string    `json:"priority"`
 	Status      []string  `json:"status"`
 	Version     int32     `json:"version"`
+	// The line a note imported from todo.txt was read from, empty otherwise
+	TodoTxtLine string `json:"-"`
 	// ID        int64     `json:"id"`
 	// CreatedAt time.Time `json:"-"`
 	// Name      string    `json:"name"`
@@ -35,56 +40,178 @@ type Note struct {
 	// Version   int32     `json:"version"`
 }
 
+// NoteKeys names the keys ValidateNote() reports each field's errors under
+type NoteKeys struct {
+	TaskName    string
+	Description string
+	Category    string
+	Priority    string
+	Status      string
+}
+
+// LegacyNoteKeys are the keys version 1 of the API has always reported
+var LegacyNoteKeys = NoteKeys{
+	TaskName:    "name",
+	Description: "level",
+	Category:    "contact",
+	Priority:    "address",
+	Status:      "mode",
+}
+
+// FieldNoteKeys are the names of the fields in the request body
+var FieldNoteKeys = NoteKeys{
+	TaskName:    "task_name",
+	Description: "description",
+	Category:    "category",
+	Priority:    "priority",
+	Status:      "status",
+}
+
 func ValidateNote(v *validator.Validator, note *Note) {
+	ValidateNoteKeys(v, note, LegacyNoteKeys)
+}
+
+// ValidateNoteKeys() validates a note, reporting errors under the given keys
+func ValidateNoteKeys(v *validator.Validator, note *Note, keys NoteKeys) {
 	// Use the Check() Method to execute our validation checks
-	v.Check(note.Task_Name != "", "name", "must be provided")
-	v.Check(len(note.Task_Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(note.Task_Name != "", keys.TaskName, "must be provided")
+	v.Check(len(note.Task_Name) <= 200, keys.TaskName, "must not be more than 200 bytes long")
 
-	v.Check(note.Description != "", "level", "must be provided")
-	v.Check(len(note.Description) <= 200, "level", "must not be more than 200 bytes long")
+	v.Check(note.Description != "", keys.Description, "must be provided")
+	v.Check(len(note.Description) <= 200, keys.Description, "must not be more than 200 bytes long")
 
-	v.Check(note.Category != "", "contact", "must be provided")
-	v.Check(len(note.Category) <= 200, "contact", "must not be more than 200 bytes long")
+	v.Check(note.Category != "", keys.Category, "must be provided")
+	v.Check(len(note.Category) <= 200, keys.Category, "must not be more than 200 bytes long")
 
-	v.Check(note.Priority != "", "address", "must be provided")
-	v.Check(len(note.Priority) <= 500, "address", "must not be more than 200 bytes long")
+	v.Check(note.Priority != "", keys.Priority, "must be provided")
+	v.Check(len(note.Priority) <= 500, keys.Priority, "must not be more than 200 bytes long")
 
-	v.Check(note.Status != nil, "mode", "must be provided!")
-	v.Check(len(note.Status) >= 1, "mode", "must contain at least one entry")
-	v.Check(len(note.Status) <= 5, "mode", "must contain at most five entries")
-	v.Check(validator.Unique(note.Status), "mode", "must not contain duplicate entries")
+	v.Check(note.Status != nil, keys.Status, "must be provided!")
+	v.Check(len(note.Status) >= 1, keys.Status, "must contain at least one entry")
+	v.Check(len(note.Status) <= 5, keys.Status, "must contain at most five entries")
+	v.Check(validator.Unique(note.Status), keys.Status, "must not contain duplicate entries")
 
 }
 
+// sortValue() returns the value of a sort column as it is stored in a cursor
+func (note *Note) sortValue(column string) string {
+	switch column {
+	case "id":
+		return strconv.FormatInt(note.ID, 10)
+	case "task_name":
+		return note.Task_Name
+	case "description":
+		return note.Description
+	case "category":
+		return note.Category
+	case "priority":
+		return note.Priority
+	}
+	panic("unknown sort column: " + column)
+}
+
+// noteColumns lists the columns of a note in the order they are selected
+var noteColumns = []string{"id", "created_at", "task_name", "description", "category", "priority", "status", "version", "todotxt_line"}
+
+// scanDest() returns where to scan a column of a note
+func (note *Note) scanDest(column string) interface{} {
+	switch column {
+	case "id":
+		return &note.ID
+	case "created_at":
+		return &note.CreatedAt
+	case "task_name":
+		return &note.Task_Name
+	case "description":
+		return &note.Description
+	case "category":
+		return &note.Category
+	case "priority":
+		return &note.Priority
+	case "status":
+		return pq.Array(&note.Status)
+	case "version":
+		return &note.Version
+	case "todotxt_line":
+		return &note.TodoTxtLine
+	}
+	panic("unknown note column: " + column)
+}
+
 type NoteModel struct {
 	DB *sql.DB
 }
 
 // Insert() allows us to create a new note
 
-func (m NoteModel) Insert(note *Note) error {
+func (m NoteModel) Insert(t Tenant, note *Note) error {
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Cleanup to prevent memory leaks
+	defer cancel()
+	return withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return insertNote(ctx, tx, t, note)
+	})
+	//return m.DB.QueryRow(query, args...).Scan(&note.ID, &note.CreatedAt, &note.Version)
+}
+
+// insertNote() runs the insert of a note inside a transaction
+func insertNote(ctx context.Context, tx *sql.Tx, t Tenant, note *Note) error {
 	query := `
-		INSERT INTO notes (task_name, description, category, priority, status)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO notes (task_name, description, category, priority, status, workspace_id, todotxt_line)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at, version
 	`
 	// Collect the data fields into a slice
 	args := []interface{}{
 		note.Task_Name, note.Description,
 		note.Category, note.Priority,
-		pq.Array(note.Status),
+		pq.Array(note.Status), t.WorkspaceID,
+		note.TodoTxtLine,
 	}
-	// Create a context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	// Cleanup to prevent memory leaks
-	defer cancel()
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&note.ID, &note.CreatedAt, &note.Version)
-	//return m.DB.QueryRow(query, args...).Scan(&note.ID, &note.CreatedAt, &note.Version)
+	return tx.QueryRowContext(ctx, query, args...).Scan(&note.ID, &note.CreatedAt, &note.Version)
+}
+
+// A NoteFilter narrows a listing of notes. Task names and descriptions are
+// searched as text, category and priority match ignoring case, and the notes
+// must carry every status given. Zero values don't filter.
+type NoteFilter struct {
+	Task_Name     string
+	Description   string
+	Category      string
+	Priority      string
+	Status        []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// An expression from the query language, nil for none
+	Query query.Node
+}
+
+// NoteQueryFields are the fields the query language can search notes on
+var NoteQueryFields = map[string]query.Field{
+	"id":          {Column: "id", Kind: query.Integer},
+	"task_name":   {Column: "task_name", Kind: query.Text},
+	"description": {Column: "description", Kind: query.Text},
+	"category":    {Column: "category", Kind: query.Text},
+	"priority":    {Column: "priority", Kind: query.Text},
+	"status":      {Column: "status", Kind: query.TextArray},
+	"created":     {Column: "created_at", Kind: query.Timestamp},
 }
 
-// Get() allows us to retrieve
+func ValidateNoteFilter(v *validator.Validator, f NoteFilter) {
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() {
+		v.Check(f.CreatedAfter.Before(f.CreatedBefore), "created_after", "must be earlier than created_before")
+	}
+}
 
-func (m NoteModel) Get(id int64) (*Note, error) {
+// nullTime() passes the zero time to the database as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Get() allows us to retrieve a note from a workspace
+
+func (m NoteModel) Get(t Tenant, id int64) (*Note, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
@@ -92,7 +219,7 @@ func (m NoteModel) Get(id int64) (*Note, error) {
 	query := `
 		SELECT id, created_at, task_name, description, category, priority, status, version
 		FROM notes
-		WHERE id = $1
+		WHERE id = $1 AND workspace_id = $2
 	`
 	// Declare a note variable to hold the returned data
 	var note Note
@@ -101,16 +228,18 @@ func (m NoteModel) Get(id int64) (*Note, error) {
 	// Cleanup to prevent memory leaks
 	defer cancel()
 	// Execute the query using QueryRow()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&note.ID,
-		&note.CreatedAt,
-		&note.Task_Name,
-		&note.Description,
-		&note.Category,
-		&note.Priority,
-		pq.Array(&note.Status),
-		&note.Version,
-	)
+	err := withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, id, t.WorkspaceID).Scan(
+			&note.ID,
+			&note.CreatedAt,
+			&note.Task_Name,
+			&note.Description,
+			&note.Category,
+			&note.Priority,
+			pq.Array(&note.Status),
+			&note.Version,
+		)
+	})
 	// Handle any errors
 	if err != nil {
 		// Check the type of error
@@ -127,7 +256,18 @@ func (m NoteModel) Get(id int64) (*Note, error) {
 
 // Update() allows us to edit/alter a specific note
 
-func (m NoteModel) Update(note *Note) error {
+func (m NoteModel) Update(t Tenant, note *Note) error {
+	//Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	//Cleanup to prevent memory leaks
+	defer cancel()
+	return withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return updateNote(ctx, tx, t, note)
+	})
+}
+
+// updateNote() runs the update of a note inside a transaction
+func updateNote(ctx context.Context, tx *sql.Tx, t Tenant, note *Note) error {
 	// Create a query
 	query := `
 		UPDATE notes
@@ -135,6 +275,7 @@ func (m NoteModel) Update(note *Note) error {
 		    priority = $4, status = $5, version = version + 1
 		WHERE id = $6
 		AND version = $7
+		AND workspace_id = $8
 		RETURNING version
 	`
 	args := []interface{}{
@@ -145,14 +286,11 @@ func (m NoteModel) Update(note *Note) error {
 		pq.Array(&note.Status),
 		note.ID,
 		note.Version,
+		t.WorkspaceID,
 	}
 
-	//Create a context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	//Cleanup to prevent memory leaks
-	defer cancel()
 	// Check for edit conflicts
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&note.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&note.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -166,22 +304,32 @@ func (m NoteModel) Update(note *Note) error {
 }
 
 // Delete removes a specific note
-func (m NoteModel) Delete(id int64) error {
+func (m NoteModel) Delete(t Tenant, id int64, version int32) error {
 
 	if id < 1 {
 		return ErrRecordNotFound
 	}
-	// Create the delete query
-	query := `
-		DELETE FROM notes
-		WHERE id = $1
-	`
 	// Create a context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// Cleanup to prevent memory leaks
 	defer cancel()
+	return withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		return deleteNote(ctx, tx, t, id, version)
+	})
+}
+
+// deleteNote() runs the delete of a note inside a transaction. A version of
+// zero deletes the note whatever its version. Otherwise the note is only
+// deleted at that version, and ErrEditConflict is returned if it has another.
+func deleteNote(ctx context.Context, tx *sql.Tx, t Tenant, id int64, version int32) error {
+	// Create the delete query
+	query := `
+		DELETE FROM notes
+		WHERE id = $1 AND workspace_id = $2
+		AND ($3 = 0 OR version = $3)
+	`
 	// Execute the query
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, id, t.WorkspaceID, version)
 	if err != nil {
 		return err
 	}
@@ -191,63 +339,187 @@ func (m NoteModel) Delete(id int64) error {
 	if err != nil {
 		return err
 	}
-	// Check if no rows were affected
-	if rowsAffected == 0 {
+	if rowsAffected > 0 {
+		return nil
+	}
+	if version == 0 {
 		return ErrRecordNotFound
 	}
-	return nil
-
+	// Tell a note at another version apart from a missing one
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM notes WHERE id = $1 AND workspace_id = $2)`, id, t.WorkspaceID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrEditConflict
+	}
+	return ErrRecordNotFound
 }
-func (m NoteModel) GetAll(task_name string, description string, status []string, filters Filters) ([]*Note, Metadata, error) {
-	// Construct the query
-	query := fmt.Sprintf(`
-		SELECT COUNT (*) OVER(), id, created_at, task_name, description, category, priority, status, version
-		FROM notes
-		WHERE (to_tsvector('simple', task_name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (to_tsvector('simple', description) @@ plainto_tsquery('simple', $2) OR $2 = '')
-		AND (status @> $3 OR $3 = '{}' )
-		ORDER by %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortOrder())
-	// Create
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	args := []interface{}{task_name, description, pq.Array(status), filters.limit(), filters.offSet()}
-	// Execute the query
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+func (m NoteModel) GetAll(t Tenant, filter NoteFilter, filters Filters) ([]*Note, Metadata, error) {
+	query, args, columns, err := listQuery(t, filter, filters, "COUNT (*) OVER()", filters.limit(), filters.offSet())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
-	defer rows.Close()
+	// Create
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 	totalRecords := 0
 	// Initialize an empty slice
 	notes := []*Note{}
-	// iterate over the rows in the resultset
-	for rows.Next() {
-		var note Note
-		// SCan the valuies from the row into the note
-		err := rows.Scan(
-			&totalRecords,
-			&note.ID,
-			&note.CreatedAt,
-			&note.Task_Name,
-			&note.Description,
-			&note.Category,
-			&note.Priority,
-			pq.Array(&note.Status),
-			&note.Version,
-		)
+	err = withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		// Execute the query
+		rows, err := tx.QueryContext(ctx, query, args...)
 		if err != nil {
-			return nil, Metadata{}, err
+			return err
 		}
+		defer rows.Close()
+		// iterate over the rows in the resultset
+		for rows.Next() {
+			var note Note
+			// SCan the valuies from the row into the note
+			dest := []interface{}{&totalRecords}
+			for _, column := range columns {
+				dest = append(dest, note.scanDest(column))
+			}
+			err := rows.Scan(dest...)
+			if err != nil {
+				return err
+			}
 
-		notes = append(notes, &note)
+			notes = append(notes, &note)
 
-	}
-	// Check if any errors occured after looping through the resultset
-	if err = rows.Err(); err != nil {
+		}
+		// Check if any errors occured after looping through the resultset
+		return rows.Err()
+	})
+	if err != nil {
 		return nil, Metadata{}, err
 	}
+	if filters.UseCursor {
+		notes, metadata := calculateCursorMetadata(notes, filters)
+		return notes, metadata, nil
+	}
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 	// safely return the resultset
 	return notes, metadata, nil
 }
+
+// listQuery() builds the query that lists the notes matching the filters,
+// along with its arguments and the columns it selects after the extra
+// expression, if one is given. A nil limit means no limit.
+func listQuery(t Tenant, filter NoteFilter, filters Filters, extra string, limit interface{}, offset int) (string, []interface{}, []string, error) {
+	conditions, args, err := listConditions(filter, filters, limit, offset, t.WorkspaceID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	// Only select the requested fields. The id, version and sort column are
+	// always needed for ETags and cursors.
+	columns := []string{}
+	for _, column := range noteColumns {
+		if filters.HasField(column) || column == "id" || column == "version" || column == filters.sortColumn() {
+			columns = append(columns, column)
+		}
+	}
+	selectList := strings.Join(columns, ", ")
+	if extra != "" {
+		selectList = extra + ", " + selectList
+	}
+	// Construct the query
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM notes
+		WHERE workspace_id = $10
+		%s
+		ORDER by %s %s, id ASC
+		LIMIT $8 OFFSET $9`, selectList, conditions, filters.sortColumn(), filters.sortOrder())
+	return query, args, columns, nil
+}
+
+// listConditions() returns the conditions of a listing after the workspace
+// one, and the arguments they use. $8 and $9 hold the limit and offset, and
+// $10 holds the workspace, which GetAllForWorkspaces() passes as an array.
+func listConditions(filter NoteFilter, filters Filters, limit interface{}, offset int, workspace interface{}) (string, []interface{}, error) {
+	args := []interface{}{
+		filter.Task_Name, filter.Description, filter.Category, filter.Priority,
+		pq.Array(filter.Status), nullTime(filter.CreatedAfter), nullTime(filter.CreatedBefore),
+		limit, offset, workspace,
+	}
+	// In cursor mode skip the rows up to the cursor
+	keyset := "TRUE"
+	if filters.UseCursor && filters.Cursor != "" {
+		c, err := decodeCursor(filters.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, c.Value, c.ID)
+		keyset = filters.keysetCondition(len(args)-1, len(args))
+	}
+	// Add the condition compiled from the query language
+	expression := "TRUE"
+	if filter.Query != nil {
+		var queryArgs []interface{}
+		expression, queryArgs = query.Compile(filter.Query, len(args)+1)
+		args = append(args, queryArgs...)
+	}
+	conditions := fmt.Sprintf(`AND (to_tsvector('simple', task_name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (to_tsvector('simple', description) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (LOWER(category) = LOWER($3) OR $3 = '')
+		AND (LOWER(priority) = LOWER($4) OR $4 = '')
+		AND (status @> $5 OR $5 = '{}' )
+		AND (created_at > $6 OR $6 IS NULL)
+		AND (created_at < $7 OR $7 IS NULL)
+		AND %s
+		AND %s`, keyset, expression)
+	return conditions, args, nil
+}
+
+// The number of rows Export() fetches from its cursor at a time
+const exportBatchSize = 500
+
+// Export() calls fn for every note matching the filters, without pagination.
+// The rows are read through a server-side cursor a batch at a time so memory
+// use doesn't grow with the number of notes. The context bounds the export.
+func (m NoteModel) Export(ctx context.Context, t Tenant, filter NoteFilter, filters Filters, fn func(note *Note) error) error {
+	query, args, columns, err := listQuery(t, filter, filters, "", nil, 0)
+	if err != nil {
+		return err
+	}
+	return withTenant(ctx, m.DB, t, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DECLARE notes_export NO SCROLL CURSOR FOR "+query, args...)
+		if err != nil {
+			return err
+		}
+		for {
+			rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM notes_export", exportBatchSize))
+			if err != nil {
+				return err
+			}
+			fetched := 0
+			for rows.Next() {
+				fetched++
+				var note Note
+				dest := []interface{}{}
+				for _, column := range columns {
+					dest = append(dest, note.scanDest(column))
+				}
+				err = rows.Scan(dest...)
+				if err == nil {
+					err = fn(&note)
+				}
+				if err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return err
+			}
+			if fetched < exportBatchSize {
+				return nil
+			}
+		}
+	})
+}
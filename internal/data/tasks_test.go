@@ -0,0 +1,53 @@
+// Filename: internal/data/tasks_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"quiz3.desireamagwula.net/internal/query"
+)
+
+// Only the listed fields can be searched, so an expression can't reach
+// columns such as workspace_id that scope the listing
+func TestNoteQueryFields(t *testing.T) {
+	for _, input := range []string{"task_name:x", "DESCRIPTION:~x", "status:todo", "id:>3", "created:<2024-01-01"} {
+		if _, err := query.Parse(input, NoteQueryFields); err != nil {
+			t.Errorf("Parse(%q): %v", input, err)
+		}
+	}
+	for _, input := range []string{"workspace_id:1", "user_id:1", "version:1", "created_at:>2024-01-01", "notes.id:1"} {
+		if _, err := query.Parse(input, NoteQueryFields); err == nil {
+			t.Errorf("Parse(%q) was accepted", input)
+		}
+	}
+}
+
+// A delete at a version doesn't remove a Note that was updated after the
+// version was read
+func TestDeleteAtVersion(t *testing.T) {
+	f := newTenantFixture(t)
+	note, err := f.models.Notes.Get(f.alice, f.aliceNotes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := note.Version
+	note.Priority = "high"
+	if err := f.models.Notes.Update(f.alice, note); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.models.Notes.Delete(f.alice, note.ID, read); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("delete at the old version: got %v, want ErrEditConflict", err)
+	}
+	if err := f.models.Notes.Delete(f.alice, note.ID, note.Version); err != nil {
+		t.Errorf("delete at the current version: %v", err)
+	}
+	if err := f.models.Notes.Delete(f.alice, note.ID, note.Version); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("delete of a deleted Note: got %v, want ErrRecordNotFound", err)
+	}
+	// Another workspace's Note is missing, not conflicting
+	if err := f.models.Notes.Delete(f.alice, f.bobNotes[0], 99); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("delete of another workspace's Note: got %v, want ErrRecordNotFound", err)
+	}
+}
@@ -0,0 +1,38 @@
+// Filename: internal/data/tenant.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// A Tenant identifies who is acting and in which workspace. Queries on tenant
+// data filter on the workspace themselves, and are additionally run in a
+// transaction that sets app.user_id so that the row level security policies in
+// the database hide rows from other workspaces if a filter is ever forgotten.
+type Tenant struct {
+	UserID      int64
+	WorkspaceID int64
+}
+
+// withTenant() runs fn inside a transaction scoped to the tenant's user
+func withTenant(ctx context.Context, db *sql.DB, t Tenant, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+	// set_config() with is_local = true behaves like SET LOCAL but accepts parameters
+	_, err = tx.ExecContext(ctx, `SELECT set_config('app.user_id', $1, true)`, strconv.FormatInt(t.UserID, 10))
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
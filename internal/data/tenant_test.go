@@ -0,0 +1,183 @@
+// Filename: internal/data/tenant_test.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/testdb"
+)
+
+// tenantFixture has two users, each with a personal workspace holding Notes
+type tenantFixture struct {
+	db         *sql.DB
+	models     Models
+	alice, bob Tenant
+	// The ids of the Notes in each workspace
+	aliceNotes, bobNotes []int64
+}
+
+func newTenantFixture(t *testing.T) *tenantFixture {
+	t.Helper()
+	db := testdb.Open(t)
+	f := &tenantFixture{db: db, models: NewModels(db)}
+	newTenant := func(name string, notes int) (Tenant, []int64) {
+		user := &User{Name: name, Email: strings.ToLower(name) + "@example.com"}
+		if err := user.Password.Set("pa55word1234"); err != nil {
+			t.Fatal(err)
+		}
+		workspace := &Workspace{Name: name, Personal: true}
+		if err := f.models.Users.InsertWithWorkspace(user, workspace); err != nil {
+			t.Fatal(err)
+		}
+		tenant := Tenant{UserID: user.ID, WorkspaceID: workspace.ID}
+		ids := []int64{}
+		for i := 0; i < notes; i++ {
+			note := &Note{Task_Name: name, Description: "d", Category: "c", Priority: "low", Status: []string{"todo"}}
+			if err := f.models.Notes.Insert(tenant, note); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, note.ID)
+		}
+		return tenant, ids
+	}
+	f.alice, f.aliceNotes = newTenant("Alice", 2)
+	f.bob, f.bobNotes = newTenant("Bob", 1)
+	return f
+}
+
+// visibleIDs() runs a query without any filter as the tenant and returns
+// the ids it can see
+func (f *tenantFixture) visibleIDs(t *testing.T, tenant Tenant) []int64 {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	ids := []int64{}
+	err := withTenant(ctx, f.db, tenant, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM notes ORDER BY id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	a = append([]int64{}, a...)
+	b = append([]int64{}, b...)
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A query that forgets to filter on the workspace only sees the Notes of
+// the workspaces the user belongs to
+func TestRowLevelSecurityHidesOtherTenants(t *testing.T) {
+	f := newTenantFixture(t)
+	if got := f.visibleIDs(t, f.alice); !equalIDs(got, f.aliceNotes) {
+		t.Errorf("alice sees %v, want %v", got, f.aliceNotes)
+	}
+	if got := f.visibleIDs(t, f.bob); !equalIDs(got, f.bobNotes) {
+		t.Errorf("bob sees %v, want %v", got, f.bobNotes)
+	}
+	// A user who isn't in any workspace sees nothing
+	if got := f.visibleIDs(t, Tenant{UserID: f.bob.UserID + 1000}); len(got) != 0 {
+		t.Errorf("a stranger sees %v, want nothing", got)
+	}
+}
+
+// Without app.user_id nothing is visible, and the setting doesn't outlive
+// the transaction that set it
+func TestRowLevelSecurityWithoutTenant(t *testing.T) {
+	f := newTenantFixture(t)
+	// One connection, so the query below reuses the tenant's connection
+	f.db.SetMaxOpenConns(1)
+	f.visibleIDs(t, f.alice)
+	var count int
+	if err := f.db.QueryRow(`SELECT COUNT(*) FROM notes`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("a query without a tenant sees %d Notes, want 0", count)
+	}
+}
+
+// Unfiltered updates and deletes only touch the tenant's own rows, and rows
+// can't be written into another workspace
+func TestRowLevelSecurityOnWrites(t *testing.T) {
+	f := newTenantFixture(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var updated, deleted int64
+	err := withTenant(ctx, f.db, f.bob, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE notes SET priority = 'high'`)
+		if err != nil {
+			return err
+		}
+		updated, _ = result.RowsAffected()
+		result, err = tx.ExecContext(ctx, `DELETE FROM notes`)
+		if err != nil {
+			return err
+		}
+		deleted, _ = result.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != int64(len(f.bobNotes)) || deleted != int64(len(f.bobNotes)) {
+		t.Errorf("updated %d and deleted %d rows, want %d", updated, deleted, len(f.bobNotes))
+	}
+	for _, id := range f.aliceNotes {
+		note, err := f.models.Notes.Get(f.alice, id)
+		if err != nil {
+			t.Fatalf("alice's Note %d: %v", id, err)
+		}
+		if note.Priority != "low" {
+			t.Errorf("alice's Note %d has priority %q, want low", id, note.Priority)
+		}
+	}
+
+	// Bob can't insert into Alice's workspace, or move a Note into it
+	intruder := Tenant{UserID: f.bob.UserID, WorkspaceID: f.alice.WorkspaceID}
+	note := &Note{Task_Name: "x", Description: "d", Category: "c", Priority: "low", Status: []string{"todo"}}
+	if err := f.models.Notes.Insert(intruder, note); err == nil || !strings.Contains(err.Error(), "row-level security") {
+		t.Errorf("inserting into another workspace: got %v, want a row level security error", err)
+	}
+	own := &Note{Task_Name: "y", Description: "d", Category: "c", Priority: "low", Status: []string{"todo"}}
+	if err := f.models.Notes.Insert(f.bob, own); err != nil {
+		t.Fatal(err)
+	}
+	err = withTenant(ctx, f.db, f.bob, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE notes SET workspace_id = $1 WHERE id = $2`, f.alice.WorkspaceID, own.ID)
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "row-level security") {
+		t.Errorf("moving a Note into another workspace: got %v, want a row level security error", err)
+	}
+}
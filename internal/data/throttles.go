@@ -0,0 +1,190 @@
+// Filename: internal/data/throttles.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A ThrottlePolicy decides when repeated failures lock a key. Each failure
+// past the threshold doubles the lock, up to the maximum. Failures are
+// forgotten once none happened for the reset period.
+type ThrottlePolicy struct {
+	Threshold   int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	ResetAfter  time.Duration
+}
+
+// Login throttling policies
+var (
+	AccountThrottle = ThrottlePolicy{Threshold: 5, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: 24 * time.Hour}
+	IPThrottle      = ThrottlePolicy{Threshold: 20, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: 24 * time.Hour}
+)
+
+// AccountThrottleKey() and IPThrottleKey() build the keys failures are counted under
+func AccountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+// LockedUntil() returns the latest lock that is still in force on any of the
+// keys, or the zero time if none of them is locked
+func (m LoginThrottleModel) LockedUntil(keys ...string) (time.Time, error) {
+	query := `
+		SELECT MAX(locked_until)
+		FROM login_throttles
+		WHERE key = ANY($1) AND locked_until > NOW()
+	`
+	var lockedUntil sql.NullTime
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, pq.Array(keys)).Scan(&lockedUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+// Attempt() counts a login attempt against a key before the password is
+// checked, and locks the key once the attempts reach the threshold. Counting
+// and checking the lock happen in one statement, so parallel guesses can't
+// get past the threshold. If the key was already locked the attempt isn't
+// counted, and the lock is returned. Otherwise the zero time is returned.
+func (m LoginThrottleModel) Attempt(key string, policy ThrottlePolicy) (time.Time, error) {
+	// The count restarts once the reset period has passed without failures
+	reset := `
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES ($1, 0, NOW())
+		ON CONFLICT (key) DO UPDATE
+		SET failures = 0, last_failure_at = NOW()
+		WHERE login_throttles.last_failure_at < NOW() - $2 * interval '1 second'
+		AND (login_throttles.locked_until IS NULL OR login_throttles.locked_until <= NOW())
+	`
+	// The lock after n attempts is the entry for n in the schedule
+	update := `
+		UPDATE login_throttles
+		SET failures = failures + 1,
+		    last_failure_at = NOW(),
+		    locked_until = CASE
+		        WHEN failures + 1 >= $2
+		        THEN NOW() + ($3::bigint[])[LEAST(failures + 2 - $2, cardinality($3::bigint[]))] * interval '1 second'
+		    END
+		WHERE key = $1 AND (locked_until IS NULL OR locked_until <= NOW())
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, reset, key, policy.ResetAfter.Seconds())
+	if err != nil {
+		return time.Time{}, err
+	}
+	result, err := m.DB.ExecContext(ctx, update, key, policy.Threshold, pq.Array(policy.schedule()))
+	if err != nil {
+		return time.Time{}, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rowsAffected > 0 {
+		return time.Time{}, nil
+	}
+	// The key is locked
+	lockedUntil, err := m.LockedUntil(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// The lock ran out since the update, so refuse this attempt for the
+	// remaining moment rather than letting it through uncounted
+	if lockedUntil.IsZero() {
+		lockedUntil = time.Now().Add(time.Second)
+	}
+	return lockedUntil, nil
+}
+
+// Forgive() takes back an attempt that turned out to be a successful login,
+// along with any lock that attempt set
+func (m LoginThrottleModel) Forgive(key string, policy ThrottlePolicy) error {
+	query := `
+		UPDATE login_throttles
+		SET failures = GREATEST(failures - 1, 0),
+		    locked_until = CASE WHEN failures - 1 < $2 THEN NULL ELSE locked_until END
+		WHERE key = $1
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, key, policy.Threshold)
+	return err
+}
+
+// lockout() works out the lock duration after a number of failures
+func (p ThrottlePolicy) lockout(failures int) time.Duration {
+	lockout := p.BaseLockout
+	for i := p.Threshold; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+	return lockout
+}
+
+// schedule() lists the lockouts in seconds from the threshold onwards, up
+// to the first that reaches the maximum, which applies from then on
+func (p ThrottlePolicy) schedule() []int64 {
+	seconds := []int64{}
+	for failures := p.Threshold; ; failures++ {
+		lockout := p.lockout(failures)
+		seconds = append(seconds, int64(lockout.Seconds()))
+		if lockout >= p.MaxLockout || lockout <= 0 {
+			return seconds
+		}
+	}
+}
+
+// DeleteStale() forgets the keys that have no lock in force and whose
+// failures are older than the reset period. Most of them were counted for
+// mistyped or unknown addresses.
+func (m LoginThrottleModel) DeleteStale(resetAfter time.Duration) (int64, error) {
+	query := `
+		DELETE FROM login_throttles
+		WHERE last_failure_at < NOW() - $1 * interval '1 second'
+		AND (locked_until IS NULL OR locked_until <= NOW())
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, resetAfter.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Clear() forgets the failures of a key
+func (m LoginThrottleModel) Clear(key string) error {
+	query := `
+		DELETE FROM login_throttles
+		WHERE key = $1
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, key)
+	return err
+}
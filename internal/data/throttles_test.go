@@ -0,0 +1,171 @@
+// Filename: internal/data/throttles_test.go
+
+package data
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/testdb"
+)
+
+func TestThrottleLockout(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{7, 4 * time.Minute},
+		{10, 32 * time.Minute},
+		{11, time.Hour},
+		{12, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := AccountThrottle.lockout(tt.failures); got != tt.want {
+			t.Errorf("lockout(%d): got %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleSchedule(t *testing.T) {
+	tests := []struct {
+		policy ThrottlePolicy
+		want   []int64
+	}{
+		{AccountThrottle, []int64{60, 120, 240, 480, 960, 1920, 3600}},
+		{ThrottlePolicy{Threshold: 1, BaseLockout: time.Hour, MaxLockout: time.Hour}, []int64{3600}},
+		{ThrottlePolicy{Threshold: 3, BaseLockout: 10 * time.Second, MaxLockout: 40 * time.Second}, []int64{10, 20, 40}},
+		// A lock that doesn't grow still ends the schedule
+		{ThrottlePolicy{Threshold: 3, MaxLockout: time.Hour}, []int64{0}},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.schedule(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("schedule of %+v: got %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+// Attempts made at the same time can't get past the threshold
+func TestThrottleParallelAttempts(t *testing.T) {
+	models := NewModels(testdb.Open(t))
+	policy := ThrottlePolicy{Threshold: 5, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}
+	var (
+		wg               sync.WaitGroup
+		mu               sync.Mutex
+		allowed, refused int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lockedUntil, err := models.Lockouts.Attempt("email:alice@example.com", policy)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				t.Error(err)
+			case lockedUntil.IsZero():
+				allowed++
+			default:
+				refused++
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != policy.Threshold || refused != 20-policy.Threshold {
+		t.Errorf("got %d allowed and %d refused, want %d allowed", allowed, refused, policy.Threshold)
+	}
+}
+
+func TestThrottleLocksGrow(t *testing.T) {
+	db := testdb.Open(t)
+	models := NewModels(db)
+	policy := ThrottlePolicy{Threshold: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}
+	key := "ip:192.0.2.1"
+	for i := 0; i < 2; i++ {
+		if lockedUntil, err := models.Lockouts.Attempt(key, policy); err != nil || !lockedUntil.IsZero() {
+			t.Fatalf("attempt %d: got %v, %v", i+1, lockedUntil, err)
+		}
+	}
+	lockedUntil, err := models.Lockouts.Attempt(key, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(lockedUntil); d < 55*time.Second || d > 65*time.Second {
+		t.Errorf("first lock: got %v, want about a minute", d)
+	}
+	// Once the lock runs out the next attempt doubles it
+	if _, err := db.Exec(`UPDATE login_throttles SET locked_until = NOW() - interval '1 second' WHERE key = $1`, key); err != nil {
+		t.Fatal(err)
+	}
+	if lockedUntil, err := models.Lockouts.Attempt(key, policy); err != nil || !lockedUntil.IsZero() {
+		t.Fatalf("attempt after the lock: got %v, %v", lockedUntil, err)
+	}
+	lockedUntil, err = models.Lockouts.Attempt(key, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(lockedUntil); d < 115*time.Second || d > 125*time.Second {
+		t.Errorf("second lock: got %v, want about two minutes", d)
+	}
+}
+
+func TestThrottleForgiveAndSweep(t *testing.T) {
+	db := testdb.Open(t)
+	models := NewModels(db)
+	policy := ThrottlePolicy{Threshold: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}
+	// A successful login takes back the attempt that locked the key
+	for i := 0; i < 2; i++ {
+		if _, err := models.Lockouts.Attempt("ip:192.0.2.1", policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.Lockouts.Forgive("ip:192.0.2.1", policy); err != nil {
+		t.Fatal(err)
+	}
+	if lockedUntil, err := models.Lockouts.LockedUntil("ip:192.0.2.1"); err != nil || !lockedUntil.IsZero() {
+		t.Errorf("after forgiving: got %v, %v, want no lock", lockedUntil, err)
+	}
+
+	// Keys past the reset period go, unless a lock is still in force
+	if _, err := models.Lockouts.Attempt("email:nobody@example.com", policy); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`
+		INSERT INTO login_throttles (key, failures, last_failure_at, locked_until)
+		VALUES ('email:locked@example.com', 9, NOW() - interval '2 hours', NOW() + interval '1 hour')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE login_throttles SET last_failure_at = NOW() - interval '2 hours' WHERE key = 'email:nobody@example.com'`); err != nil {
+		t.Fatal(err)
+	}
+	n, err := models.Lockouts.DeleteStale(policy.ResetAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d deleted, want 1", n)
+	}
+	var keys []string
+	rows, err := db.Query(`SELECT key FROM login_throttles ORDER BY key`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	if want := []string{"email:locked@example.com", "ip:192.0.2.1"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got keys %v, want %v", keys, want)
+	}
+}
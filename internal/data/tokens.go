@@ -0,0 +1,262 @@
+// Filename: internal/data/tokens.go
+
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"time"
+
+	"github.com/lib/pq"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+// Token scopes
+const (
+	ScopeAuthentication = "authentication"
+	// A two-factor token proves the password was checked and is traded for an
+	// authentication token once a one-time code is given
+	ScopeTwoFactor = "two-factor"
+	// A browser session token lives in an HttpOnly cookie
+	ScopeBrowserSession = "browser-session"
+	// A calendar feed token is part of the secret URL of a user's calendar
+	// feed. It grants nothing else.
+	ScopeCalendarFeed = "calendar-feed"
+)
+
+// SessionScopes lists the scopes of tokens that represent a login
+var SessionScopes = []string{ScopeAuthentication, ScopeBrowserSession}
+
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+	UserAgent string    `json:"-"`
+	IP        string    `json:"-"`
+	CSRFToken string    `json:"csrf_token,omitempty"`
+	CSRFHash  []byte    `json:"-"`
+}
+
+// A Session describes an authentication token without revealing it
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	Browser    bool       `json:"browser"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+}
+
+// generateToken() creates a random token and its hash
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+	// Fill a byte slice with random bytes
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	// Encode the random bytes to a base32 string
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+	return token, nil
+}
+
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// New() generates and stores a new token
+func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(token)
+	return token, err
+}
+
+// NewSession() generates and stores an authentication token along with
+// details of the client it was issued to
+func (m TokenModel) NewSession(userID int64, ttl time.Duration, userAgent, ip string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	token.UserAgent = userAgent
+	token.IP = ip
+	err = m.Insert(token)
+	return token, err
+}
+
+// NewBrowserSession() generates and stores a browser session token along
+// with its CSRF token
+func (m TokenModel) NewBrowserSession(userID int64, ttl time.Duration, userAgent, ip string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeBrowserSession)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := generateToken(userID, ttl, ScopeBrowserSession)
+	if err != nil {
+		return nil, err
+	}
+	token.UserAgent = userAgent
+	token.IP = ip
+	token.CSRFToken = csrf.Plaintext
+	token.CSRFHash = csrf.Hash
+	err = m.Insert(token)
+	return token, err
+}
+
+// CheckCSRF() checks the CSRF token sent along with a browser session
+func (m TokenModel) CheckCSRF(tokenPlaintext, csrfPlaintext string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM tokens
+			WHERE hash = $1 AND scope = $2 AND csrf_hash = $3
+		)
+	`
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	csrfHash := sha256.Sum256([]byte(csrfPlaintext))
+	var ok bool
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeBrowserSession, csrfHash[:]).Scan(&ok)
+	return ok, err
+}
+
+// DeleteToken() removes a single token
+func (m TokenModel) DeleteToken(scope, tokenPlaintext string) error {
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2
+	`
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:], scope)
+	return err
+}
+
+// Insert() stores a token in the tokens table
+func (m TokenModel) Insert(token *Token) error {
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip, csrf_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP, token.CSRFHash}
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteAllForUser() removes every token of a scope belonging to a user
+func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND user_id = $2
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	return err
+}
+
+// GetSessionsForUser() lists the unexpired login tokens of a user
+func (m TokenModel) GetSessionsForUser(userID int64) ([]*Session, error) {
+	query := `
+		SELECT id, created_at, last_used_at, expiry, scope = 'browser-session', user_agent, ip
+		FROM tokens
+		WHERE user_id = $1 AND scope = ANY($2) AND expiry > NOW()
+		ORDER BY created_at DESC, id DESC
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(SessionScopes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.Browser,
+			&session.UserAgent,
+			&session.IP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteSessionForUser() revokes one login token of a user
+func (m TokenModel) DeleteSessionForUser(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM tokens
+		WHERE id = $1 AND user_id = $2 AND scope = ANY($3)
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID, pq.Array(SessionScopes))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllSessionsForUser() revokes every login token of a user
+func (m TokenModel) DeleteAllSessionsForUser(userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = ANY($1) AND user_id = $2
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(SessionScopes), userID)
+	return err
+}
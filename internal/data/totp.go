@@ -0,0 +1,231 @@
+// Filename: internal/data/totp.go
+
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Codes are refused after this many failures in a row, until the lockout ends
+const (
+	TOTPMaxFailedAttempts = 5
+	TOTPLockoutDuration   = 15 * time.Minute
+)
+
+type TOTP struct {
+	UserID         int64      `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Secret         string     `json:"-"`
+	Enabled        bool       `json:"enabled"`
+	LastUsedStep   int64      `json:"-"`
+	FailedAttempts int        `json:"-"`
+	LockedUntil    *time.Time `json:"-"`
+}
+
+// IsLocked() checks if too many wrong codes were entered recently
+func (t *TOTP) IsLocked() bool {
+	return t.LockedUntil != nil && t.LockedUntil.After(time.Now())
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+// Get() retrieves the two-factor settings of a user
+func (m TOTPModel) Get(userID int64) (*TOTP, error) {
+	query := `
+		SELECT user_id, created_at, secret, enabled, last_used_step, failed_attempts, locked_until
+		FROM user_totp
+		WHERE user_id = $1
+	`
+	var t TOTP
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&t.UserID,
+		&t.CreatedAt,
+		&t.Secret,
+		&t.Enabled,
+		&t.LastUsedStep,
+		&t.FailedAttempts,
+		&t.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// Enroll() stores a new, not yet confirmed secret. Enrolling again before
+// confirming replaces the secret. Enabled settings are never replaced.
+func (m TOTPModel) Enroll(userID int64, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0,
+		    failed_attempts = 0, locked_until = NULL
+		WHERE user_totp.enabled = false
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+// UseStep() records a successful code. It fails if a code of the same or a
+// later time step was already used, so that a code cannot be replayed.
+func (m TOTPModel) UseStep(userID int64, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2, failed_attempts = 0, locked_until = NULL
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Enable() records the first successful code like UseStep(), and enables
+// two-factor authentication along with a new set of recovery codes. Both
+// happen in one transaction, so 2FA is never enabled without recovery codes.
+// No codes are returned if the step was already used.
+func (m TOTPModel) Enable(userID int64, step int64, recoveryCodes int) ([]string, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2, failed_attempts = 0, locked_until = NULL, enabled = true
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected != 1 {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// RecordFailure() counts a wrong code and locks two-factor login once the
+// limit is reached
+func (m TOTPModel) RecordFailure(userID int64) error {
+	query := `
+		UPDATE user_totp
+		SET failed_attempts = failed_attempts + 1,
+		    locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_until END
+		WHERE user_id = $1
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, TOTPMaxFailedAttempts, time.Now().Add(TOTPLockoutDuration))
+	return err
+}
+
+// ResetFailures() clears the failure count after a successful login
+func (m TOTPModel) ResetFailures(userID int64) error {
+	query := `
+		UPDATE user_totp
+		SET failed_attempts = 0, locked_until = NULL
+		WHERE user_id = $1
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// replaceRecoveryCodes() generates the codes and swaps them in within tx
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		codes[i] = code[:8] + "-" + code[8:]
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		hash := sha256.Sum256([]byte(code))
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (hash, user_id) VALUES ($1, $2)`, hash[:], userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode() spends a recovery code. Each code works once.
+func (m TOTPModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	query := `
+		UPDATE user_recovery_codes
+		SET used_at = NOW()
+		WHERE hash = $1 AND user_id = $2 AND used_at IS NULL
+	`
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, hash[:], userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
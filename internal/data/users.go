@@ -0,0 +1,278 @@
+// Filename: internal/data/users.go
+
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+var (
+	ErrDuplicateEmail = errors.New("duplicate email")
+)
+
+// AnonymousUser represents a client that did not authenticate
+var AnonymousUser = &User{}
+
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	IsAdmin   bool      `json:"-"`
+	Version   int       `json:"-"`
+}
+
+// IsAnonymous() checks if a user is the anonymous user
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// The password type holds the plaintext password and its hash
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+// Set() stores the hash of a plaintext password
+func (p *password) Set(plaintextPassword string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	if err != nil {
+		return err
+	}
+	p.plaintext = &plaintextPassword
+	p.hash = hash
+	return nil
+}
+
+// Matches() checks if the plaintext password matches the stored hash
+func (p *password) Matches(plaintextPassword string) (bool, error) {
+	// Users created through single sign-on have no password
+	if p.hash == nil {
+		return false, nil
+	}
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	ValidateEmail(v, user.Email)
+	// Validate the plaintext password if one was set
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+	// A missing hash is a bug in our code, not a client error. Single sign-on
+	// users are validated with ValidateExternalUser() instead.
+	if user.Password.hash == nil {
+		panic("missing password hash for user")
+	}
+}
+
+// ValidateExternalUser() validates a user created through single sign-on
+func ValidateExternalUser(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+	ValidateEmail(v, user.Email)
+}
+
+type UserModel struct {
+	DB *sql.DB
+}
+
+// Insert() creates a new user
+func (m UserModel) Insert(user *User) error {
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// InsertWithWorkspace() creates a user along with their personal workspace.
+// Both are created in one transaction so that a user is never left without
+// a personal workspace. Shared workspaces left without members are given to
+// the user in the same transaction.
+func (m UserModel) InsertWithWorkspace(user *User, workspace *Workspace) error {
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	err = insertWorkspace(ctx, tx, workspace, user.ID)
+	if err != nil {
+		return err
+	}
+	err = claimOrphanedWorkspaces(ctx, tx, user.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertUser(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `
+		INSERT INTO users (name, email, password_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+	`
+	args := []interface{}{user.Name, user.Email, user.Password.hash}
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() retrieves a user by ID
+func (m UserModel) Get(id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, is_admin, version
+		FROM users
+		WHERE id = $1
+	`
+	var user User
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.IsAdmin,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetByEmail() retrieves a user by their email address
+func (m UserModel) GetByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, is_admin, version
+		FROM users
+		WHERE email = $1
+	`
+	var user User
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.IsAdmin,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetForToken() retrieves the user that owns a valid token of the given scope
+func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	// Record the use of the token as it is looked up
+	query := `
+		WITH token AS (
+			UPDATE tokens
+			SET last_used_at = NOW()
+			WHERE hash = $1
+			AND scope = $2
+			AND expiry > $3
+			RETURNING user_id
+		)
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.is_admin, users.version
+		FROM users
+		INNER JOIN token
+		ON users.id = token.user_id
+	`
+	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
+	var user User
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.IsAdmin,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
@@ -0,0 +1,329 @@
+// Filename: internal/data/workspaces.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/validator"
+)
+
+var (
+	ErrDuplicateMember = errors.New("duplicate member")
+)
+
+// Workspace roles, from the most to the least privileged
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+// RoleList holds the valid roles ordered by privilege
+var RoleList = []string{RoleViewer, RoleMember, RoleAdmin, RoleOwner}
+
+// RoleAtLeast() checks if a role grants at least the privileges of min
+func RoleAtLeast(role, min string) bool {
+	rank := func(r string) int {
+		for i := range RoleList {
+			if RoleList[i] == r {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(role) >= rank(min) && rank(min) >= 0
+}
+
+type Workspace struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Personal  bool      `json:"personal"`
+	Role      string    `json:"role,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+type Member struct {
+	WorkspaceID int64     `json:"workspace_id"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func ValidateWorkspace(v *validator.Validator, workspace *Workspace) {
+	v.Check(workspace.Name != "", "name", "must be provided")
+	v.Check(len(workspace.Name) <= 200, "name", "must not be more than 200 bytes long")
+}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(role != "", "role", "must be provided")
+	v.Check(validator.In(role, RoleAdmin, RoleMember, RoleViewer), "role", "must be one of admin, member or viewer")
+}
+
+type WorkspaceModel struct {
+	DB *sql.DB
+}
+
+// Insert() creates a workspace and makes the user its owner
+func (m WorkspaceModel) Insert(workspace *Workspace, ownerID int64) error {
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	// The workspace and its owner are created together
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = insertWorkspace(ctx, tx, workspace, ownerID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertWorkspace(ctx context.Context, tx *sql.Tx, workspace *Workspace, ownerID int64) error {
+	query := `
+		INSERT INTO workspaces (name, personal)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version
+	`
+	err := tx.QueryRowContext(ctx, query, workspace.Name, workspace.Personal).Scan(
+		&workspace.ID, &workspace.CreatedAt, &workspace.Version)
+	if err != nil {
+		return err
+	}
+	query = `
+		INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`
+	_, err = tx.ExecContext(ctx, query, workspace.ID, ownerID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	workspace.Role = RoleOwner
+	return nil
+}
+
+// claimOrphanedWorkspaces() makes the user the owner of every shared
+// workspace that has no members. The Default workspace that 000006 creates
+// for the notes from before workspaces has none, since there are no users
+// yet when it runs, so the first account to register takes it over. The
+// lock makes concurrent registrations claim one after the other.
+func claimOrphanedWorkspaces(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('claim_orphaned_workspaces'))`)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO workspace_members (workspace_id, user_id, role)
+		SELECT w.id, $1, $2
+		FROM workspaces w
+		WHERE NOT w.personal
+		AND NOT EXISTS (SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = w.id)
+	`
+	_, err = tx.ExecContext(ctx, query, userID, RoleOwner)
+	return err
+}
+
+// GetForMember() retrieves a workspace along with the role the user holds in it.
+// Workspaces the user does not belong to are reported as not found.
+func (m WorkspaceModel) GetForMember(id int64, userID int64) (*Workspace, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT w.id, w.created_at, w.name, w.personal, w.version, wm.role
+		FROM workspaces w
+		INNER JOIN workspace_members wm
+		ON wm.workspace_id = w.id
+		WHERE w.id = $1 AND wm.user_id = $2
+	`
+	var workspace Workspace
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&workspace.ID,
+		&workspace.CreatedAt,
+		&workspace.Name,
+		&workspace.Personal,
+		&workspace.Version,
+		&workspace.Role,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &workspace, nil
+}
+
+// GetPersonal() retrieves the personal workspace owned by a user
+func (m WorkspaceModel) GetPersonal(userID int64) (*Workspace, error) {
+	query := `
+		SELECT w.id, w.created_at, w.name, w.personal, w.version, wm.role
+		FROM workspaces w
+		INNER JOIN workspace_members wm
+		ON wm.workspace_id = w.id
+		WHERE wm.user_id = $1 AND wm.role = 'owner' AND w.personal
+		ORDER BY w.id ASC
+		LIMIT 1
+	`
+	var workspace Workspace
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&workspace.ID,
+		&workspace.CreatedAt,
+		&workspace.Name,
+		&workspace.Personal,
+		&workspace.Version,
+		&workspace.Role,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &workspace, nil
+}
+
+// GetAllForUser() lists the workspaces a user belongs to
+func (m WorkspaceModel) GetAllForUser(userID int64) ([]*Workspace, error) {
+	query := `
+		SELECT w.id, w.created_at, w.name, w.personal, w.version, wm.role
+		FROM workspaces w
+		INNER JOIN workspace_members wm
+		ON wm.workspace_id = w.id
+		WHERE wm.user_id = $1
+		ORDER BY w.id ASC
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	workspaces := []*Workspace{}
+	for rows.Next() {
+		var workspace Workspace
+		err := rows.Scan(
+			&workspace.ID,
+			&workspace.CreatedAt,
+			&workspace.Name,
+			&workspace.Personal,
+			&workspace.Version,
+			&workspace.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, &workspace)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// GetMembers() lists the members of a workspace
+func (m WorkspaceModel) GetMembers(workspaceID int64) ([]*Member, error) {
+	query := `
+		SELECT wm.workspace_id, wm.user_id, u.name, u.email, wm.role, wm.created_at
+		FROM workspace_members wm
+		INNER JOIN users u
+		ON u.id = wm.user_id
+		WHERE wm.workspace_id = $1
+		ORDER BY wm.created_at ASC, wm.user_id ASC
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []*Member{}
+	for rows.Next() {
+		var member Member
+		err := rows.Scan(
+			&member.WorkspaceID,
+			&member.UserID,
+			&member.Name,
+			&member.Email,
+			&member.Role,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// AddMember() gives a user a role in a workspace
+func (m WorkspaceModel) AddMember(member *Member) error {
+	query := `
+		INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)
+		RETURNING created_at
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, member.WorkspaceID, member.UserID, member.Role).Scan(&member.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "workspace_members_pkey"`:
+			return ErrDuplicateMember
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMember() takes a user out of a workspace. Owners cannot be removed.
+func (m WorkspaceModel) RemoveMember(workspaceID, userID int64) error {
+	query := `
+		DELETE FROM workspace_members
+		WHERE workspace_id = $1 AND user_id = $2 AND role <> 'owner'
+	`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,529 @@
+// Filename: internal/graphql/execute.go
+
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// The codes in the extensions of errors the package reports itself
+const (
+	codeSyntaxError      = "graphql_syntax_error"
+	codeValidationFailed = "graphql_validation_failed"
+	codeTooDeep          = "query_too_deep"
+	codeTooComplex       = "query_too_complex"
+	codeResolverFailed   = "resolver_failed"
+)
+
+// An Error is reported in the errors list of a response. Resolvers can
+// return one to give the error a code.
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError() returns an error with a code in its extensions
+func NewError(code, message string) *Error {
+	return newError(code, message)
+}
+
+func newError(code, message string) *Error {
+	return &Error{Message: message, Extensions: map[string]interface{}{"code": code}}
+}
+
+func newLocatedError(code, message string, loc Location) *Error {
+	e := newError(code, message)
+	e.Locations = []Location{loc}
+	return e
+}
+
+// A Request is a query with its variables, as clients send it
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// A Response holds the data of an executed operation and any errors. Data is
+// nil if the request was rejected before it ran.
+type Response struct {
+	Data   interface{}
+	Errors []*Error
+	// Whether the operation ran. Requests that fail to parse or validate
+	// don't, and their response has no data.
+	Executed bool
+	// The kind of operation that ran or was rejected: query or mutation
+	Operation string
+}
+
+// Options control how a request is run
+type Options struct {
+	Limits
+	// Only queries are run, for requests that must not change anything
+	QueriesOnly bool
+}
+
+// ErrMutationNotAllowed is the error reported for mutations when only
+// queries may run
+var ErrMutationNotAllowed = errors.New("mutations can only be sent with POST")
+
+// Execute() parses, validates and runs a request
+func (s *Schema) Execute(ctx context.Context, req Request, opts Options) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return &Response{Errors: []*Error{newLocatedError(codeSyntaxError, syntaxErr.Msg, syntaxErr.Loc)}}
+		}
+		return &Response{Errors: []*Error{newError(codeSyntaxError, err.Error())}}
+	}
+	p, errs := s.prepare(doc, req.OperationName, req.Variables, opts.Limits)
+	if errs != nil {
+		return &Response{Errors: errs}
+	}
+	resp := &Response{Operation: p.op.kind}
+	if opts.QueriesOnly && p.op.kind != "query" {
+		resp.Errors = []*Error{newLocatedError(codeValidationFailed, ErrMutationNotAllowed.Error(), p.op.loc)}
+		return resp
+	}
+	e := &executor{ctx: ctx, doc: doc, vars: p.vars}
+	root := &container{keys: []string{}}
+	fields := e.collect(p.root, p.op.selectionSet)
+	if p.op.kind == "mutation" {
+		// Mutations run one after the other, each with its whole selection
+		root.keys = make([]string, len(fields))
+		root.values = make([]interface{}, len(fields))
+		for i, f := range fields {
+			root.keys[i] = f.key
+			e.run([]*job{{parentType: p.root, fields: f.fields, c: root, index: i, path: []interface{}{f.key}}})
+		}
+	} else {
+		e.run(e.jobs(p.root, nil, fields, root, nil))
+	}
+	resp.Executed = true
+	if !root.dead {
+		resp.Data = root
+	}
+	resp.Errors = e.errs
+	return resp
+}
+
+// A container is an object or list in the response being built. Each knows
+// where it sits in its parent, so that a null in a non-null field can be
+// passed up to the nearest field that may be null.
+type container struct {
+	// Objects have keys, lists don't
+	keys     []string
+	values   []interface{}
+	parent   *container
+	index    int
+	nullable bool
+	// A dead container was replaced by null, so its fields aren't resolved
+	dead bool
+}
+
+func (c *container) MarshalJSON() ([]byte, error) {
+	if c.keys == nil {
+		return json.Marshal(c.values)
+	}
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range c.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(c.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// isDead() reports whether the container or one of its parents was nulled
+func (c *container) isDead() bool {
+	for ; c != nil; c = c.parent {
+		if c.dead {
+			return true
+		}
+	}
+	return false
+}
+
+// A job resolves one field of an object into a slot of its container
+type job struct {
+	parentType *Object
+	source     interface{}
+	fields     []*field
+	c          *container
+	index      int
+	path       []interface{}
+}
+
+// A collected field is the selections that share a response key
+type collected struct {
+	key    string
+	fields []*field
+}
+
+type executor struct {
+	ctx  context.Context
+	doc  *document
+	vars map[string]interface{}
+	errs []*Error
+}
+
+// run() resolves the response a level at a time. Every resolver of a level
+// is called before any Thunk is forced, so loaders see all the keys of the
+// level at once.
+func (e *executor) run(jobs []*job) {
+	for len(jobs) > 0 {
+		values := make([]interface{}, len(jobs))
+		errs := make([]error, len(jobs))
+		for i, j := range jobs {
+			if j.c.isDead() {
+				continue
+			}
+			values[i], errs[i] = e.resolve(j)
+		}
+		for i, j := range jobs {
+			if thunk, ok := values[i].(Thunk); ok && errs[i] == nil && !j.c.isDead() {
+				values[i], errs[i] = force(thunk)
+			}
+		}
+		next := []*job{}
+		for i, j := range jobs {
+			if j.c.isDead() {
+				continue
+			}
+			t := e.fieldType(j)
+			if errs[i] != nil {
+				e.addError(errs[i], j.fields[0].loc, j.path)
+				e.setNull(j.c, j.index, isNullable(t))
+				continue
+			}
+			v, err := e.complete(t, j.fields, values[i], j.c, j.index, isNullable(t), j.path, &next)
+			if err != nil {
+				e.setNull(j.c, j.index, isNullable(t))
+				continue
+			}
+			j.c.values[j.index] = v
+		}
+		jobs = next
+	}
+}
+
+// force() runs a thunk, turning a panic into an error
+func force(thunk Thunk) (value interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			value, err = nil, fmt.Errorf("panic in loader: %v", p)
+		}
+	}()
+	return thunk()
+}
+
+func isNullable(t Type) bool {
+	_, nonNull := t.(*NonNull)
+	return !nonNull
+}
+
+func (e *executor) fieldType(j *job) Type {
+	if j.fields[0].name == "__typename" {
+		return &NonNull{Of: String}
+	}
+	return j.parentType.field(j.fields[0].name).Type
+}
+
+func (e *executor) resolve(j *job) (value interface{}, err error) {
+	f := j.fields[0]
+	if f.name == "__typename" {
+		return j.parentType.Name, nil
+	}
+	def := j.parentType.field(f.name)
+	args := e.arguments(def.Args, f.arguments)
+	// A panicking resolver fails its field rather than the request
+	defer func() {
+		if p := recover(); p != nil {
+			value, err = nil, fmt.Errorf("panic in resolver for %s.%s: %v", j.parentType.Name, f.name, p)
+		}
+	}()
+	if def.Resolve == nil {
+		if m, ok := j.source.(map[string]interface{}); ok {
+			return m[def.Name], nil
+		}
+		return nil, fmt.Errorf("%s.%s has no resolver", j.parentType.Name, f.name)
+	}
+	return def.Resolve(ResolveParams{Context: e.ctx, Source: j.source, Args: args})
+}
+
+// arguments() coerces arguments that have already been validated
+func (e *executor) arguments(defs []*Argument, args []*argument) map[string]interface{} {
+	values := map[string]interface{}{}
+	given := map[string]*argument{}
+	for _, arg := range args {
+		given[arg.name] = arg
+	}
+	for _, def := range defs {
+		arg, ok := given[def.Name]
+		if ok && arg.value.kind == variableValue {
+			_, ok = e.vars[arg.value.text]
+		}
+		if !ok {
+			if def.Default != nil {
+				values[def.Name] = def.Default
+			}
+			continue
+		}
+		values[def.Name] = e.literal(arg.value, def.Type)
+	}
+	return values
+}
+
+// literal() converts a validated literal, substituting variables
+func (e *executor) literal(v *value, t Type) interface{} {
+	if v.kind == variableValue {
+		return e.vars[v.text]
+	}
+	if nn, ok := t.(*NonNull); ok {
+		t = nn.Of
+	}
+	if v.kind == nullValue {
+		return nil
+	}
+	switch t := t.(type) {
+	case *Scalar:
+		raw, _ := literalValue(v)
+		parsed, _ := t.ParseValue(raw)
+		return parsed
+	case *List:
+		if v.kind != listValue {
+			return []interface{}{e.literal(v, t.Of)}
+		}
+		list := make([]interface{}, len(v.list))
+		for i, item := range v.list {
+			list[i] = e.literal(item, t.Of)
+		}
+		return list
+	case *InputObject:
+		fields := map[string]*value{}
+		for _, f := range v.fields {
+			fields[f.name] = f.value
+		}
+		result := map[string]interface{}{}
+		for _, def := range t.Fields {
+			f, ok := fields[def.Name]
+			if ok && f.kind == variableValue {
+				_, ok = e.vars[f.text]
+			}
+			if !ok {
+				if def.Default != nil {
+					result[def.Name] = def.Default
+				}
+				continue
+			}
+			result[def.Name] = e.literal(f, def.Type)
+		}
+		return result
+	}
+	return nil
+}
+
+// errNulled means an error was already reported and the value is null
+var errNulled = errors.New("null")
+
+// complete() converts a resolved value for the response. Objects become
+// containers whose fields are added to the next level's jobs.
+func (e *executor) complete(t Type, fields []*field, value interface{}, parent *container, index int, nullable bool, path []interface{}, next *[]*job) (interface{}, error) {
+	if nn, ok := t.(*NonNull); ok {
+		if isNull(value) {
+			e.addError(fmt.Errorf("a non-null field resolved to null"), fields[0].loc, path)
+			return nil, errNulled
+		}
+		return e.complete(nn.Of, fields, value, parent, index, false, path, next)
+	}
+	if isNull(value) {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *Scalar:
+		v, err := t.Serialize(value)
+		if err != nil {
+			e.addError(err, fields[0].loc, path)
+			return nil, errNulled
+		}
+		return v, nil
+	case *List:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.addError(fmt.Errorf("expected a list, got %T", value), fields[0].loc, path)
+			return nil, errNulled
+		}
+		list := &container{values: make([]interface{}, rv.Len()), parent: parent, index: index, nullable: nullable}
+		elemNullable := isNullable(t.Of)
+		for i := 0; i < rv.Len(); i++ {
+			v, err := e.complete(t.Of, fields, rv.Index(i).Interface(), list, i, elemNullable, appendPath(path, i), next)
+			if err != nil {
+				if !elemNullable {
+					list.dead = true
+					return nil, errNulled
+				}
+				v = nil
+			}
+			list.values[i] = v
+		}
+		return list, nil
+	case *Object:
+		obj := &container{parent: parent, index: index, nullable: nullable}
+		*next = append(*next, e.jobs(t, value, e.collectAll(t, fields), obj, path)...)
+		return obj, nil
+	}
+	e.addError(fmt.Errorf("can't complete a value of type %s", t), fields[0].loc, path)
+	return nil, errNulled
+}
+
+// isNull() reports whether a value is nil, including typed nil pointers
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	p := make([]interface{}, len(path)+1)
+	copy(p, path)
+	p[len(path)] = elem
+	return p
+}
+
+// jobs() sets up the keys of an object container and a job for each field
+func (e *executor) jobs(t *Object, source interface{}, fields []collected, obj *container, path []interface{}) []*job {
+	obj.keys = make([]string, len(fields))
+	obj.values = make([]interface{}, len(fields))
+	jobs := make([]*job, len(fields))
+	for i, f := range fields {
+		obj.keys[i] = f.key
+		jobs[i] = &job{parentType: t, source: source, fields: f.fields, c: obj, index: i, path: appendPath(path, f.key)}
+	}
+	return jobs
+}
+
+// setNull() puts null in a slot. If the slot can't be null its container
+// becomes null instead, and so on up the response.
+func (e *executor) setNull(c *container, index int, nullable bool) {
+	for {
+		if nullable {
+			c.values[index] = nil
+			return
+		}
+		c.dead = true
+		if c.parent == nil {
+			return
+		}
+		c, index, nullable = c.parent, c.index, c.nullable
+	}
+}
+
+func (e *executor) addError(err error, loc Location, path []interface{}) {
+	if errors.Is(err, errNulled) {
+		return
+	}
+	var gqlErr *Error
+	if errors.As(err, &gqlErr) {
+		located := *gqlErr
+		located.Locations = []Location{loc}
+		located.Path = path
+		e.errs = append(e.errs, &located)
+		return
+	}
+	resolverErr := newLocatedError(codeResolverFailed, err.Error(), loc)
+	resolverErr.Path = path
+	e.errs = append(e.errs, resolverErr)
+}
+
+// collect() gathers the fields of a selection set by response key,
+// following fragments and applying @skip and @include
+func (e *executor) collect(t *Object, set []selection) []collected {
+	var fields []collected
+	e.collectInto(t, set, &fields, map[string]bool{})
+	return fields
+}
+
+// collectAll() gathers the sub-selections of fields that share a key
+func (e *executor) collectAll(t *Object, fields []*field) []collected {
+	var all []collected
+	visited := map[string]bool{}
+	for _, f := range fields {
+		e.collectInto(t, f.selectionSet, &all, visited)
+	}
+	return all
+}
+
+func (e *executor) collectInto(t *Object, set []selection, fields *[]collected, visited map[string]bool) {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *field:
+			if !e.included(sel.directives) {
+				continue
+			}
+			found := false
+			for i := range *fields {
+				if (*fields)[i].key == sel.key() {
+					(*fields)[i].fields = append((*fields)[i].fields, sel)
+					found = true
+					break
+				}
+			}
+			if !found {
+				*fields = append(*fields, collected{key: sel.key(), fields: []*field{sel}})
+			}
+		case *inlineFragment:
+			if e.included(sel.directives) {
+				e.collectInto(t, sel.selectionSet, fields, visited)
+			}
+		case *fragmentSpread:
+			if !e.included(sel.directives) || visited[sel.name] {
+				continue
+			}
+			visited[sel.name] = true
+			e.collectInto(t, e.doc.fragments[sel.name].selectionSet, fields, visited)
+		}
+	}
+}
+
+// included() applies the @skip and @include directives
+func (e *executor) included(directives []*directive) bool {
+	for _, d := range directives {
+		args := e.arguments(directiveArgs, d.arguments)
+		condition, _ := args["if"].(bool)
+		if (d.name == "skip" && condition) || (d.name == "include" && !condition) {
+			return false
+		}
+	}
+	return true
+}
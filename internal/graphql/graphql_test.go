@@ -0,0 +1,485 @@
+// Filename: internal/graphql/graphql_test.go
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formatTokens() writes tokens as kind:text, leaving out the end
+func formatTokens(tokens []token) []string {
+	kinds := map[tokenKind]string{tokenPunct: "punct", tokenName: "name", tokenInt: "int", tokenFloat: "float", tokenString: "string"}
+	out := []string{}
+	for _, tok := range tokens {
+		if tok.kind != tokenEOF {
+			out = append(out, kinds[tok.kind]+":"+tok.text)
+		}
+	}
+	return out
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"{ a, b }", []string{"punct:{", "name:a", "name:b", "punct:}"}},
+		{"...on $x: [Int!]!", []string{"punct:...", "name:on", "punct:$", "name:x", "punct::", "punct:[", "name:Int", "punct:!", "punct:]", "punct:!"}},
+		{"-12 3.5 1e3 0 -0.5E-2", []string{"int:-12", "float:3.5", "float:1e3", "int:0", "float:-0.5E-2"}},
+		{`"a\"b\\\/\n"`, []string{"string:a\"b\\/\n"}},
+		{`"é😀"`, []string{"string:é😀"}},
+		{"\"\"\"\n    hello\n      world\n  \"\"\"", []string{"string:hello\n  world"}},
+		{`"""a \""" b"""`, []string{`string:a """ b`}},
+		{"# a comment\r\n_a1 # another", []string{"name:_a1"}},
+		{"\uFEFFa", []string{"name:a"}},
+	}
+	for _, tt := range tests {
+		tokens, err := lex(tt.input)
+		if err != nil {
+			t.Errorf("lex(%q): %v", tt.input, err)
+			continue
+		}
+		if got := formatTokens(tokens); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lex(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// Columns count characters rather than bytes
+func TestLexLocations(t *testing.T) {
+	tokens, err := lex("{\n  a: b\r\n\t\"é\" c }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Location{{1, 1}, {2, 3}, {2, 4}, {2, 6}, {3, 2}, {3, 6}, {3, 8}, {3, 9}}
+	got := []Location{}
+	for _, tok := range tokens {
+		got = append(got, tok.loc)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got locations %v, want %v", got, want)
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		loc   Location
+		msg   string
+	}{
+		{`"abc`, Location{1, 1}, "unterminated string"},
+		{"\"abc\ndef\"", Location{1, 1}, "unterminated string"},
+		{"a\n  \"x\\q\"", Location{2, 7}, `invalid escape \q`},
+		{`"\uD800"`, Location{1, 8}, "invalid unicode escape"},
+		{`"\u12"`, Location{1, 4}, "invalid unicode escape"},
+		{`"""abc`, Location{1, 1}, "unterminated block string"},
+		{"007", Location{1, 1}, "numbers can't have leading zeros"},
+		{"1.", Location{1, 1}, "expected a digit after the decimal point"},
+		{"1e", Location{1, 1}, "expected a digit in the exponent"},
+		{"-a", Location{1, 1}, "expected a digit"},
+		{"12abc", Location{1, 1}, "invalid number"},
+		{`"é" ?`, Location{1, 5}, `unexpected character '?'`},
+	}
+	for _, tt := range tests {
+		_, err := lex(tt.input)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("lex(%q): got %v, want a *SyntaxError", tt.input, err)
+			continue
+		}
+		if syntaxErr.Loc != tt.loc || syntaxErr.Msg != tt.msg {
+			t.Errorf("lex(%q): got %q at %v, want %q at %v", tt.input, syntaxErr.Msg, syntaxErr.Loc, tt.msg, tt.loc)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		query Q($a: [Int!]! = [1, 2], $b: String) @skip(if: false) {
+			x: a(b: $a, c: {d: "e", f: [null]}) @include(if: true) {
+				...F
+				... on T { c }
+			}
+		}
+		fragment F on T { d }
+		{ e }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.operations) != 2 || len(doc.fragments) != 1 {
+		t.Fatalf("got %d operations and %d fragments, want 2 and 1", len(doc.operations), len(doc.fragments))
+	}
+	op := doc.operations[0]
+	if op.kind != "query" || op.name != "Q" || op.loc != (Location{2, 3}) {
+		t.Errorf("got operation %s %s at %v", op.kind, op.name, op.loc)
+	}
+	if len(op.variables) != 2 || op.variables[0].typ.String() != "[Int!]!" || len(op.variables[0].defValue.list) != 2 || op.variables[1].typ.String() != "String" {
+		t.Errorf("got the wrong variables")
+	}
+	if len(op.directives) != 1 || op.directives[0].name != "skip" {
+		t.Errorf("got the wrong operation directives")
+	}
+	f := op.selectionSet[0].(*field)
+	if f.alias != "x" || f.name != "a" || f.key() != "x" || len(f.arguments) != 2 || len(f.directives) != 1 {
+		t.Errorf("got field %s: %s with %d arguments", f.alias, f.name, len(f.arguments))
+	}
+	if c := f.arguments[1].value; c.kind != objectValue || printLiteral(c) != `{d:"e",f:[null]}` {
+		t.Errorf("got argument c = %s", printLiteral(c))
+	}
+	if spread, ok := f.selectionSet[0].(*fragmentSpread); !ok || spread.name != "F" {
+		t.Errorf("got %#v, want a spread of F", f.selectionSet[0])
+	}
+	if inline, ok := f.selectionSet[1].(*inlineFragment); !ok || inline.typeCondition != "T" {
+		t.Errorf("got %#v, want an inline fragment on T", f.selectionSet[1])
+	}
+	if fragment := doc.fragments["F"]; fragment.typeCondition != "T" {
+		t.Errorf("got fragment F on %s", fragment.typeCondition)
+	}
+	if shorthand := doc.operations[1]; shorthand.kind != "query" || shorthand.name != "" {
+		t.Errorf("got shorthand %s %q", shorthand.kind, shorthand.name)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		loc   Location
+		msg   string
+	}{
+		{"", Location{1, 1}, "the document has no operations"},
+		{"{ }", Location{1, 4}, "a selection set can't be empty"},
+		{"{ a", Location{1, 4}, "expected a name, found the end of the document"},
+		{"foo { a }", Location{1, 1}, `expected an operation or fragment, found "foo"`},
+		{"{ a(b: 1, b: 2) }", Location{1, 11}, `the argument "b" is given more than once`},
+		{"{ a() }", Location{1, 7}, "an argument list can't be empty"},
+		{"{ a(b: ) }", Location{1, 8}, `expected a value, found ")"`},
+		{"{ a(b: {c: 1, c: 2}) }", Location{1, 15}, `the field "c" is given more than once`},
+		{"query($a: Int = $b) { a }", Location{1, 17}, "variables can't be used here"},
+		{"query($a Int) { a }", Location{1, 10}, `expected ":", found "Int"`},
+		{"fragment on on T { a }", Location{1, 1}, "a fragment can't be named on"},
+		{"fragment F T { a }", Location{1, 12}, `expected "on", found "T"`},
+		{"{ a } fragment F on T { a } fragment F on T { b }", Location{1, 29}, `there is more than one fragment named "F"`},
+		{strings.Repeat("{a", maxNesting+1), Location{1, maxNesting*2 + 1}, "the document is nested more than 100 levels deep"},
+		{strings.Repeat(" ", MaxDocumentLength+1), Location{1, 1}, "the document is longer than 100000 bytes"},
+	}
+	for _, tt := range tests {
+		_, err := parse(tt.input)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("parse(%.40q): got %v, want a *SyntaxError", tt.input, err)
+			continue
+		}
+		if syntaxErr.Loc != tt.loc || syntaxErr.Msg != tt.msg {
+			t.Errorf("parse(%.40q): got %q at %v, want %q at %v", tt.input, syntaxErr.Msg, syntaxErr.Loc, tt.msg, tt.loc)
+		}
+	}
+}
+
+type loaderKey struct{}
+
+// testSchema() builds a schema of items, each with an owner read through
+// the loader in the context and children that are made up on the fly
+func testSchema(t *testing.T) *Schema {
+	first := func(args map[string]interface{}) int {
+		n, _ := args["first"].(int)
+		return n
+	}
+	items := func(n, base, owner int) []interface{} {
+		list := make([]interface{}, n)
+		for i := range list {
+			id := base + i + 1
+			list[i] = map[string]interface{}{"id": id, "name": fmt.Sprintf("item %d", id), "ownerID": owner + i%2}
+		}
+		return list
+	}
+	userType := &Object{Name: "User", Fields: []*Field{
+		{Name: "id", Type: &NonNull{Of: Int}},
+		{Name: "name", Type: String},
+	}}
+	itemType := &Object{Name: "Item"}
+	itemType.Fields = []*Field{
+		{Name: "id", Type: &NonNull{Of: Int}},
+		{Name: "name", Type: String},
+		{Name: "owner", Type: userType, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Context.Value(loaderKey{}).(*Loader).Load(p.Source.(map[string]interface{})["ownerID"]), nil
+		}},
+		{Name: "children", Type: &NonNull{Of: &List{Of: &NonNull{Of: itemType}}}, Args: []*Argument{{Name: "first", Type: Int, Default: 2}}, Multiplier: first, Resolve: func(p ResolveParams) (interface{}, error) {
+			return items(first(p.Args), p.Source.(map[string]interface{})["id"].(int)*10, 3), nil
+		}},
+	}
+	query := &Object{Name: "Query", Fields: []*Field{
+		{Name: "items", Type: &NonNull{Of: &List{Of: &NonNull{Of: itemType}}}, Args: []*Argument{{Name: "first", Type: Int, Default: 3}}, Multiplier: first, Resolve: func(p ResolveParams) (interface{}, error) {
+			return items(first(p.Args), 0, 1), nil
+		}},
+		{Name: "item", Type: itemType, Args: []*Argument{{Name: "id", Type: &NonNull{Of: Int}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return items(1, p.Args["id"].(int)-1, 1)[0], nil
+		}},
+	}}
+	mutation := &Object{Name: "Mutation", Fields: []*Field{
+		{Name: "rename", Type: itemType, Args: []*Argument{{Name: "id", Type: &NonNull{Of: Int}}, {Name: "name", Type: &NonNull{Of: String}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return map[string]interface{}{"id": p.Args["id"], "name": p.Args["name"], "ownerID": 1}, nil
+		}},
+	}}
+	s, err := NewSchema(query, mutation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// usersLoader() returns a loader of users that records the keys of each
+// batch
+func usersLoader(batches *[][]interface{}) *Loader {
+	return NewLoader(func(keys []interface{}) ([]interface{}, error) {
+		*batches = append(*batches, keys)
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = map[string]interface{}{"id": key, "name": fmt.Sprintf("user %d", key)}
+		}
+		return values, nil
+	})
+}
+
+// execute() runs a query with a fresh loader and returns the response as
+// JSON with the batches the loader was called with
+func execute(t *testing.T, s *Schema, req Request, opts Options) (*Response, string, [][]interface{}) {
+	batches := [][]interface{}{}
+	ctx := context.WithValue(context.Background(), loaderKey{}, usersLoader(&batches))
+	resp := s.Execute(ctx, req, opts)
+	js, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(js), batches
+}
+
+func TestValidate(t *testing.T) {
+	s := testSchema(t)
+	tests := []struct {
+		query     string
+		variables map[string]interface{}
+		msg       string
+	}{
+		{"{ nope }", nil, `Query has no field "nope"`},
+		{"{ items(size: 1) { id } }", nil, `Query.items has no argument "size"`},
+		{"{ item { id } }", nil, `Query.item needs the argument "id"`},
+		{`{ item(id: "x") { id } }`, nil, `the argument "id" of Query.item must be a 32 bit integer`},
+		{"{ item(id: null) { id } }", nil, `the argument "id" of Query.item must not be null`},
+		{"{ items }", nil, "Query.items is a Item and needs a selection"},
+		{"{ items { id { x } } }", nil, "Item.id is a Int and can't have a selection"},
+		{"{ __typename(a: 1) }", nil, "__typename takes no arguments or selections"},
+		{"{ items { a: id a: name } }", nil, `the fields named "a" select different fields or arguments`},
+		{"{ items @foo { id } }", nil, "unknown directive @foo"},
+		{"{ items @skip { id } }", nil, `@skip needs the argument "if"`},
+		{"{ item(id: $n) { id } }", nil, `the argument "id" of Query.item uses the undefined variable $n`},
+		{"query($n: String) { item(id: $n) { id } }", map[string]interface{}{"n": "1"}, `the argument "id" of Query.item uses the variable $n of type String where Int! is expected`},
+		// A variable that isn't given leaves its argument out
+		{"query($n: String) { item(id: $n) { id } }", nil, `Query.item needs the argument "id"`},
+		{"query($n: Int!) { item(id: $n) { id } }", nil, "the variable $n must be provided"},
+		{"query($n: Int!) { item(id: $n) { id } }", map[string]interface{}{"n": "x"}, "the variable $n must be a 32 bit integer"},
+		{"query($n: Item) { items { id } }", nil, "the variable $n has an Item can't be the type of a variable"},
+		{"query($n: Int, $n: Int) { items { id } }", nil, "the variable $n is defined more than once"},
+		{"{ items { id } } fragment F on Item { id }", nil, `the fragment "F" is never used`},
+		{"{ items { ...F } }", nil, `unknown fragment "F"`},
+		{"{ ...F } fragment F on Item { id }", nil, `the fragment "F" on Item can't be spread on Query`},
+		{"{ items { ...F } } fragment F on Item { children { ...F } }", nil, `the fragment "F" spreads itself`},
+		{"{ items { ... on Query { items { id } } } }", nil, "the fragment on Query can't be spread on Item"},
+		{"query A { items { id } } query B { items { id } }", nil, "the document has more than one operation, so operationName must be given"},
+		{"subscription { items { id } }", nil, "subscription operations are not supported"},
+	}
+	for _, tt := range tests {
+		resp, _, _ := execute(t, s, Request{Query: tt.query, Variables: tt.variables}, Options{})
+		if resp.Executed || len(resp.Errors) == 0 {
+			t.Errorf("%s: ran, want it rejected", tt.query)
+			continue
+		}
+		if resp.Errors[0].Message != tt.msg || resp.Errors[0].Extensions["code"] != codeValidationFailed {
+			t.Errorf("%s: got %q (%v), want %q", tt.query, resp.Errors[0].Message, resp.Errors[0].Extensions["code"], tt.msg)
+		}
+	}
+}
+
+func TestValidateAccepts(t *testing.T) {
+	s := testSchema(t)
+	tests := []struct {
+		query     string
+		variables map[string]interface{}
+		want      string
+	}{
+		{"{ item(id: 2) { id name } }", nil, `{"item":{"id":2,"name":"item 2"}}`},
+		{"query($n: Int = 3) { item(id: $n) { id } }", nil, `{"item":{"id":3}}`},
+		{"query($n: Int!) { item(id: $n) { id } }", map[string]interface{}{"n": json.Number("4")}, `{"item":{"id":4}}`},
+		{"{ items(first: 2) { a: id a: id } }", nil, `{"items":[{"a":1},{"a":2}]}`},
+		{"{ items(first: 1) { ...F ...F } } fragment F on Item { id }", nil, `{"items":[{"id":1}]}`},
+		{"query($skip: Boolean!) { items(first: 1) { id name @skip(if: $skip) } }", map[string]interface{}{"skip": true}, `{"items":[{"id":1}]}`},
+		{"{ __typename item(id: 1) { __typename } }", nil, `{"__typename":"Query","item":{"__typename":"Item"}}`},
+	}
+	for _, tt := range tests {
+		resp, got, _ := execute(t, s, Request{Query: tt.query, Variables: tt.variables}, Options{})
+		if len(resp.Errors) > 0 {
+			t.Errorf("%s: %v", tt.query, resp.Errors[0])
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestOperationName(t *testing.T) {
+	s := testSchema(t)
+	query := "query A { item(id: 1) { id } } query B { item(id: 2) { id } }"
+	if _, got, _ := execute(t, s, Request{Query: query, OperationName: "B"}, Options{}); got != `{"item":{"id":2}}` {
+		t.Errorf("operation B = %s", got)
+	}
+	resp, _, _ := execute(t, s, Request{Query: query, OperationName: "C"}, Options{})
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != `there is no operation named "C"` {
+		t.Errorf("operation C: got %v", resp.Errors)
+	}
+}
+
+func TestQueriesOnly(t *testing.T) {
+	s := testSchema(t)
+	mutation := `mutation { rename(id: 1, name: "a") { name } }`
+	resp, _, _ := execute(t, s, Request{Query: mutation}, Options{QueriesOnly: true})
+	if resp.Executed || resp.Operation != "mutation" || len(resp.Errors) != 1 || resp.Errors[0].Message != ErrMutationNotAllowed.Error() {
+		t.Errorf("with QueriesOnly: got %+v", resp)
+	}
+	if _, got, _ := execute(t, s, Request{Query: mutation}, Options{}); got != `{"rename":{"name":"a"}}` {
+		t.Errorf("without QueriesOnly: got %s", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := testSchema(t)
+	tests := []struct {
+		query             string
+		depth, complexity int
+	}{
+		{"{ __typename }", 1, 0},
+		{"{ item(id: 1) { id } }", 2, 2},
+		// Lists count once for each item their arguments ask for
+		{"{ items { id } }", 2, 4},
+		{"{ items(first: 5) { id name } }", 2, 11},
+		{"{ items(first: 5) { children(first: 4) { id } } }", 3, 26},
+		{"{ items(first: 5) { children { children { id } } } }", 4, 36},
+		// Fragments cost what their selections would cost in place
+		{"{ items { ...F } } fragment F on Item { children { id } }", 3, 10},
+		{"{ items { ... on Item { children { id } } } }", 3, 10},
+		{"{ items { ...F children { ...G } } } fragment F on Item { id } fragment G on Item { ...F }", 3, 13},
+		// The multiplier is only applied to valid arguments
+		{"{ items(first: 1000000) { children(first: 1000000) { children(first: 1000000) { id } } } }", 4, 1<<31 - 1},
+	}
+	for _, tt := range tests {
+		doc, err := parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		p, errs := s.prepare(doc, "", nil, Limits{})
+		if errs != nil {
+			t.Errorf("%s: %v", tt.query, errs[0])
+			continue
+		}
+		if p.depth != tt.depth || p.complexity != tt.complexity {
+			t.Errorf("%s: got depth %d and complexity %d, want %d and %d", tt.query, p.depth, p.complexity, tt.depth, tt.complexity)
+		}
+	}
+
+	query := "{ items(first: 5) { children(first: 4) { id } } }"
+	limitTests := []struct {
+		limits Limits
+		code   string
+		msg    string
+	}{
+		{Limits{MaxDepth: 3, MaxComplexity: 26}, "", ""},
+		{Limits{MaxDepth: 2}, codeTooDeep, "the query is nested 3 levels deep, more than the limit of 2"},
+		{Limits{MaxComplexity: 25}, codeTooComplex, "the query has a complexity of 26, more than the limit of 25"},
+	}
+	for _, tt := range limitTests {
+		resp, _, _ := execute(t, s, Request{Query: query}, Options{Limits: tt.limits})
+		if tt.code == "" {
+			if !resp.Executed || len(resp.Errors) > 0 {
+				t.Errorf("%+v: got %v, want the query to run", tt.limits, resp.Errors)
+			}
+			continue
+		}
+		if resp.Executed || len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != tt.code || resp.Errors[0].Message != tt.msg {
+			t.Errorf("%+v: got %v, want %s %q", tt.limits, resp.Errors, tt.code, tt.msg)
+		}
+	}
+}
+
+func TestLoader(t *testing.T) {
+	batches := [][]interface{}{}
+	l := usersLoader(&batches)
+	a, b, a2 := l.Load(1), l.Load(2), l.Load(1)
+	if len(batches) != 0 {
+		t.Fatalf("loaded before a thunk was forced")
+	}
+	v, err := b()
+	if err != nil || v.(map[string]interface{})["name"] != "user 2" {
+		t.Fatalf("b() = %v, %v", v, err)
+	}
+	va, _ := a()
+	va2, _ := a2()
+	if va.(map[string]interface{})["name"] != "user 1" || !reflect.DeepEqual(va, va2) {
+		t.Errorf("a() = %v and %v", va, va2)
+	}
+	// Loaded keys come from the cache, and new ones go in a new batch
+	c, b2 := l.Load(3), l.Load(2)
+	c()
+	b2()
+	want := [][]interface{}{{1, 2}, {3}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("got batches %v, want %v", batches, want)
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	failed := errors.New("failed")
+	l := NewLoader(func(keys []interface{}) ([]interface{}, error) {
+		return nil, failed
+	})
+	a, b := l.Load("a"), l.Load("b")
+	if _, err := a(); err != failed {
+		t.Errorf("a() error = %v, want %v", err, failed)
+	}
+	if _, err := b(); err != failed {
+		t.Errorf("b() error = %v, want %v", err, failed)
+	}
+
+	short := NewLoader(func(keys []interface{}) ([]interface{}, error) {
+		return []interface{}{"only one"}, nil
+	})
+	c, d := short.Load("c"), short.Load("d")
+	c()
+	_, err := d()
+	var gqlErr *Error
+	if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != codeResolverFailed {
+		t.Errorf("d() error = %v, want a %s error", err, codeResolverFailed)
+	}
+}
+
+// The owners of every item on a level are loaded in one batch
+func TestExecuteBatches(t *testing.T) {
+	s := testSchema(t)
+	query := "{ items(first: 4) { id owner { name } children(first: 2) { owner { id } } } }"
+	resp, got, batches := execute(t, s, Request{Query: query}, Options{})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors[0])
+	}
+	want := [][]interface{}{{1, 2}, {3, 4}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("got batches %v, want %v", batches, want)
+	}
+	if !strings.HasPrefix(got, `{"items":[{"id":1,"owner":{"name":"user 1"},"children":[{"owner":{"id":3}},{"owner":{"id":4}}]},{"id":2,"owner":{"name":"user 2"}`) {
+		t.Errorf("got %s", got)
+	}
+}
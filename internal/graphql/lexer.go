@@ -0,0 +1,345 @@
+// Filename: internal/graphql/lexer.go
+
+// Package graphql runs GraphQL queries against a schema defined in Go. It
+// covers executable documents (operations, variables, fragments and the
+// @skip and @include directives) but not introspection beyond __typename.
+// Resolvers can return a Thunk from a Loader, and the executor resolves a
+// whole level of the response before forcing any of them, so that sibling
+// fields are loaded in one batch. Queries are checked against depth and
+// complexity limits before anything is resolved.
+package graphql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	loc  Location
+}
+
+// A Location is a line and column in the document, counting from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// A SyntaxError reports a document that isn't valid GraphQL
+type SyntaxError struct {
+	Loc Location
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Loc.Line, e.Loc.Column, e.Msg)
+}
+
+type lexer struct {
+	input  string
+	offset int
+	line   int
+	// The offset at which the current line starts
+	lineStart int
+}
+
+func lex(input string) ([]token, error) {
+	l := &lexer{input: input, line: 1}
+	tokens := []token{}
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) loc() Location {
+	return Location{Line: l.line, Column: utf8.RuneCountInString(l.input[l.lineStart:l.offset]) + 1}
+}
+
+func (l *lexer) newline(size int) {
+	l.offset += size
+	l.line++
+	l.lineStart = l.offset
+}
+
+// skipIgnored() skips white space, commas, comments and byte order marks
+func (l *lexer) skipIgnored() {
+	for l.offset < len(l.input) {
+		switch c := l.input[l.offset]; {
+		case c == ' ' || c == '\t' || c == ',':
+			l.offset++
+		case c == '\n':
+			l.newline(1)
+		case c == '\r':
+			if strings.HasPrefix(l.input[l.offset:], "\r\n") {
+				l.newline(2)
+			} else {
+				l.newline(1)
+			}
+		case c == '#':
+			for l.offset < len(l.input) && l.input[l.offset] != '\n' && l.input[l.offset] != '\r' {
+				l.offset++
+			}
+		case strings.HasPrefix(l.input[l.offset:], "\uFEFF"):
+			l.offset += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	loc := l.loc()
+	if l.offset >= len(l.input) {
+		return token{kind: tokenEOF, loc: loc}, nil
+	}
+	c := l.input[l.offset]
+	switch {
+	case strings.HasPrefix(l.input[l.offset:], "..."):
+		l.offset += 3
+		return token{kind: tokenPunct, text: "...", loc: loc}, nil
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		l.offset++
+		return token{kind: tokenPunct, text: string(c), loc: loc}, nil
+	case c == '_' || isLetter(c):
+		start := l.offset
+		for l.offset < len(l.input) && (l.input[l.offset] == '_' || isLetter(l.input[l.offset]) || isDigit(l.input[l.offset])) {
+			l.offset++
+		}
+		return token{kind: tokenName, text: l.input[start:l.offset], loc: loc}, nil
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case c == '"':
+		if strings.HasPrefix(l.input[l.offset:], `"""`) {
+			return l.blockString(loc)
+		}
+		return l.string(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[l.offset:])
+	return token{}, &SyntaxError{Loc: loc, Msg: fmt.Sprintf("unexpected character %q", r)}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// number() reads an integer or float. Leading zeros aren't allowed, and a
+// number can't be followed directly by a name.
+func (l *lexer) number(loc Location) (token, error) {
+	start := l.offset
+	kind := tokenInt
+	if l.input[l.offset] == '-' {
+		l.offset++
+	}
+	digits := func() bool {
+		begin := l.offset
+		for l.offset < len(l.input) && isDigit(l.input[l.offset]) {
+			l.offset++
+		}
+		return l.offset > begin
+	}
+	intStart := l.offset
+	if !digits() {
+		return token{}, &SyntaxError{Loc: loc, Msg: "expected a digit"}
+	}
+	if l.input[intStart] == '0' && l.offset-intStart > 1 {
+		return token{}, &SyntaxError{Loc: loc, Msg: "numbers can't have leading zeros"}
+	}
+	if l.offset < len(l.input) && l.input[l.offset] == '.' {
+		kind = tokenFloat
+		l.offset++
+		if !digits() {
+			return token{}, &SyntaxError{Loc: loc, Msg: "expected a digit after the decimal point"}
+		}
+	}
+	if l.offset < len(l.input) && (l.input[l.offset] == 'e' || l.input[l.offset] == 'E') {
+		kind = tokenFloat
+		l.offset++
+		if l.offset < len(l.input) && (l.input[l.offset] == '+' || l.input[l.offset] == '-') {
+			l.offset++
+		}
+		if !digits() {
+			return token{}, &SyntaxError{Loc: loc, Msg: "expected a digit in the exponent"}
+		}
+	}
+	if l.offset < len(l.input) && (l.input[l.offset] == '_' || l.input[l.offset] == '.' || isLetter(l.input[l.offset])) {
+		return token{}, &SyntaxError{Loc: loc, Msg: "invalid number"}
+	}
+	return token{kind: kind, text: l.input[start:l.offset], loc: loc}, nil
+}
+
+// string() reads a quoted string on a single line, decoding its escapes
+func (l *lexer) string(loc Location) (token, error) {
+	l.offset++
+	var b strings.Builder
+	for l.offset < len(l.input) {
+		c := l.input[l.offset]
+		switch {
+		case c == '"':
+			l.offset++
+			return token{kind: tokenString, text: b.String(), loc: loc}, nil
+		case c == '\n' || c == '\r':
+			return token{}, &SyntaxError{Loc: loc, Msg: "unterminated string"}
+		case c == '\\':
+			if l.offset+1 >= len(l.input) {
+				return token{}, &SyntaxError{Loc: loc, Msg: "unterminated string"}
+			}
+			escape := l.input[l.offset+1]
+			l.offset += 2
+			switch escape {
+			case '"', '\\', '/':
+				b.WriteByte(escape)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				r, ok := l.unicodeEscape()
+				if !ok {
+					return token{}, &SyntaxError{Loc: l.loc(), Msg: "invalid unicode escape"}
+				}
+				b.WriteRune(r)
+			default:
+				return token{}, &SyntaxError{Loc: l.loc(), Msg: fmt.Sprintf("invalid escape \\%c", escape)}
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(l.input[l.offset:])
+			b.WriteRune(r)
+			l.offset += size
+		}
+	}
+	return token{}, &SyntaxError{Loc: loc, Msg: "unterminated string"}
+}
+
+// unicodeEscape() reads the four hex digits of a \u escape, and a second
+// escape for the low half of a surrogate pair
+func (l *lexer) unicodeEscape() (rune, bool) {
+	hex := func() (rune, bool) {
+		if l.offset+4 > len(l.input) {
+			return 0, false
+		}
+		var r rune
+		for _, c := range l.input[l.offset : l.offset+4] {
+			r <<= 4
+			switch {
+			case c >= '0' && c <= '9':
+				r |= c - '0'
+			case c >= 'a' && c <= 'f':
+				r |= c - 'a' + 10
+			case c >= 'A' && c <= 'F':
+				r |= c - 'A' + 10
+			default:
+				return 0, false
+			}
+		}
+		l.offset += 4
+		return r, true
+	}
+	r, ok := hex()
+	if !ok {
+		return 0, false
+	}
+	if r >= 0xD800 && r < 0xDC00 && strings.HasPrefix(l.input[l.offset:], `\u`) {
+		l.offset += 2
+		low, ok := hex()
+		if !ok || low < 0xDC00 || low > 0xDFFF {
+			return 0, false
+		}
+		return (r-0xD800)<<10 + (low - 0xDC00) + 0x10000, true
+	}
+	if r >= 0xD800 && r <= 0xDFFF {
+		return 0, false
+	}
+	return r, true
+}
+
+// blockString() reads a triple quoted string, which may span lines. The
+// common indentation and any blank first and last lines are removed.
+func (l *lexer) blockString(loc Location) (token, error) {
+	l.offset += 3
+	var raw strings.Builder
+	for l.offset < len(l.input) {
+		switch {
+		case strings.HasPrefix(l.input[l.offset:], `"""`):
+			l.offset += 3
+			return token{kind: tokenString, text: blockStringValue(raw.String()), loc: loc}, nil
+		case strings.HasPrefix(l.input[l.offset:], `\"""`):
+			raw.WriteString(`"""`)
+			l.offset += 4
+		case l.input[l.offset] == '\n':
+			raw.WriteByte('\n')
+			l.newline(1)
+		case l.input[l.offset] == '\r':
+			raw.WriteByte('\n')
+			if strings.HasPrefix(l.input[l.offset:], "\r\n") {
+				l.newline(2)
+			} else {
+				l.newline(1)
+			}
+		default:
+			raw.WriteByte(l.input[l.offset])
+			l.offset++
+		}
+	}
+	return token{}, &SyntaxError{Loc: loc, Msg: "unterminated block string"}
+}
+
+func blockStringValue(raw string) string {
+	lines := strings.Split(raw, "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,71 @@
+// Filename: internal/graphql/loader.go
+
+package graphql
+
+// A Thunk is a value that is loaded later. Resolvers return one from a
+// Loader so that the executor can batch the loads of a level.
+type Thunk func() (interface{}, error)
+
+// A BatchFunc loads the values for a list of keys, in the same order. A
+// value may be nil for a key that has none.
+type BatchFunc func(keys []interface{}) ([]interface{}, error)
+
+// A Loader collects the keys asked for until one of its thunks is forced,
+// then loads them all with one call of its batch function. Loaded values
+// are cached for the life of the loader, which should be one request. A
+// Loader is used by one goroutine at a time.
+type Loader struct {
+	batch   BatchFunc
+	pending []interface{}
+	results map[interface{}]*loaded
+}
+
+type loaded struct {
+	value interface{}
+	err   error
+	done  bool
+}
+
+// NewLoader() returns a loader that batches its keys through fn. Keys must
+// be comparable.
+func NewLoader(fn BatchFunc) *Loader {
+	return &Loader{batch: fn, results: map[interface{}]*loaded{}}
+}
+
+// Load() returns a thunk for the value of a key
+func (l *Loader) Load(key interface{}) Thunk {
+	result, ok := l.results[key]
+	if !ok {
+		result = &loaded{}
+		l.results[key] = result
+		l.pending = append(l.pending, key)
+	}
+	return func() (interface{}, error) {
+		if !result.done {
+			l.dispatch()
+		}
+		return result.value, result.err
+	}
+}
+
+// dispatch() loads every pending key
+func (l *Loader) dispatch() {
+	keys := l.pending
+	l.pending = nil
+	if len(keys) == 0 {
+		return
+	}
+	values, err := l.batch(keys)
+	if err == nil && len(values) != len(keys) {
+		err = NewError(codeResolverFailed, "the loader returned the wrong number of values")
+	}
+	for i, key := range keys {
+		result := l.results[key]
+		result.done = true
+		if err != nil {
+			result.err = err
+			continue
+		}
+		result.value = values[i]
+	}
+}
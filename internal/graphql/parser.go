@@ -0,0 +1,611 @@
+// Filename: internal/graphql/parser.go
+
+package graphql
+
+import (
+	"fmt"
+)
+
+// Limits that keep documents cheap to parse. The depth of the response is
+// limited separately, once the document is known to be valid.
+const (
+	MaxDocumentLength = 100_000
+	maxNesting        = 100
+)
+
+// A document holds the operations and fragments of a request
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind         string // query, mutation or subscription
+	name         string
+	variables    []*variableDefinition
+	directives   []*directive
+	selectionSet []selection
+	loc          Location
+}
+
+type variableDefinition struct {
+	name     string
+	typ      *typeRef
+	defValue *value
+	loc      Location
+}
+
+// A typeRef is a type as written in a variable definition. Lists have an
+// element type and no name.
+type typeRef struct {
+	name    string
+	elem    *typeRef
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// A selection is a *field, *fragmentSpread or *inlineFragment
+type selection interface {
+	location() Location
+}
+
+type field struct {
+	alias        string
+	name         string
+	arguments    []*argument
+	directives   []*directive
+	selectionSet []selection
+	loc          Location
+}
+
+// key() is the name of the field in the response
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	loc        Location
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []*directive
+	selectionSet  []selection
+	loc           Location
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []*directive
+	selectionSet  []selection
+	loc           Location
+}
+
+func (f *field) location() Location          { return f.loc }
+func (f *fragmentSpread) location() Location { return f.loc }
+func (f *inlineFragment) location() Location { return f.loc }
+
+type argument struct {
+	name  string
+	value *value
+	loc   Location
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+	loc       Location
+}
+
+type valueKind int
+
+const (
+	variableValue valueKind = iota
+	intValue
+	floatValue
+	stringValue
+	booleanValue
+	nullValue
+	enumValue
+	listValue
+	objectValue
+)
+
+// A value is a literal in the document. Scalars keep their text, variables
+// their name, lists their elements and objects their fields.
+type value struct {
+	kind   valueKind
+	text   string
+	list   []*value
+	fields []*objectField
+	loc    Location
+}
+
+type objectField struct {
+	name  string
+	value *value
+	loc   Location
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	nesting int
+}
+
+// parse() reads an executable document
+func parse(input string) (*document, error) {
+	if len(input) > MaxDocumentLength {
+		return nil, &SyntaxError{Loc: Location{Line: 1, Column: 1}, Msg: fmt.Sprintf("the document is longer than %d bytes", MaxDocumentLength)}
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	doc := &document{fragments: map[string]*fragment{}}
+	if p.peek().kind == tokenEOF {
+		return nil, p.errorf("the document has no operations")
+	}
+	for p.peek().kind != tokenEOF {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenPunct && tok.text == "{":
+			set, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selectionSet: set, loc: tok.loc})
+		case tok.kind == tokenName && (tok.text == "query" || tok.text == "mutation" || tok.text == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case tok.kind == tokenName && tok.text == "fragment":
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[f.name]; ok {
+				return nil, &SyntaxError{Loc: f.loc, Msg: fmt.Sprintf("there is more than one fragment named %q", f.name)}
+			}
+			doc.fragments[f.name] = f
+		default:
+			return nil, p.errorf("expected an operation or fragment, found %s", describe(tok))
+		}
+	}
+	return doc, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Loc: p.peek().loc, Msg: fmt.Sprintf(format, args...)}
+}
+
+// describe() names a token for an error message
+func describe(tok token) string {
+	switch tok.kind {
+	case tokenEOF:
+		return "the end of the document"
+	case tokenString:
+		return "a string"
+	}
+	return fmt.Sprintf("%q", tok.text)
+}
+
+// isPunct() reports whether the next token is the punctuator
+func (p *parser) isPunct(text string) bool {
+	tok := p.peek()
+	return tok.kind == tokenPunct && tok.text == text
+}
+
+func (p *parser) expectPunct(text string) error {
+	if !p.isPunct(text) {
+		return p.errorf("expected %q, found %s", text, describe(p.peek()))
+	}
+	p.advance()
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokenName {
+		return "", p.errorf("expected a name, found %s", describe(tok))
+	}
+	p.advance()
+	return tok.text, nil
+}
+
+// enter() guards against documents nested deep enough to exhaust the stack
+func (p *parser) enter() error {
+	p.nesting++
+	if p.nesting > maxNesting {
+		return p.errorf("the document is nested more than %d levels deep", maxNesting)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.nesting--
+}
+
+func (p *parser) operation() (*operation, error) {
+	tok := p.advance()
+	op := &operation{kind: tok.text, loc: tok.loc}
+	if p.peek().kind == tokenName {
+		op.name = p.advance().text
+	}
+	if p.isPunct("(") {
+		p.advance()
+		for !p.isPunct(")") {
+			def, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+		p.advance()
+	}
+	var err error
+	op.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	op.selectionSet, err = p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (*variableDefinition, error) {
+	def := &variableDefinition{loc: p.peek().loc}
+	err := p.expectPunct("$")
+	if err != nil {
+		return nil, err
+	}
+	def.name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expectPunct(":")
+	if err != nil {
+		return nil, err
+	}
+	def.typ, err = p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if p.isPunct("=") {
+		p.advance()
+		def.defValue, err = p.value(true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Directives on variable definitions are accepted and ignored
+	_, err = p.directives()
+	return def, err
+}
+
+func (p *parser) typeRef() (*typeRef, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	t := &typeRef{}
+	if p.isPunct("[") {
+		p.advance()
+		elem, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		t.elem = elem
+		err = p.expectPunct("]")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		t.name = name
+	}
+	if p.isPunct("!") {
+		p.advance()
+		t.nonNull = true
+	}
+	return t, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	err := p.expectPunct("{")
+	if err != nil {
+		return nil, err
+	}
+	set := []selection{}
+	for !p.isPunct("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, s)
+	}
+	p.advance()
+	if len(set) == 0 {
+		return nil, p.errorf("a selection set can't be empty")
+	}
+	return set, nil
+}
+
+func (p *parser) selection() (selection, error) {
+	if !p.isPunct("...") {
+		return p.field()
+	}
+	loc := p.advance().loc
+	tok := p.peek()
+	if tok.kind == tokenName && tok.text != "on" {
+		p.advance()
+		directives, err := p.directives()
+		if err != nil {
+			return nil, err
+		}
+		return &fragmentSpread{name: tok.text, directives: directives, loc: loc}, nil
+	}
+	inline := &inlineFragment{loc: loc}
+	if tok.kind == tokenName {
+		p.advance()
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		inline.typeCondition = name
+	}
+	var err error
+	inline.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	inline.selectionSet, err = p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return inline, nil
+}
+
+func (p *parser) field() (*field, error) {
+	f := &field{loc: p.peek().loc}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f.name = name
+	if p.isPunct(":") {
+		p.advance()
+		f.alias = name
+		f.name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.arguments, err = p.arguments(false)
+	if err != nil {
+		return nil, err
+	}
+	f.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		f.selectionSet, err = p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) arguments(constant bool) ([]*argument, error) {
+	if !p.isPunct("(") {
+		return nil, nil
+	}
+	p.advance()
+	args := []*argument{}
+	seen := map[string]bool{}
+	for !p.isPunct(")") {
+		arg := &argument{loc: p.peek().loc}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, &SyntaxError{Loc: arg.loc, Msg: fmt.Sprintf("the argument %q is given more than once", name)}
+		}
+		seen[name] = true
+		arg.name = name
+		err = p.expectPunct(":")
+		if err != nil {
+			return nil, err
+		}
+		arg.value, err = p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.advance()
+	if len(args) == 0 {
+		return nil, p.errorf("an argument list can't be empty")
+	}
+	return args, nil
+}
+
+func (p *parser) directives() ([]*directive, error) {
+	directives := []*directive{}
+	for p.isPunct("@") {
+		d := &directive{loc: p.advance().loc}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		d.name = name
+		d.arguments, err = p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	f := &fragment{loc: p.advance().loc}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, &SyntaxError{Loc: f.loc, Msg: "a fragment can't be named on"}
+	}
+	f.name = name
+	tok := p.peek()
+	if tok.kind != tokenName || tok.text != "on" {
+		return nil, p.errorf("expected \"on\", found %s", describe(tok))
+	}
+	p.advance()
+	f.typeCondition, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	f.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	f.selectionSet, err = p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// value() reads a literal. Constant values, such as the defaults of
+// variables, can't refer to variables.
+func (p *parser) value(constant bool) (*value, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	tok := p.peek()
+	v := &value{loc: tok.loc, text: tok.text}
+	switch tok.kind {
+	case tokenInt:
+		v.kind = intValue
+	case tokenFloat:
+		v.kind = floatValue
+	case tokenString:
+		v.kind = stringValue
+	case tokenName:
+		switch tok.text {
+		case "true", "false":
+			v.kind = booleanValue
+		case "null":
+			v.kind = nullValue
+		default:
+			v.kind = enumValue
+		}
+	case tokenPunct:
+		switch tok.text {
+		case "$":
+			if constant {
+				return nil, p.errorf("variables can't be used here")
+			}
+			p.advance()
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			v.kind = variableValue
+			v.text = name
+			return v, nil
+		case "[":
+			p.advance()
+			v.kind = listValue
+			v.list = []*value{}
+			for !p.isPunct("]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.list = append(v.list, item)
+			}
+			p.advance()
+			return v, nil
+		case "{":
+			p.advance()
+			v.kind = objectValue
+			v.fields = []*objectField{}
+			seen := map[string]bool{}
+			for !p.isPunct("}") {
+				of := &objectField{loc: p.peek().loc}
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if seen[name] {
+					return nil, &SyntaxError{Loc: of.loc, Msg: fmt.Sprintf("the field %q is given more than once", name)}
+				}
+				seen[name] = true
+				of.name = name
+				err = p.expectPunct(":")
+				if err != nil {
+					return nil, err
+				}
+				of.value, err = p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.fields = append(v.fields, of)
+			}
+			p.advance()
+			return v, nil
+		}
+		return nil, p.errorf("expected a value, found %s", describe(tok))
+	default:
+		return nil, p.errorf("expected a value, found %s", describe(tok))
+	}
+	p.advance()
+	return v, nil
+}
@@ -0,0 +1,446 @@
+// Filename: internal/graphql/schema.go
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Type is a *Scalar, *Object, *InputObject, *List or *NonNull
+type Type interface {
+	String() string
+}
+
+// A Scalar is a leaf value
+type Scalar struct {
+	Name        string
+	Description string
+	// Serialize() converts a resolved value for the response
+	Serialize func(v interface{}) (interface{}, error)
+	// ParseValue() converts an input value, which is a string, bool,
+	// int64 or float64 from a literal, or a decoded JSON value from the
+	// variables
+	ParseValue func(v interface{}) (interface{}, error)
+}
+
+// An Object has fields that are resolved. Its fields may be added after it
+// is created, so that objects can refer to each other.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+	fieldMap    map[string]*Field
+}
+
+// A Field of an object, with its arguments and resolver
+type Field struct {
+	Name        string
+	Description string
+	Args        []*Argument
+	Type        Type
+	// Multiplier() estimates how many times the selection of the field is
+	// resolved, from its arguments, so that lists count for their size in
+	// the complexity of a query. Nil means once.
+	Multiplier func(args map[string]interface{}) int
+	// Resolve() returns the value of the field, or a Thunk that returns it.
+	// Nil returns the value of the source's map entry with the field's name.
+	Resolve ResolveFunc
+}
+
+// An Argument of a field, or a field of an input object
+type Argument struct {
+	Name        string
+	Description string
+	Type        Type
+	// The value used when the argument isn't given, nil for none
+	Default interface{}
+}
+
+// An InputObject is an object given as an argument
+type InputObject struct {
+	Name        string
+	Description string
+	Fields      []*Argument
+}
+
+// A List holds values of its element type
+type List struct {
+	Of Type
+}
+
+// A NonNull type can't be null
+type NonNull struct {
+	Of Type
+}
+
+func (t *Scalar) String() string      { return t.Name }
+func (t *Object) String() string      { return t.Name }
+func (t *InputObject) String() string { return t.Name }
+func (t *List) String() string        { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string     { return t.Of.String() + "!" }
+
+// ResolveParams holds what a resolver is given
+type ResolveParams struct {
+	Context context.Context
+	// The value of the object the field belongs to, nil for root fields
+	Source interface{}
+	// The arguments that were given, or have a default. Arguments that
+	// weren't given are missing from the map.
+	Args map[string]interface{}
+}
+
+type ResolveFunc func(p ResolveParams) (interface{}, error)
+
+// The built in scalars
+var (
+	String = &Scalar{
+		Name:        "String",
+		Description: "Text",
+		Serialize: func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case fmt.Stringer:
+				return v.String(), nil
+			}
+			return nil, fmt.Errorf("can't serialize %T as a String", v)
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("must be a string")
+			}
+			return s, nil
+		},
+	}
+	Int = &Scalar{
+		Name:        "Int",
+		Description: "A 32 bit signed integer",
+		Serialize: func(v interface{}) (interface{}, error) {
+			n, ok := toInt64(v)
+			if !ok || n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("can't serialize %v as an Int", v)
+			}
+			return n, nil
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			n, ok := toInt64(v)
+			if !ok || n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, errors.New("must be a 32 bit integer")
+			}
+			return int(n), nil
+		},
+	}
+	Float = &Scalar{
+		Name:        "Float",
+		Description: "A double precision number",
+		Serialize: func(v interface{}) (interface{}, error) {
+			f, ok := toFloat64(v)
+			if !ok {
+				return nil, fmt.Errorf("can't serialize %v as a Float", v)
+			}
+			return f, nil
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			f, ok := toFloat64(v)
+			if !ok {
+				return nil, errors.New("must be a number")
+			}
+			return f, nil
+		},
+	}
+	Boolean = &Scalar{
+		Name:        "Boolean",
+		Description: "true or false",
+		Serialize: func(v interface{}) (interface{}, error) {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("can't serialize %v as a Boolean", v)
+			}
+			return b, nil
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, errors.New("must be true or false")
+			}
+			return b, nil
+		},
+	}
+	ID = &Scalar{
+		Name:        "ID",
+		Description: "An identifier, written as a string",
+		Serialize: func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			if n, ok := toInt64(v); ok {
+				return strconv.FormatInt(n, 10), nil
+			}
+			return nil, fmt.Errorf("can't serialize %v as an ID", v)
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			if n, ok := toInt64(v); ok {
+				return strconv.FormatInt(n, 10), nil
+			}
+			return nil, errors.New("must be a string or an integer")
+		},
+	}
+)
+
+var builtinScalars = []*Scalar{String, Int, Float, Boolean, ID}
+
+// toInt64() converts any integer, or a float without a fraction, to int64
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+			return int64(n), true
+		}
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// A Schema holds the root types and every type reachable from them
+type Schema struct {
+	Query    *Object
+	Mutation *Object
+	types    map[string]Type
+	// The named types in the order they were found, for printing
+	order []Type
+}
+
+// NewSchema() collects the types reachable from the roots and checks that
+// their names are unique and that inputs and outputs are used correctly
+func NewSchema(query, mutation *Object) (*Schema, error) {
+	s := &Schema{Query: query, Mutation: mutation, types: map[string]Type{}}
+	for _, scalar := range builtinScalars {
+		s.types[scalar.Name] = scalar
+	}
+	if query == nil {
+		return nil, errors.New("graphql: the schema needs a query type")
+	}
+	roots := []*Object{query}
+	if mutation != nil {
+		roots = append(roots, mutation)
+	}
+	for _, root := range roots {
+		if err := s.addOutput(root); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// named() strips lists and non-null wrappers from a type
+func named(t Type) Type {
+	for {
+		switch w := t.(type) {
+		case *List:
+			t = w.Of
+		case *NonNull:
+			t = w.Of
+		default:
+			return t
+		}
+	}
+}
+
+// register() records a named type, reporting whether it is new
+func (s *Schema) register(t Type) (bool, error) {
+	name := t.String()
+	if existing, ok := s.types[name]; ok {
+		if existing != t {
+			return false, fmt.Errorf("graphql: there is more than one type named %s", name)
+		}
+		return false, nil
+	}
+	s.types[name] = t
+	s.order = append(s.order, t)
+	return true, nil
+}
+
+func (s *Schema) addOutput(t Type) error {
+	switch t := named(t).(type) {
+	case *Scalar:
+		_, err := s.register(t)
+		return err
+	case *Object:
+		added, err := s.register(t)
+		if err != nil || !added {
+			return err
+		}
+		t.fieldMap = map[string]*Field{}
+		for _, f := range t.Fields {
+			if _, ok := t.fieldMap[f.Name]; ok || strings.HasPrefix(f.Name, "__") {
+				return fmt.Errorf("graphql: %s has an invalid or repeated field %s", t.Name, f.Name)
+			}
+			t.fieldMap[f.Name] = f
+			for _, arg := range f.Args {
+				if err := s.addInput(arg.Type); err != nil {
+					return err
+				}
+			}
+			if err := s.addOutput(f.Type); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("graphql: %s can't be the type of a field", t)
+}
+
+func (s *Schema) addInput(t Type) error {
+	switch t := named(t).(type) {
+	case *Scalar:
+		_, err := s.register(t)
+		return err
+	case *InputObject:
+		added, err := s.register(t)
+		if err != nil || !added {
+			return err
+		}
+		for _, f := range t.Fields {
+			if err := s.addInput(f.Type); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("graphql: %s can't be the type of an argument", t)
+}
+
+// field() looks up a field of an object
+func (o *Object) field(name string) *Field {
+	return o.fieldMap[name]
+}
+
+// String() prints the schema in the GraphQL schema definition language
+func (s *Schema) String() string {
+	var b strings.Builder
+	b.WriteString("schema {\n\tquery: " + s.Query.Name + "\n")
+	if s.Mutation != nil {
+		b.WriteString("\tmutation: " + s.Mutation.Name + "\n")
+	}
+	b.WriteString("}\n")
+	types := append([]Type{}, s.order...)
+	sort.SliceStable(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+	for _, t := range types {
+		switch t := t.(type) {
+		case *Scalar:
+			if isBuiltin(t) {
+				continue
+			}
+			b.WriteString("\n" + description(t.Description, ""))
+			b.WriteString("scalar " + t.Name + "\n")
+		case *Object:
+			b.WriteString("\n" + description(t.Description, ""))
+			b.WriteString("type " + t.Name + " {\n")
+			for _, f := range t.Fields {
+				b.WriteString(description(f.Description, "\t"))
+				b.WriteString("\t" + f.Name + printArguments(f.Args) + ": " + f.Type.String() + "\n")
+			}
+			b.WriteString("}\n")
+		case *InputObject:
+			b.WriteString("\n" + description(t.Description, ""))
+			b.WriteString("input " + t.Name + " {\n")
+			for _, f := range t.Fields {
+				b.WriteString(description(f.Description, "\t"))
+				b.WriteString("\t" + printArgument(f) + "\n")
+			}
+			b.WriteString("}\n")
+		}
+	}
+	return b.String()
+}
+
+func isBuiltin(t *Scalar) bool {
+	for _, scalar := range builtinScalars {
+		if scalar == t {
+			return true
+		}
+	}
+	return false
+}
+
+func description(text, indent string) string {
+	if text == "" {
+		return ""
+	}
+	return indent + quote(text) + "\n"
+}
+
+func printArguments(args []*Argument) string {
+	if len(args) == 0 {
+		return ""
+	}
+	printed := make([]string, len(args))
+	for i, arg := range args {
+		printed[i] = printArgument(arg)
+	}
+	return "(" + strings.Join(printed, ", ") + ")"
+}
+
+func printArgument(arg *Argument) string {
+	s := arg.Name + ": " + arg.Type.String()
+	if arg.Default != nil {
+		s += " = " + printValue(arg.Default)
+	}
+	return s
+}
+
+// printValue() writes a Go value as a GraphQL literal
+func printValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return quote(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = printValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+// quote() writes a string literal. JSON escaping is valid GraphQL.
+func quote(s string) string {
+	js, _ := json.Marshal(s)
+	return string(js)
+}
@@ -0,0 +1,626 @@
+// Filename: internal/graphql/validate.go
+
+package graphql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Limits bound the work a query can ask for. The depth counts the levels of
+// nested fields, and the complexity counts every field that will be
+// resolved, with lists counted for their size.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// A request that has been checked against the schema and is ready to run
+type prepared struct {
+	doc        *document
+	op         *operation
+	root       *Object
+	vars       map[string]interface{}
+	depth      int
+	complexity int
+}
+
+// checker validates a document against the schema
+type checker struct {
+	schema *Schema
+	doc    *document
+	op     *operation
+	vars   map[string]interface{}
+	// The variables the operation defines, with their types
+	varTypes    map[string]Type
+	varDefaults map[string]bool
+	errs        []*Error
+	// The cost and depth of each fragment, worked out once
+	fragments map[string]*fragmentCost
+}
+
+type fragmentCost struct {
+	cost, depth int
+	// Set while the fragment is being walked, to find cycles
+	walking bool
+}
+
+// prepare() picks the operation, coerces the variables and checks the
+// document against the schema and the limits
+func (s *Schema) prepare(doc *document, operationName string, variables map[string]interface{}, limits Limits) (*prepared, []*Error) {
+	c := &checker{schema: s, doc: doc, vars: map[string]interface{}{}, varTypes: map[string]Type{}, varDefaults: map[string]bool{}, fragments: map[string]*fragmentCost{}}
+	op, err := c.pickOperation(operationName)
+	if err != nil {
+		return nil, []*Error{err}
+	}
+	c.op = op
+	var root *Object
+	switch op.kind {
+	case "query":
+		root = s.Query
+	case "mutation":
+		root = s.Mutation
+	}
+	if root == nil {
+		return nil, []*Error{newLocatedError(codeValidationFailed, fmt.Sprintf("%s operations are not supported", op.kind), op.loc)}
+	}
+	c.coerceVariables(variables)
+	if len(c.errs) > 0 {
+		return nil, c.errs
+	}
+	cost, depth := c.selectionSet(root, op.selectionSet, 1)
+	c.checkDirectives(op.directives)
+	for name := range doc.fragments {
+		if _, ok := c.fragments[name]; !ok {
+			c.errs = append(c.errs, newLocatedError(codeValidationFailed, fmt.Sprintf("the fragment %q is never used", name), doc.fragments[name].loc))
+		}
+	}
+	if len(c.errs) > 0 {
+		return nil, c.errs
+	}
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return nil, []*Error{newError(codeTooDeep, fmt.Sprintf("the query is nested %d levels deep, more than the limit of %d", depth, limits.MaxDepth))}
+	}
+	if limits.MaxComplexity > 0 && cost > limits.MaxComplexity {
+		return nil, []*Error{newError(codeTooComplex, fmt.Sprintf("the query has a complexity of %d, more than the limit of %d", cost, limits.MaxComplexity))}
+	}
+	return &prepared{doc: doc, op: op, root: root, vars: c.vars, depth: depth, complexity: cost}, nil
+}
+
+func (c *checker) pickOperation(name string) (*operation, *Error) {
+	if name == "" {
+		if len(c.doc.operations) > 1 {
+			return nil, newError(codeValidationFailed, "the document has more than one operation, so operationName must be given")
+		}
+		return c.doc.operations[0], nil
+	}
+	var found *operation
+	for _, op := range c.doc.operations {
+		if op.name == name {
+			if found != nil {
+				return nil, newLocatedError(codeValidationFailed, fmt.Sprintf("there is more than one operation named %q", name), op.loc)
+			}
+			found = op
+		}
+	}
+	if found == nil {
+		return nil, newError(codeValidationFailed, fmt.Sprintf("there is no operation named %q", name))
+	}
+	return found, nil
+}
+
+func (c *checker) errorf(loc Location, format string, args ...interface{}) {
+	c.errs = append(c.errs, newLocatedError(codeValidationFailed, fmt.Sprintf(format, args...), loc))
+}
+
+// typeOf() resolves the type written in a variable definition
+func (c *checker) typeOf(ref *typeRef) (Type, error) {
+	var t Type
+	if ref.elem != nil {
+		elem, err := c.typeOf(ref.elem)
+		if err != nil {
+			return nil, err
+		}
+		t = &List{Of: elem}
+	} else {
+		named, ok := c.schema.types[ref.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", ref.name)
+		}
+		switch named.(type) {
+		case *Scalar, *InputObject:
+		default:
+			return nil, fmt.Errorf("%s can't be the type of a variable", ref.name)
+		}
+		t = named
+	}
+	if ref.nonNull {
+		t = &NonNull{Of: t}
+	}
+	return t, nil
+}
+
+// coerceVariables() checks the values given for the variables, and fills in
+// defaults. Variables that are neither given nor defaulted stay missing.
+func (c *checker) coerceVariables(values map[string]interface{}) {
+	for _, def := range c.op.variables {
+		if _, ok := c.varTypes[def.name]; ok {
+			c.errorf(def.loc, "the variable $%s is defined more than once", def.name)
+			continue
+		}
+		t, err := c.typeOf(def.typ)
+		if err != nil {
+			c.errorf(def.loc, "the variable $%s has an %v", def.name, err)
+			continue
+		}
+		c.varTypes[def.name] = t
+		c.varDefaults[def.name] = def.defValue != nil
+		if v, ok := values[def.name]; ok {
+			coerced, err := coerceInput(v, t)
+			if err != nil {
+				c.errorf(def.loc, "the variable $%s %v", def.name, err)
+				continue
+			}
+			c.vars[def.name] = coerced
+			continue
+		}
+		if def.defValue != nil {
+			coerced, err := c.coerceLiteral(def.defValue, t)
+			if err != nil {
+				c.errorf(def.loc, "the default of $%s %v", def.name, err)
+				continue
+			}
+			c.vars[def.name] = coerced
+			continue
+		}
+		if _, ok := t.(*NonNull); ok {
+			c.errorf(def.loc, "the variable $%s must be provided", def.name)
+		}
+	}
+}
+
+// coerceInput() checks a decoded JSON value against an input type
+func coerceInput(v interface{}, t Type) (interface{}, error) {
+	if nn, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("must not be null")
+		}
+		return coerceInput(v, nn.Of)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *Scalar:
+		parsed, err := t.ParseValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return parsed, nil
+	case *List:
+		items, ok := v.([]interface{})
+		if !ok {
+			// A single value is a list of one
+			item, err := coerceInput(v, t.Of)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			coerced, err := coerceInput(item, t.Of)
+			if err != nil {
+				return nil, fmt.Errorf("at index %d %v", i, err)
+			}
+			list[i] = coerced
+		}
+		return list, nil
+	case *InputObject:
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("must be an object")
+		}
+		return coerceObject(t, func(name string) (interface{}, bool, error) {
+			value, ok := fields[name]
+			return value, ok, nil
+		}, func(name string) bool {
+			_, ok := fields[name]
+			return ok
+		}, fieldNames(fields), coerceInput)
+	}
+	return nil, fmt.Errorf("can't be given a value of type %s", t)
+}
+
+func fieldNames(fields map[string]interface{}) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	return names
+}
+
+// coerceObject() builds the value of an input object from a lookup of its
+// given fields, checking for unknown and missing fields
+func coerceObject(t *InputObject, lookup func(name string) (interface{}, bool, error), given func(name string) bool, names []string, coerce func(v interface{}, t Type) (interface{}, error)) (interface{}, error) {
+	known := map[string]bool{}
+	result := map[string]interface{}{}
+	for _, f := range t.Fields {
+		known[f.Name] = true
+		v, ok, err := lookup(f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("has a field %s that %v", f.Name, err)
+		}
+		if !ok {
+			if f.Default != nil {
+				result[f.Name] = f.Default
+				continue
+			}
+			if _, nonNull := f.Type.(*NonNull); nonNull {
+				return nil, fmt.Errorf("is missing the field %s", f.Name)
+			}
+			continue
+		}
+		coerced, err := coerce(v, f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("has a field %s that %v", f.Name, err)
+		}
+		result[f.Name] = coerced
+	}
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("has an unknown field %s", name)
+		}
+	}
+	return result, nil
+}
+
+// literalValue() converts a scalar literal to the value ParseValue() takes
+func literalValue(v *value) (interface{}, error) {
+	switch v.kind {
+	case intValue:
+		n, err := strconv.ParseInt(v.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("has an integer that is out of range")
+		}
+		return n, nil
+	case floatValue:
+		f, err := strconv.ParseFloat(v.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("has a number that is out of range")
+		}
+		return f, nil
+	case stringValue:
+		return v.text, nil
+	case booleanValue:
+		return v.text == "true", nil
+	}
+	return nil, fmt.Errorf("can't be %s", v.text)
+}
+
+// coerceLiteral() checks a literal against an input type, substituting the
+// values of variables. A missing variable counts as null.
+func (c *checker) coerceLiteral(v *value, t Type) (interface{}, error) {
+	if v.kind == variableValue {
+		varType, ok := c.varTypes[v.text]
+		if !ok {
+			return nil, fmt.Errorf("uses the undefined variable $%s", v.text)
+		}
+		if !usableAs(varType, t, c.varDefaults[v.text]) {
+			return nil, fmt.Errorf("uses the variable $%s of type %s where %s is expected", v.text, varType, t)
+		}
+		value := c.vars[v.text]
+		if _, nonNull := t.(*NonNull); nonNull && value == nil {
+			return nil, fmt.Errorf("must not be null")
+		}
+		return value, nil
+	}
+	if nn, ok := t.(*NonNull); ok {
+		if v.kind == nullValue {
+			return nil, fmt.Errorf("must not be null")
+		}
+		return c.coerceLiteral(v, nn.Of)
+	}
+	if v.kind == nullValue {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *Scalar:
+		raw, err := literalValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return t.ParseValue(raw)
+	case *List:
+		if v.kind != listValue {
+			item, err := c.coerceLiteral(v, t.Of)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		list := make([]interface{}, len(v.list))
+		for i, item := range v.list {
+			coerced, err := c.coerceLiteral(item, t.Of)
+			if err != nil {
+				return nil, fmt.Errorf("at index %d %v", i, err)
+			}
+			list[i] = coerced
+		}
+		return list, nil
+	case *InputObject:
+		if v.kind != objectValue {
+			return nil, fmt.Errorf("must be an object")
+		}
+		fields := map[string]*value{}
+		names := []string{}
+		for _, f := range v.fields {
+			fields[f.name] = f.value
+			names = append(names, f.name)
+		}
+		return coerceObject(t, func(name string) (interface{}, bool, error) {
+			f, ok := fields[name]
+			if !ok {
+				return nil, false, nil
+			}
+			// A field set to a missing variable counts as not given
+			if f.kind == variableValue {
+				if _, given := c.vars[f.text]; !given {
+					if _, defined := c.varTypes[f.text]; defined {
+						return nil, false, nil
+					}
+				}
+			}
+			return f, true, nil
+		}, func(name string) bool {
+			_, ok := fields[name]
+			return ok
+		}, names, func(raw interface{}, t Type) (interface{}, error) {
+			return c.coerceLiteral(raw.(*value), t)
+		})
+	}
+	return nil, fmt.Errorf("can't be given a value of type %s", t)
+}
+
+// usableAs() reports whether a variable of one type can be used where
+// another is expected. A nullable variable with a default can fill a
+// non-null position.
+func usableAs(varType, expected Type, hasDefault bool) bool {
+	if nn, ok := expected.(*NonNull); ok {
+		if inner, ok := varType.(*NonNull); ok {
+			return usableAs(inner.Of, nn.Of, false)
+		}
+		return hasDefault && usableAs(varType, nn.Of, false)
+	}
+	if inner, ok := varType.(*NonNull); ok {
+		return usableAs(inner.Of, expected, false)
+	}
+	if list, ok := expected.(*List); ok {
+		varList, ok := varType.(*List)
+		return ok && usableAs(varList.Of, list.Of, false)
+	}
+	return varType == expected
+}
+
+// coerceArguments() checks the arguments given to a field or directive and
+// fills in defaults. Missing arguments without a default are left out.
+func (c *checker) coerceArguments(defs []*Argument, args []*argument, where string, loc Location) (map[string]interface{}, bool) {
+	values := map[string]interface{}{}
+	ok := true
+	given := map[string]*argument{}
+	for _, arg := range args {
+		given[arg.name] = arg
+	}
+	for _, arg := range args {
+		found := false
+		for _, def := range defs {
+			found = found || def.Name == arg.name
+		}
+		if !found {
+			c.errorf(arg.loc, "%s has no argument %q", where, arg.name)
+			ok = false
+		}
+	}
+	for _, def := range defs {
+		arg, present := given[def.Name]
+		// An argument set to a missing variable counts as not given
+		if present && arg.value.kind == variableValue {
+			if _, set := c.vars[arg.value.text]; !set {
+				if _, defined := c.varTypes[arg.value.text]; defined {
+					present = false
+				}
+			}
+		}
+		if !present {
+			if def.Default != nil {
+				values[def.Name] = def.Default
+			} else if _, nonNull := def.Type.(*NonNull); nonNull {
+				c.errorf(loc, "%s needs the argument %q", where, def.Name)
+				ok = false
+			}
+			continue
+		}
+		v, err := c.coerceLiteral(arg.value, def.Type)
+		if err != nil {
+			c.errorf(arg.loc, "the argument %q of %s %v", def.Name, where, err)
+			ok = false
+			continue
+		}
+		values[def.Name] = v
+	}
+	return values, ok
+}
+
+// The directives the executor understands
+var directiveArgs = []*Argument{{Name: "if", Type: &NonNull{Of: Boolean}}}
+
+func (c *checker) checkDirectives(directives []*directive) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			c.errorf(d.loc, "unknown directive @%s", d.name)
+			continue
+		}
+		c.coerceArguments(directiveArgs, d.arguments, "@"+d.name, d.loc)
+	}
+}
+
+// selectionSet() checks the selections on an object type and returns their
+// cost and the depth of the deepest field. Fragments are walked once, and
+// their cost reused wherever they are spread.
+func (c *checker) selectionSet(t *Object, set []selection, depth int) (int, int) {
+	cost, maxDepth := 0, 0
+	keys := map[string]*field{}
+	for _, sel := range set {
+		var selCost, selDepth int
+		switch sel := sel.(type) {
+		case *field:
+			c.checkDirectives(sel.directives)
+			selCost, selDepth = c.field(t, sel, depth)
+			if other, ok := keys[sel.key()]; ok && !sameField(other, sel) {
+				c.errorf(sel.loc, "the fields named %q select different fields or arguments", sel.key())
+			}
+			keys[sel.key()] = sel
+		case *inlineFragment:
+			c.checkDirectives(sel.directives)
+			if sel.typeCondition != "" && sel.typeCondition != t.Name {
+				c.errorf(sel.loc, "the fragment on %s can't be spread on %s", sel.typeCondition, t.Name)
+				continue
+			}
+			selCost, selDepth = c.selectionSet(t, sel.selectionSet, depth)
+		case *fragmentSpread:
+			c.checkDirectives(sel.directives)
+			selCost, selDepth = c.spread(t, sel, depth)
+		}
+		cost = saturatingAdd(cost, selCost)
+		if selDepth > maxDepth {
+			maxDepth = selDepth
+		}
+	}
+	return cost, maxDepth
+}
+
+func (c *checker) spread(t *Object, sel *fragmentSpread, depth int) (int, int) {
+	f, ok := c.doc.fragments[sel.name]
+	if !ok {
+		c.errorf(sel.loc, "unknown fragment %q", sel.name)
+		return 0, 0
+	}
+	if f.typeCondition != t.Name {
+		c.errorf(sel.loc, "the fragment %q on %s can't be spread on %s", sel.name, f.typeCondition, t.Name)
+		return 0, 0
+	}
+	fc, ok := c.fragments[sel.name]
+	if !ok {
+		// Depths are worked out relative to the fragment, so that they can
+		// be reused at any level
+		fc = &fragmentCost{walking: true}
+		c.fragments[sel.name] = fc
+		c.checkDirectives(f.directives)
+		fc.cost, fc.depth = c.selectionSet(t, f.selectionSet, 1)
+		fc.walking = false
+	} else if fc.walking {
+		c.errorf(sel.loc, "the fragment %q spreads itself", sel.name)
+		return 0, 0
+	}
+	if fc.depth == 0 {
+		return fc.cost, 0
+	}
+	return fc.cost, depth - 1 + fc.depth
+}
+
+func (c *checker) field(t *Object, f *field, depth int) (int, int) {
+	if f.name == "__typename" {
+		if len(f.arguments) > 0 || f.selectionSet != nil {
+			c.errorf(f.loc, "__typename takes no arguments or selections")
+		}
+		return 0, depth
+	}
+	def := t.field(f.name)
+	if def == nil {
+		c.errorf(f.loc, "%s has no field %q", t.Name, f.name)
+		return 0, depth
+	}
+	where := t.Name + "." + f.name
+	args, ok := c.coerceArguments(def.Args, f.arguments, where, f.loc)
+	switch inner := named(def.Type).(type) {
+	case *Scalar:
+		if f.selectionSet != nil {
+			c.errorf(f.loc, "%s is a %s and can't have a selection", where, inner.Name)
+		}
+		return 1, depth
+	case *Object:
+		if f.selectionSet == nil {
+			c.errorf(f.loc, "%s is a %s and needs a selection", where, inner.Name)
+			return 1, depth
+		}
+		cost, childDepth := c.selectionSet(inner, f.selectionSet, depth+1)
+		multiplier := 1
+		if def.Multiplier != nil && ok {
+			multiplier = def.Multiplier(args)
+		}
+		return saturatingAdd(1, saturatingMul(multiplier, cost)), childDepth
+	}
+	return 1, depth
+}
+
+// sameField() reports whether two selections with the same response key
+// can be merged
+func sameField(a, b *field) bool {
+	if a.name != b.name || len(a.arguments) != len(b.arguments) {
+		return false
+	}
+	for _, argA := range a.arguments {
+		found := false
+		for _, argB := range b.arguments {
+			if argA.name == argB.name && printLiteral(argA.value) == printLiteral(argB.value) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// printLiteral() writes a literal back out, to compare two of them
+func printLiteral(v *value) string {
+	switch v.kind {
+	case variableValue:
+		return "$" + v.text
+	case stringValue:
+		return quote(v.text)
+	case listValue:
+		items := make([]string, len(v.list))
+		for i, item := range v.list {
+			items[i] = printLiteral(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case objectValue:
+		fields := make([]string, len(v.fields))
+		for i, f := range v.fields {
+			fields[i] = f.name + ":" + printLiteral(f.value)
+		}
+		return "{" + strings.Join(fields, ",") + "}"
+	}
+	return v.text
+}
+
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+func saturatingMul(a, b int) int {
+	if a < 1 {
+		a = 1
+	}
+	if b != 0 && a > math.MaxInt32/b {
+		return math.MaxInt32
+	}
+	return a * b
+}
@@ -0,0 +1,203 @@
+// Filename: internal/ical/ical.go
+
+// Package ical reads and writes the iCalendar format of RFC 5545. It deals
+// in content lines and components only; what the properties mean is left to
+// the caller.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// The longest a content line may be, in octets, not counting the line break
+const maxLineOctets = 75
+
+// A Param is a property parameter, such as VALUE=DATE
+type Param struct {
+	Name   string
+	Values []string
+}
+
+// A Property is a content line of a component
+type Property struct {
+	Name   string
+	Params []Param
+	// The value as written, still escaped
+	Value string
+}
+
+// Text returns the value of a TEXT property with the escaping removed
+func (p Property) Text() string {
+	return UnescapeText(p.Value)
+}
+
+// A Component is a BEGIN/END block, such as a VCALENDAR or a VTODO
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+	// The line the component begins on, counting from 1
+	Line int
+}
+
+// Get returns the first property with the name, if there is one
+func (c *Component) Get(name string) (Property, bool) {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// All returns every property with the name
+func (c *Component) All(name string) []Property {
+	props := []Property{}
+	for _, p := range c.Properties {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// EscapeText escapes a value for a TEXT property
+func EscapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', ';', ',':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			// Line breaks are written as \n alone
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// UnescapeText removes the escaping from a TEXT value
+func UnescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// SplitList splits a list of TEXT values, such as CATEGORIES, on the commas
+// that are not escaped and unescapes each value
+func SplitList(s string) []string {
+	values := []string{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, UnescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, UnescapeText(s[start:]))
+}
+
+// A Writer writes content lines, folding them at 75 octets and ending them
+// with CRLF as RFC 5545 requires. The first error is kept and returned by
+// Flush.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Begin starts a component
+func (w *Writer) Begin(name string) {
+	w.Property("BEGIN", nil, name)
+}
+
+// End finishes a component
+func (w *Writer) End(name string) {
+	w.Property("END", nil, name)
+}
+
+// Text writes a TEXT property, escaping the value
+func (w *Writer) Text(name, value string) {
+	w.Property(name, nil, EscapeText(value))
+}
+
+// Property writes a content line. The value is written as it is, so TEXT
+// values must already be escaped.
+func (w *Writer) Property(name string, params []Param, value string) {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, param := range params {
+		b.WriteByte(';')
+		b.WriteString(param.Name)
+		b.WriteByte('=')
+		for i, v := range param.Values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if strings.ContainsAny(v, ";:,") {
+				v = `"` + v + `"`
+			}
+			b.WriteString(v)
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(value)
+	w.writeFolded(b.String())
+}
+
+// writeFolded() breaks a line into pieces of at most 75 octets, each after
+// the first starting with a space, without splitting a UTF-8 sequence
+func (w *Writer) writeFolded(line string) {
+	if w.err != nil {
+		return
+	}
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		_, w.err = w.w.WriteString(line[:cut] + "\r\n ")
+		if w.err != nil {
+			return
+		}
+		line = line[cut:]
+		// The leading space of a continuation counts towards its length
+		limit = maxLineOctets - 1
+	}
+	_, w.err = w.w.WriteString(line + "\r\n")
+}
+
+// Flush writes any buffered lines and reports the first error
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
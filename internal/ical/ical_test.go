@@ -0,0 +1,177 @@
+// Filename: internal/ical/ical_test.go
+
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		text, escaped string
+	}{
+		{"plain", "plain"},
+		{"a,b;c", `a\,b\;c`},
+		{`back\slash`, `back\\slash`},
+		{"two\nlines", `two\nlines`},
+		{"windows\r\nbreak", `windows\nbreak`},
+		{"ümlaut, €", `ümlaut\, €`},
+	}
+	for _, tt := range tests {
+		if got := EscapeText(tt.text); got != tt.escaped {
+			t.Errorf("EscapeText(%q) = %q, want %q", tt.text, got, tt.escaped)
+		}
+		want := strings.ReplaceAll(tt.text, "\r", "")
+		if got := UnescapeText(tt.escaped); got != want {
+			t.Errorf("UnescapeText(%q) = %q, want %q", tt.escaped, got, want)
+		}
+	}
+	// Other writers use \N for line breaks too
+	if got := UnescapeText(`a\Nb`); got != "a\nb" {
+		t.Errorf(`UnescapeText("a\\Nb") = %q`, got)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"work", []string{"work"}},
+		{"work,home", []string{"work", "home"}},
+		{`a\,b,c`, []string{"a,b", "c"}},
+		{`a\\,b`, []string{`a\`, "b"}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := SplitList(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// Lines are folded at 75 octets without splitting a character, whatever
+// falls on the boundary, and read back as they were
+func TestFoldingRoundTrip(t *testing.T) {
+	for _, char := range []string{"a", "é", "€", "😀"} {
+		for pad := 55; pad <= 80; pad++ {
+			value := strings.Repeat("x", pad) + strings.Repeat(char, 40) + ", end"
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			w.Begin("VTODO")
+			w.Text("SUMMARY", value)
+			w.End("VTODO")
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("%q doesn't end with CRLF", out)
+			}
+			for i, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+				if len(line) > maxLineOctets {
+					t.Errorf("%s pad %d: line %d is %d octets long", char, pad, i+1, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("%s pad %d: line %d splits a character: %q", char, pad, i+1, line)
+				}
+			}
+			components, err := Parse(&buf)
+			if err != nil {
+				t.Fatalf("%s pad %d: %v", char, pad, err)
+			}
+			summary, _ := components[0].Get("SUMMARY")
+			if got := summary.Text(); got != value {
+				t.Errorf("%s pad %d: read back %q, want %q", char, pad, got, value)
+			}
+		}
+	}
+}
+
+func TestWriterParams(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Property("DTSTART", []Param{{Name: "VALUE", Values: []string{"DATE"}}, {Name: "X-NOTE", Values: []string{"a:b", "c"}}}, "20240102")
+	w.Flush()
+	want := "DTSTART;VALUE=DATE;X-NOTE=\"a:b\",c:20240102\r\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VTODO\n" +
+		"summary;LANGUAGE=en:Buy \r\n" +
+		" milk\\, eggs\r\n" +
+		"\tand bread\r\n" +
+		"X-PARAM;X-A=\"x;y:z\",w;X-B=1:value:with:colons\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+	components, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != 1 || components[0].Name != "VCALENDAR" || len(components[0].Components) != 1 {
+		t.Fatalf("got %+v", components)
+	}
+	todo := components[0].Components[0]
+	if todo.Name != "VTODO" || todo.Line != 3 {
+		t.Errorf("got %s on line %d, want VTODO on line 3", todo.Name, todo.Line)
+	}
+	summary, ok := todo.Get("SUMMARY")
+	if !ok || summary.Text() != "Buy milk, eggsand bread" {
+		t.Errorf("got summary %+v", summary)
+	}
+	if want := []Param{{Name: "LANGUAGE", Values: []string{"en"}}}; !reflect.DeepEqual(summary.Params, want) {
+		t.Errorf("got params %+v, want %+v", summary.Params, want)
+	}
+	prop, _ := todo.Get("X-PARAM")
+	want := Property{
+		Name:   "X-PARAM",
+		Params: []Param{{Name: "X-A", Values: []string{"x;y:z", "w"}}, {Name: "X-B", Values: []string{"1"}}},
+		Value:  "value:with:colons",
+	}
+	if !reflect.DeepEqual(prop, want) {
+		t.Errorf("got %+v, want %+v", prop, want)
+	}
+	if all := todo.All("CATEGORIES"); len(all) != 0 {
+		t.Errorf("got categories %+v", all)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+		msg   string
+	}{
+		{"", 1, "no components found"},
+		{" continued\r\n", 1, "continuation line with nothing to continue"},
+		{"SUMMARY:x\r\n", 1, "property SUMMARY is outside a component"},
+		{"BEGIN:VTODO\r\nno colon\r\nEND:VTODO\r\n", 2, "expected NAME:value"},
+		{"BEGIN:VTODO\r\nX;A:b\r\nEND:VTODO\r\n", 2, "parameter of X has no value"},
+		{"BEGIN:VTODO\r\nX;A=\"b:c\r\nEND:VTODO\r\n", 2, "unterminated quote in parameter A"},
+		{"BEGIN:VTODO\r\nEND:VEVENT\r\n", 2, "unexpected END:VEVENT"},
+		{"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nEND:VCALENDAR\r\n", 3, "unexpected END:VCALENDAR"},
+		{"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nEND:VTODO\r\n", 1, "VCALENDAR is never ended"},
+		{"BEGIN:VTODO\r\nX:" + strings.Repeat("a", maxUnfoldedLine) + "\r\nEND:VTODO\r\n", 2, "line is too long"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.input))
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%.30q): got %v, want a *ParseError", tt.input, err)
+			continue
+		}
+		if parseErr.Line != tt.line || parseErr.Msg != tt.msg {
+			t.Errorf("Parse(%.30q): got %q on line %d, want %q on line %d", tt.input, parseErr.Msg, parseErr.Line, tt.msg, tt.line)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Filename: internal/ical/parse.go
+
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The longest unfolded content line that will be read
+const maxUnfoldedLine = 64 << 10
+
+// A ParseError reports a problem with the input and the line it is on
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse reads the components of an iCalendar stream, usually a single
+// VCALENDAR. Folded lines are joined before they are parsed, and both CRLF
+// and bare LF line breaks are accepted.
+func Parse(r io.Reader) ([]*Component, error) {
+	top := []*Component{}
+	stack := []*Component{}
+	err := unfold(r, func(n int, line string) error {
+		if line == "" {
+			return nil
+		}
+		prop, err := parseLine(line)
+		if err != nil {
+			return &ParseError{Line: n, Msg: err.Error()}
+		}
+		switch prop.Name {
+		case "BEGIN":
+			c := &Component{Name: strings.ToUpper(prop.Value), Line: n}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else {
+				top = append(top, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return &ParseError{Line: n, Msg: fmt.Sprintf("unexpected END:%s", prop.Value)}
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return &ParseError{Line: n, Msg: fmt.Sprintf("property %s is outside a component", prop.Name)}
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, prop)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stack) > 0 {
+		c := stack[len(stack)-1]
+		return nil, &ParseError{Line: c.Line, Msg: fmt.Sprintf("%s is never ended", c.Name)}
+	}
+	if len(top) == 0 {
+		return nil, &ParseError{Line: 1, Msg: "no components found"}
+	}
+	return top, nil
+}
+
+// unfold() calls fn with each logical line and the physical line it starts on
+func unfold(r io.Reader, fn func(n int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxUnfoldedLine)
+	var current strings.Builder
+	start, n := 0, 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if start == 0 {
+				return &ParseError{Line: n, Msg: "continuation line with nothing to continue"}
+			}
+			if current.Len()+len(line) > maxUnfoldedLine {
+				return &ParseError{Line: start, Msg: "line is too long"}
+			}
+			current.WriteString(line[1:])
+			continue
+		}
+		if start != 0 {
+			err := fn(start, current.String())
+			if err != nil {
+				return err
+			}
+		}
+		current.Reset()
+		current.WriteString(line)
+		start = n
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return &ParseError{Line: n + 1, Msg: "line is too long"}
+		}
+		return err
+	}
+	if start != 0 {
+		return fn(start, current.String())
+	}
+	return nil
+}
+
+// parseLine() splits a content line into its name, parameters and value.
+// Colons and semicolons inside quoted parameter values don't count.
+func parseLine(line string) (Property, error) {
+	var prop Property
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return prop, fmt.Errorf("expected NAME:value")
+	}
+	prop.Name = strings.ToUpper(line[:i])
+	for line[i] == ';' {
+		line = line[i+1:]
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return prop, fmt.Errorf("parameter of %s has no value", prop.Name)
+		}
+		param := Param{Name: strings.ToUpper(line[:eq])}
+		line = line[eq+1:]
+		// Read the comma separated values up to the next ; or :
+		for {
+			var value string
+			if strings.HasPrefix(line, `"`) {
+				end := strings.IndexByte(line[1:], '"')
+				if end == -1 {
+					return prop, fmt.Errorf("unterminated quote in parameter %s", param.Name)
+				}
+				value = line[1 : end+1]
+				line = line[end+2:]
+			} else {
+				end := strings.IndexAny(line, ",;:")
+				if end == -1 {
+					return prop, fmt.Errorf("expected NAME:value")
+				}
+				value = line[:end]
+				line = line[end:]
+			}
+			param.Values = append(param.Values, value)
+			if !strings.HasPrefix(line, ",") {
+				break
+			}
+			line = line[1:]
+		}
+		prop.Params = append(prop.Params, param)
+		if line == "" || (line[0] != ';' && line[0] != ':') {
+			return prop, fmt.Errorf("expected NAME:value")
+		}
+		i = 0
+	}
+	prop.Value = line[i+1:]
+	return prop, nil
+}
@@ -0,0 +1,404 @@
+// Filename: internal/jsonpatch/jsonpatch.go
+
+// Package jsonpatch applies JSON Patch (RFC 6902) and JSON Merge Patch
+// (RFC 7396) documents to JSON values.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch means the patch document itself is malformed
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed means a test operation did not match the document
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// An OperationError reports which operation of a patch could not be applied
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// An operation keeps its value raw, so that a missing value, which is left
+// empty, can be told apart from a null one
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply() applies a JSON Patch to a document. Operations are applied in
+// order and the whole patch fails if any of them fails.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []operation
+	err := json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	var root interface{}
+	err = decode(doc, &root)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, fmt.Errorf("%w: operation %d has no path", ErrInvalidPatch, i)
+		}
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Path: *op.Path, Err: err}
+		}
+		var value interface{}
+		var from []string
+		switch op.Op {
+		case "add", "replace", "test":
+			if len(op.Value) == 0 {
+				return nil, fmt.Errorf("%w: operation %d has no value", ErrInvalidPatch, i)
+			}
+			err = decode(op.Value, &value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, fmt.Errorf("%w: operation %d has no from", ErrInvalidPatch, i)
+			}
+			from, err = parsePointer(*op.From)
+			if err != nil {
+				return nil, &OperationError{Index: i, Op: op.Op, Path: *op.Path, Err: err}
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: unsupported operation %q", ErrInvalidPatch, op.Op)
+		}
+		switch op.Op {
+		case "add":
+			root, err = add(root, path, value)
+		case "remove":
+			root, err = remove(root, path)
+		case "replace":
+			if len(path) == 0 {
+				root = value
+				break
+			}
+			root, err = remove(root, path)
+			if err == nil {
+				root, err = add(root, path, value)
+			}
+		case "move":
+			// A value can't be moved into one of its own children
+			if len(from) < len(path) && isPrefix(from, path) {
+				err = errors.New("cannot move a value into itself")
+				break
+			}
+			value, err = get(root, from)
+			if err == nil && len(from) > 0 {
+				root, err = remove(root, from)
+			}
+			if err == nil {
+				root, err = add(root, path, value)
+			}
+		case "copy":
+			value, err = get(root, from)
+			if err == nil {
+				root, err = add(root, path, deepCopy(value))
+			}
+		case "test":
+			var current interface{}
+			current, err = get(root, path)
+			if err == nil && !equal(current, value) {
+				err = ErrTestFailed
+			}
+		}
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Path: *op.Path, Err: err}
+		}
+	}
+	return json.Marshal(root)
+}
+
+// ApplyMerge() applies a JSON Merge Patch to a document. Members of the
+// patch replace those of the document, null removes them, and objects are
+// merged recursively.
+func ApplyMerge(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	err := decode(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+	err = decode(patch, &p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = merge(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// equal() compares two decoded values as JSON values. Numbers are equal if
+// they have the same value, however they are written.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okX := new(big.Rat).SetString(string(a))
+		y, okY := new(big.Rat).SetString(string(b))
+		return okX && okY && x.Cmp(y) == 0
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	// Strings, booleans and null
+	return a == b
+}
+
+// deepCopy() copies the objects and arrays of a decoded value, so that a
+// copied value doesn't change along with the original
+func deepCopy(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for key, value := range n {
+			m[key] = deepCopy(value)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(n))
+		for i, value := range n {
+			a[i] = deepCopy(value)
+		}
+		return a
+	}
+	return node
+}
+
+// isPrefix() reports whether the path starts with the prefix
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decode() keeps numbers as json.Number so that they survive unchanged
+func decode(b []byte, dst *interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(dst)
+}
+
+// parsePointer() splits a JSON Pointer (RFC 6901) into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("path must start with /")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		// "~" only escapes "~0" and "~1". "~1" is decoded first, so that
+		// "~01" is "~1" rather than "/".
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, fmt.Errorf("invalid escape in %q", token)
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex() parses an array index token. "-" refers to the position after
+// the last element and is only allowed when adding.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in a scalar", token)
+		}
+	}
+	return node, nil
+}
+
+// add() returns the document with the value added at the path
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", token)
+		}
+		child, err := add(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		if len(rest) == 0 {
+			i, err := arrayIndex(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		n[i], err = add(n[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot add %q to a scalar", token)
+}
+
+// remove() returns the document with the value at the path removed
+func remove(node interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", token)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, nil
+		}
+		child, err := remove(child, rest)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			return append(n[:i], n[i+1:]...), nil
+		}
+		n[i], err = remove(n[i], rest)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot remove %q from a scalar", token)
+}
@@ -0,0 +1,245 @@
+// Filename: internal/jsonpatch/jsonpatch_test.go
+
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// canonical() re-encodes a JSON value so that documents can be compared
+// whatever the order of their members
+func canonical(t *testing.T, s string) string {
+	t.Helper()
+	var v interface{}
+	if err := decode([]byte(s), &v); err != nil {
+		t.Fatalf("decoding %s: %v", s, err)
+	}
+	js, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(js)
+}
+
+// The examples of RFC 6902 Appendix A
+func TestApplyRFC6902Examples(t *testing.T) {
+	tests := []applyTest{
+		{"A.1 adding an object member",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux"}]`,
+			`{"baz":"qux","foo":"bar"}`, nil},
+		{"A.2 adding an array element",
+			`{"foo":["bar","baz"]}`,
+			`[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			`{"foo":["bar","qux","baz"]}`, nil},
+		{"A.3 removing an object member",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"remove","path":"/baz"}]`,
+			`{"foo":"bar"}`, nil},
+		{"A.4 removing an array element",
+			`{"foo":["bar","qux","baz"]}`,
+			`[{"op":"remove","path":"/foo/1"}]`,
+			`{"foo":["bar","baz"]}`, nil},
+		{"A.5 replacing a value",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"replace","path":"/baz","value":"boo"}]`,
+			`{"baz":"boo","foo":"bar"}`, nil},
+		{"A.6 moving a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"A.7 moving an array element",
+			`{"foo":["all","grass","cows","eat"]}`,
+			`[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`, nil},
+		{"A.8 testing a value: success",
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"A.9 testing a value: error",
+			`{"baz":"qux"}`,
+			`[{"op":"test","path":"/baz","value":"bar"}]`,
+			``, ErrTestFailed},
+		{"A.10 adding a nested member object",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`, nil},
+		{"A.11 ignoring unrecognized elements",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			`{"foo":"bar","baz":"qux"}`, nil},
+		{"A.12 adding to a nonexistent target",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			``, errOperation},
+		{"A.14 ~ escape ordering",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":10}]`,
+			`{"/":9,"~1":10}`, nil},
+		{"A.15 comparing strings and numbers",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":"10"}]`,
+			``, ErrTestFailed},
+		{"A.16 adding an array value",
+			`{"foo":["bar"]}`,
+			`[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			`{"foo":["bar",["abc","def"]]}`, nil},
+	}
+	runApplyTests(t, tests)
+}
+
+// errOperation stands for any OperationError in the tests
+var errOperation = errors.New("operation error")
+
+// An applyTest applies a patch to a document, expecting either the result
+// or an error
+type applyTest struct {
+	name  string
+	doc   string
+	patch string
+	want  string
+	err   error
+}
+
+func runApplyTests(t *testing.T, tests []applyTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("got error %v", err)
+			case tt.err == nil:
+				if canonical(t, string(got)) != canonical(t, tt.want) {
+					t.Errorf("got %s, want %s", got, tt.want)
+				}
+			case tt.err == errOperation:
+				var opErr *OperationError
+				if !errors.As(err, &opErr) {
+					t.Errorf("got %v, want an OperationError", err)
+				}
+			case !errors.Is(err, tt.err):
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []applyTest{
+		// A null value is a value, unlike a missing one
+		{"replace with null", `{"a":1}`, `[{"op":"replace","path":"/a","value":null}]`, `{"a":null}`, nil},
+		{"add null", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`, nil},
+		{"test null", `{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`, nil},
+		{"test null against a value", `{"a":0}`, `[{"op":"test","path":"/a","value":null}]`, ``, ErrTestFailed},
+		{"replace without a value", `{"a":1}`, `[{"op":"replace","path":"/a"}]`, ``, ErrInvalidPatch},
+		{"test without a value", `{"a":1}`, `[{"op":"test","path":"/a"}]`, ``, ErrInvalidPatch},
+
+		// Numbers are compared by value
+		{"test 1 and 1.0", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`, nil},
+		{"test 100 and 1e2", `{"a":100}`, `[{"op":"test","path":"/a","value":1e2}]`, `{"a":100}`, nil},
+		{"test -0 and 0", `{"a":-0}`, `[{"op":"test","path":"/a","value":0}]`, `{"a":-0}`, nil},
+		{"test nested numbers", `{"a":[1,{"b":2.50}]}`, `[{"op":"test","path":"/a","value":[1.0,{"b":2.5}]}]`, `{"a":[1,{"b":2.50}]}`, nil},
+		{"test different numbers", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0000001}]`, ``, ErrTestFailed},
+		{"test an object with an extra member", `{"a":{"b":1}}`, `[{"op":"test","path":"/a","value":{"b":1,"c":2}}]`, ``, ErrTestFailed},
+		{"test a shorter array", `{"a":[1,2]}`, `[{"op":"test","path":"/a","value":[1]}]`, ``, ErrTestFailed},
+		{"test true and 1", `{"a":true}`, `[{"op":"test","path":"/a","value":1}]`, ``, ErrTestFailed},
+		// Numbers are written back as they were
+		{"numbers are kept", `{"a":1.50,"b":12345678901234567890}`, `[{"op":"add","path":"/c","value":1e2}]`, `{"a":1.50,"b":12345678901234567890,"c":1e2}`, nil},
+
+		// Missing paths
+		{"remove a missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, ``, errOperation},
+		{"replace a missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, ``, errOperation},
+		{"test a missing member", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, ``, errOperation},
+		{"no path", `{"a":1}`, `[{"op":"remove"}]`, ``, ErrInvalidPatch},
+		{"relative path", `{"a":1}`, `[{"op":"remove","path":"a"}]`, ``, errOperation},
+		{"look up in a scalar", `{"a":1}`, `[{"op":"add","path":"/a/b","value":2}]`, ``, errOperation},
+
+		// Array indexes
+		{"add at the end by index", `{"a":[1]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2]}`, nil},
+		{"add past the end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, ``, errOperation},
+		{"remove past the end", `{"a":[1]}`, `[{"op":"remove","path":"/a/1"}]`, ``, errOperation},
+		{"replace past the end", `{"a":[1]}`, `[{"op":"replace","path":"/a/5","value":2}]`, ``, errOperation},
+		{"negative index", `{"a":[1]}`, `[{"op":"remove","path":"/a/-1"}]`, ``, errOperation},
+		{"leading zero", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, ``, errOperation},
+		{"not a number", `{"a":[1]}`, `[{"op":"remove","path":"/a/x"}]`, ``, errOperation},
+		{"add with -", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, nil},
+		{"remove with -", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, ``, errOperation},
+		{"replace with -", `{"a":[1]}`, `[{"op":"replace","path":"/a/-","value":2}]`, ``, errOperation},
+		{"test with -", `{"a":[1]}`, `[{"op":"test","path":"/a/-","value":1}]`, ``, errOperation},
+		{"- in an object is a member name", `{"-":1}`, `[{"op":"remove","path":"/-"}]`, `{}`, nil},
+
+		// ~0 and ~1 escapes
+		{"~1 is /", `{"a/b":1}`, `[{"op":"remove","path":"/a~1b"}]`, `{}`, nil},
+		{"~0 is ~", `{"m~n":1}`, `[{"op":"replace","path":"/m~0n","value":2}]`, `{"m~n":2}`, nil},
+		{"~01 is ~1", `{"~1":1,"/":2}`, `[{"op":"remove","path":"/~01"}]`, `{"/":2}`, nil},
+		{"~10 is /0", `{"/0":1,"~0":2}`, `[{"op":"remove","path":"/~10"}]`, `{"~0":2}`, nil},
+		{"~2 is invalid", `{"~2":1}`, `[{"op":"remove","path":"/~2"}]`, ``, errOperation},
+		{"a trailing ~ is invalid", `{"a~":1}`, `[{"op":"remove","path":"/a~"}]`, ``, errOperation},
+		{"empty member name", `{"":1}`, `[{"op":"replace","path":"/","value":2}]`, `{"":2}`, nil},
+
+		// The whole document
+		{"replace the document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, nil},
+		{"remove the document", `{"a":1}`, `[{"op":"remove","path":""}]`, ``, errOperation},
+
+		// Moves and copies
+		{"move into itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, ``, errOperation},
+		{"move onto itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":{"b":1}}`, nil},
+		{"move a missing value", `{"a":1}`, `[{"op":"move","from":"/b","path":"/c"}]`, ``, errOperation},
+		{"move without from", `{"a":1}`, `[{"op":"move","path":"/c"}]`, ``, ErrInvalidPatch},
+		{"copies are independent", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+
+		// Malformed patches
+		{"unknown operation", `{}`, `[{"op":"merge","path":"/a"}]`, ``, ErrInvalidPatch},
+		{"not an array", `{}`, `{"op":"add","path":"/a","value":1}`, ``, ErrInvalidPatch},
+		// Nothing is applied if an operation fails
+		{"later failure", `{"a":1}`, `[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`, ``, ErrTestFailed},
+	}
+	runApplyTests(t, tests)
+}
+
+// The examples of RFC 7396 Appendix A
+func TestApplyMergeRFC7396Examples(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		got, err := ApplyMerge([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if canonical(t, string(got)) != canonical(t, tt.want) {
+			t.Errorf("%s + %s: got %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApplyMergeErrors(t *testing.T) {
+	if _, err := ApplyMerge([]byte(`{}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("truncated patch: got %v, want ErrInvalidPatch", err)
+	}
+	if _, err := ApplyMerge([]byte(`{`), []byte(`{}`)); err == nil || errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("truncated document: got %v, want a document error", err)
+	}
+}
@@ -0,0 +1,233 @@
+// Filename: internal/oidc/oidc_test.go
+
+package oidc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"quiz3.desireamagwula.net/internal/oidc"
+	"quiz3.desireamagwula.net/internal/oidc/oidctest"
+)
+
+const testClientID = "notes-api"
+
+func newTestProvider(idp *oidctest.Server, secret string) *oidc.Provider {
+	return oidc.NewProvider(idp.Issuer()+"/", testClientID, secret, "https://notes.example.com/v1/auth/oidc/callback")
+}
+
+// The RFC 7636 appendix B example
+func TestCodeChallenge(t *testing.T) {
+	got := oidc.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+	p := newTestProvider(idp, "")
+	d, err := p.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.TokenEndpoint != idp.URL+"/token" || d.JWKSURI != idp.URL+"/jwks" {
+		t.Errorf("got %+v", d)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"issuer mismatch", `{"issuer":"https://evil.example.com","authorization_endpoint":"a","token_endpoint":"t","jwks_uri":"j"}`},
+		{"missing endpoints", `{"issuer":"ISSUER","authorization_endpoint":"a"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strings.Replace(tt.doc, "ISSUER", srv.URL, 1)))
+			}))
+			defer srv.Close()
+			p := oidc.NewProvider(srv.URL, testClientID, "", "")
+			if _, err := p.Discover(context.Background()); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+// The full authorization code flow against the mock provider, for a public
+// and a confidential client
+func TestAuthorizationCodeFlow(t *testing.T) {
+	for _, secret := range []string{"", "s3cret"} {
+		idp := oidctest.NewServer(t, testClientID)
+		idp.Claims["email"] = "alice@example.com"
+		p := newTestProvider(idp, secret)
+		ctx := context.Background()
+
+		verifier, err := oidc.RandomString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		authURL, err := p.AuthCodeURL(ctx, "the-state", "the-nonce", oidc.CodeChallenge(verifier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(authURL)
+		if got := u.Query().Get("scope"); got != "openid email profile" {
+			t.Errorf("scope = %q", got)
+		}
+		code, state, err := idp.Authorize(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != "the-state" {
+			t.Errorf("state = %q", state)
+		}
+
+		// A wrong verifier fails, and burns the code
+		if _, err := p.Exchange(ctx, code, verifier+"x"); err == nil {
+			t.Fatal("exchange with the wrong verifier succeeded")
+		}
+		if _, err := p.Exchange(ctx, code, verifier); err == nil {
+			t.Fatal("a code was exchanged twice")
+		}
+
+		code, _, err = idp.Authorize(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := p.Exchange(ctx, code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := p.Verify(ctx, token.IDToken, "the-nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "subject-1" || claims.Email != "alice@example.com" {
+			t.Errorf("got claims %+v", claims)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+	p := newTestProvider(idp, "")
+	hour := time.Hour.Seconds()
+	now := float64(time.Now().Unix())
+
+	tests := []struct {
+		name   string
+		kid    string
+		claims map[string]interface{}
+		ok     bool
+	}{
+		{"RS256", oidctest.RSAKeyID, nil, true},
+		{"ES256", oidctest.ECKeyID, nil, true},
+		{"issuer with trailing slash", oidctest.RSAKeyID, map[string]interface{}{"iss": idp.URL + "/"}, true},
+		{"audience list with azp", oidctest.RSAKeyID, map[string]interface{}{"aud": []string{testClientID, "other"}, "azp": testClientID}, true},
+		{"skewed clock", oidctest.RSAKeyID, map[string]interface{}{"exp": now - 60, "iat": now + 60}, true},
+		{"wrong issuer", oidctest.RSAKeyID, map[string]interface{}{"iss": "https://evil.example.com"}, false},
+		{"wrong audience", oidctest.RSAKeyID, map[string]interface{}{"aud": "other"}, false},
+		{"audience list without azp", oidctest.RSAKeyID, map[string]interface{}{"aud": []string{testClientID, "other"}}, false},
+		{"audience list with wrong azp", oidctest.RSAKeyID, map[string]interface{}{"aud": []string{testClientID, "other"}, "azp": "other"}, false},
+		{"no subject", oidctest.RSAKeyID, map[string]interface{}{"sub": ""}, false},
+		{"expired", oidctest.RSAKeyID, map[string]interface{}{"exp": now - hour}, false},
+		{"issued in the future", oidctest.RSAKeyID, map[string]interface{}{"iat": now + hour}, false},
+		{"wrong nonce", oidctest.RSAKeyID, map[string]interface{}{"nonce": "replayed"}, false},
+		{"missing nonce", oidctest.RSAKeyID, map[string]interface{}{"nonce": ""}, false},
+		{"unknown key", "rsa-2", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.ValidClaims("n-1")
+			for key, value := range tt.claims {
+				claims[key] = value
+			}
+			_, err := p.Verify(context.Background(), idp.Sign(tt.kid, claims), "n-1")
+			if tt.ok && err != nil {
+				t.Errorf("got %v, want no error", err)
+			}
+			if !tt.ok && !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("got %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+// Tokens whose header or signature don't match the published keys
+func TestVerifySignature(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+	p := newTestProvider(idp, "")
+	claims := idp.ValidClaims("n-1")
+	valid := idp.Sign(oidctest.RSAKeyID, claims)
+	parts := strings.Split(valid, ".")
+	other := strings.Split(idp.Sign(oidctest.ECKeyID, claims), ".")
+	claims["sub"] = "someone-else"
+	tampered, _ := json.Marshal(claims)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "not-a-jwt"},
+		{"alg none", idp.SignWithHeader(map[string]interface{}{"alg": "none", "kid": oidctest.RSAKeyID}, claims)},
+		{"HS256 with an RSA key", idp.SignWithHeader(map[string]interface{}{"alg": "HS256", "kid": oidctest.RSAKeyID}, claims)},
+		{"RS256 with an EC key", idp.SignWithHeader(map[string]interface{}{"alg": "RS256", "kid": oidctest.ECKeyID}, claims)},
+		{"no kid with several keys", idp.SignWithHeader(map[string]interface{}{"alg": "RS256"}, claims)},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString(tampered) + "." + parts[2]},
+		{"signature of another token", parts[0] + "." + parts[1] + "." + other[2]},
+		{"empty signature", parts[0] + "." + parts[1] + "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.Verify(context.Background(), tt.token, "n-1"); !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("got %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+// The key set is cached, unknown key IDs don't cause a fetch per token, and
+// a stale set is fetched again
+func TestKeySetCache(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+	p := newTestProvider(idp, "")
+	ctx := context.Background()
+	token := idp.Sign(oidctest.RSAKeyID, idp.ValidClaims(""))
+	for i := 0; i < 3; i++ {
+		if _, err := p.Verify(ctx, token, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := idp.JWKSFetches(); got != 1 {
+		t.Errorf("fetched the key set %d times, want 1", got)
+	}
+	unknown := idp.Sign("rotated", idp.ValidClaims(""))
+	for i := 0; i < 3; i++ {
+		if _, err := p.Verify(ctx, unknown, ""); err == nil {
+			t.Fatal("a token with an unknown key was accepted")
+		}
+	}
+	if got := idp.JWKSFetches(); got != 1 {
+		t.Errorf("fetched the key set %d times after unknown keys, want 1", got)
+	}
+
+	p.JWKSCacheTTL = 0
+	if _, err := p.Verify(ctx, token, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := idp.JWKSFetches(); got != 2 {
+		t.Errorf("fetched the key set %d times after it went stale, want 2", got)
+	}
+}
@@ -0,0 +1,260 @@
+// Filename: internal/oidc/oidctest/oidctest.go
+
+// Package oidctest runs a mock OpenID Connect provider for tests. It serves
+// discovery, a JSON Web Key Set with an RSA and an EC key, and a token
+// endpoint that checks the PKCE verifier of the codes it hands out.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The IDs of the keys the provider signs with
+const (
+	RSAKeyID = "rsa-1"
+	ECKeyID  = "ec-1"
+)
+
+// A Server is a running mock provider
+type Server struct {
+	*httptest.Server
+	ClientID string
+	RSAKey   *rsa.PrivateKey
+	ECKey    *ecdsa.PrivateKey
+	// Claims are added to every ID token the token endpoint issues, after
+	// iss, aud, exp, iat and nonce, which they can override
+	Claims map[string]interface{}
+
+	mu    sync.Mutex
+	codes map[string]authRequest
+	// The number of times the key set was fetched
+	jwksFetches int
+}
+
+// authRequest is what the provider remembers about an authorization code
+type authRequest struct {
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// NewServer() starts a provider for the client, which is stopped when the
+// test ends
+func NewServer(t testing.TB, clientID string) *Server {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		ClientID: clientID,
+		RSAKey:   rsaKey,
+		ECKey:    ecKey,
+		Claims:   map[string]interface{}{},
+		codes:    map[string]authRequest{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Issuer() is the issuer URL of the provider
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// JWKSFetches() returns how many times the key set was fetched
+func (s *Server) JWKSFetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jwksFetches
+}
+
+// Authorize() plays the user logging in at the authorization endpoint. It
+// takes the URL the client was redirected to and returns the code and state
+// the provider would send back to the redirect URI.
+func (s *Server) Authorize(authURL string) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	switch {
+	case q.Get("client_id") != s.ClientID:
+		return "", "", errors.New("oidctest: wrong client_id")
+	case q.Get("response_type") != "code":
+		return "", "", errors.New("oidctest: response_type must be code")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", errors.New("oidctest: missing S256 code challenge")
+	}
+	code = randomString()
+	s.mu.Lock()
+	s.codes[code] = authRequest{
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		redirectURI:   q.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+	return code, q.Get("state"), nil
+}
+
+// Sign() signs the claims with one of the provider's keys, RS256 for the RSA
+// key and ES256 for the EC key
+func (s *Server) Sign(kid string, claims map[string]interface{}) string {
+	alg := "RS256"
+	if kid == ECKeyID {
+		alg = "ES256"
+	}
+	return s.SignWithHeader(map[string]interface{}{"alg": alg, "kid": kid, "typ": "JWT"}, claims)
+}
+
+// SignWithHeader() signs the claims with the key the header's kid names,
+// whatever the header claims the algorithm is
+func (s *Server) SignWithHeader(header, claims map[string]interface{}) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := segment(h) + "." + segment(c)
+	digest := sha256.Sum256([]byte(input))
+	var signature []byte
+	if header["kid"] == ECKeyID {
+		r, sig, err := ecdsa.Sign(rand.Reader, s.ECKey, digest[:])
+		if err != nil {
+			panic(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		sig.FillBytes(signature[32:])
+	} else {
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.RSAKey, crypto.SHA256, digest[:])
+		if err != nil {
+			panic(err)
+		}
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// ValidClaims() returns the claims of a token the client should accept
+func (s *Server) ValidClaims(nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":   s.URL,
+		"aud":   s.ClientID,
+		"sub":   "subject-1",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": nonce,
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.jwksFetches++
+	s.mu.Unlock()
+	pub := s.RSAKey.PublicKey
+	ec := s.ECKey.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": RSAKeyID, "use": "sig", "alg": "RS256",
+				"n": segment(pub.N.Bytes()),
+				"e": segment(big.NewInt(int64(pub.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": ECKeyID, "use": "sig", "crv": "P-256",
+				"x": segment(ec.X.FillBytes(make([]byte, 32))),
+				"y": segment(ec.Y.FillBytes(make([]byte, 32))),
+			},
+		},
+	})
+}
+
+// token() trades a code for an ID token signed with the RSA key. The code
+// can be used once, and the verifier must match its challenge.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+	}
+	s.mu.Lock()
+	req, found := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code", clientID != s.ClientID:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	case !found, req.redirectURI != r.PostForm.Get("redirect_uri"), segment(sum[:]) != req.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	claims := s.ValidClaims(req.nonce)
+	for key, value := range s.Claims {
+		claims[key] = value
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     s.Sign(RSAKeyID, claims),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func segment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return segment(b)
+}
@@ -0,0 +1,145 @@
+// Filename: internal/openapi/openapi.go
+
+// Package openapi holds the OpenAPI 3.1 document describing the API, and
+// reads enough of it to match requests to their operations and validate
+// them against the schemas.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Document is the OpenAPI document as it is served
+//
+//go:embed openapi.json
+var Document []byte
+
+// A Spec is the parsed document
+type Spec struct {
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// A PathItem holds the operations on a path
+type PathItem struct {
+	Get    *Operation `json:"get"`
+	Post   *Operation `json:"post"`
+	Put    *Operation `json:"put"`
+	Patch  *Operation `json:"patch"`
+	Delete *Operation `json:"delete"`
+}
+
+// operation() returns the operation for a method, or nil if there is none
+func (p *PathItem) operation(method string) *Operation {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return p.Get
+	case http.MethodPost:
+		return p.Post
+	case http.MethodPut:
+		return p.Put
+	case http.MethodPatch:
+		return p.Patch
+	case http.MethodDelete:
+		return p.Delete
+	}
+	return nil
+}
+
+// An Operation is one method on one path
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+// A Parameter is a path, query or header parameter, or a reference to one
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// A RequestBody lists the schema of the body for each media type
+type RequestBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema *Schema `json:"schema"`
+	} `json:"content"`
+}
+
+// Load parses the document
+func Load() (*Spec, error) {
+	var spec Spec
+	err := json.Unmarshal(Document, &spec)
+	if err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Find returns the operation for a request path and the values of its path
+// parameters. Paths with more literal segments win, so /v1/Notes/export is
+// preferred to /v1/Notes/{id}.
+func (s *Spec) Find(method, path string) (*Operation, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *Operation
+	var bestParams map[string]string
+	bestLiterals := -1
+	for template, item := range s.Paths {
+		op := item.operation(method)
+		if op == nil {
+			continue
+		}
+		parts := strings.Split(strings.Trim(template, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := map[string]string{}
+		literals := 0
+		matched := true
+		for i, part := range parts {
+			switch {
+			case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+				params[part[1:len(part)-1]] = segments[i]
+			case part == segments[i]:
+				literals++
+			default:
+				matched = false
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched && literals > bestLiterals {
+			best, bestParams, bestLiterals = op, params, literals
+		}
+	}
+	return best, bestParams
+}
+
+// Has reports whether the document describes a method on a path template
+func (s *Spec) Has(method, template string) bool {
+	item, ok := s.Paths[template]
+	return ok && item.operation(method) != nil
+}
+
+// parameter() resolves a reference to a parameter in the components
+func (s *Spec) parameter(p *Parameter) *Parameter {
+	if p.Ref == "" {
+		return p
+	}
+	name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+	if resolved, ok := s.Components.Parameters[name]; ok {
+		return resolved
+	}
+	return p
+}
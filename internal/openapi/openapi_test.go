@@ -0,0 +1,203 @@
+// Filename: internal/openapi/openapi_test.go
+
+package openapi
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDocument = `{
+	"paths": {
+		"/v1/things": {
+			"get": {"operationId": "listThings", "parameters": [
+				{"$ref": "#/components/parameters/page"},
+				{"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["id", "-id"]}},
+				{"name": "tidy", "in": "query", "schema": {"type": "boolean"}}
+			]},
+			"post": {"operationId": "createThing", "requestBody": {"content": {
+				"application/json": {"schema": {"$ref": "#/components/schemas/Thing"}}
+			}}}
+		},
+		"/v1/things/{id}": {
+			"get": {"operationId": "showThing", "parameters": [
+				{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}},
+				{"name": "q", "in": "query", "required": true, "schema": {"type": "string"}}
+			]}
+		},
+		"/v1/things/export": {
+			"get": {"operationId": "exportThings"}
+		}
+	},
+	"components": {
+		"parameters": {
+			"page": {"name": "page", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 100}}
+		},
+		"schemas": {
+			"Thing": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string", "minLength": 1, "maxLength": 3},
+					"size": {"type": ["integer", "null"]},
+					"tags": {"type": "array", "minItems": 1, "maxItems": 2, "uniqueItems": true, "items": {"type": "string"}},
+					"shape": {"oneOf": [{"type": "string"}, {"$ref": "#/components/schemas/Shape"}]},
+					"meta": {"type": "object", "additionalProperties": {"type": "number"}}
+				},
+				"required": ["name"],
+				"additionalProperties": false
+			},
+			"Shape": {
+				"type": "object",
+				"properties": {"sides": {"type": "integer"}},
+				"required": ["sides"]
+			}
+		}
+	}
+}`
+
+func testSpec(t *testing.T) *Spec {
+	t.Helper()
+	var spec Spec
+	if err := json.Unmarshal([]byte(testDocument), &spec); err != nil {
+		t.Fatal(err)
+	}
+	return &spec
+}
+
+func TestFind(t *testing.T) {
+	spec := testSpec(t)
+	tests := []struct {
+		method, path string
+		op           string
+		params       map[string]string
+	}{
+		{"GET", "/v1/things", "listThings", map[string]string{}},
+		{"HEAD", "/v1/things/", "listThings", map[string]string{}},
+		{"POST", "/v1/things", "createThing", map[string]string{}},
+		{"GET", "/v1/things/7", "showThing", map[string]string{"id": "7"}},
+		{"GET", "/v1/things/export", "exportThings", map[string]string{}},
+		{"DELETE", "/v1/things/7", "", nil},
+		{"GET", "/v1/things/7/parts", "", nil},
+		{"GET", "/v2/things", "", nil},
+	}
+	for _, tt := range tests {
+		op, params := spec.Find(tt.method, tt.path)
+		got := ""
+		if op != nil {
+			got = op.OperationID
+		}
+		if got != tt.op || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("Find(%s %s) = %q %v, want %q %v", tt.method, tt.path, got, params, tt.op, tt.params)
+		}
+	}
+	if !spec.Has("GET", "/v1/things/{id}") || spec.Has("POST", "/v1/things/{id}") || spec.Has("GET", "/v1/things/7") {
+		t.Error("Has() matched the wrong templates")
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	spec := testSpec(t)
+	tests := []struct {
+		method, target, contentType, body string
+		want                              map[string]string
+	}{
+		{"GET", "/v1/things?page=2&sort=-id&tidy=true", "", "", nil},
+		{"GET", "/v1/things?page=x", "", "", map[string]string{"page": "must be a number"}},
+		{"GET", "/v1/things?page=0", "", "", map[string]string{"page": "must be at least 1"}},
+		{"GET", "/v1/things?page=101", "", "", map[string]string{"page": "must not be more than 100"}},
+		{"GET", "/v1/things?page=1.5", "", "", map[string]string{"page": "must be an integer"}},
+		{"GET", "/v1/things?sort=name", "", "", map[string]string{"sort": "must be one of id, -id"}},
+		{"GET", "/v1/things?tidy=maybe", "", "", map[string]string{"tidy": "must be true or false"}},
+		{"GET", "/v1/things/0", "", "", map[string]string{"id": "must be at least 1", "q": "must be provided"}},
+		{"GET", "/v1/unknown?page=x", "", "", nil},
+		{"POST", "/v1/things", "application/json", `{"name":"abc","size":null,"tags":["a"],"shape":{"sides":3},"meta":{"x":1}}`, nil},
+		{"POST", "/v1/things", "application/json", `{"name":"äöü","shape":"round"}`, nil},
+		{"POST", "/v1/things", "application/json", `{}`, map[string]string{"name": "must be provided"}},
+		{"POST", "/v1/things", "application/json", `{"name":""}`, map[string]string{"name": "must be provided"}},
+		{"POST", "/v1/things", "application/json", `{"name":"abcd"}`, map[string]string{"name": "must not be more than 3 characters long"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","size":"big"}`, map[string]string{"size": "must be an integer or null"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","tags":[]}`, map[string]string{"tags": "must contain at least 1 entries"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","tags":["a","b","c"]}`, map[string]string{"tags": "must not contain more than 2 entries"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","tags":["a","a"]}`, map[string]string{"tags": "must not contain duplicate entries"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","tags":[1]}`, map[string]string{"tags.0": "must be a string"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","shape":{}}`, map[string]string{"shape": "does not match exactly one of the allowed forms"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","meta":{"x":"y"}}`, map[string]string{"meta.x": "must be a number"}},
+		{"POST", "/v1/things", "application/json", `{"name":"a","colour":"red"}`, map[string]string{"colour": "is not a known field"}},
+		{"POST", "/v1/things", "application/json", `[]`, map[string]string{"body": "must be an object"}},
+		// Bodies the handlers report themselves
+		{"POST", "/v1/things", "application/json", `{"name":`, nil},
+		{"POST", "/v1/things", "", `{"colour":"red"}`, map[string]string{"colour": "is not a known field", "name": "must be provided"}},
+		{"POST", "/v1/things", "text/csv", `{"colour":"red"}`, map[string]string{"colour": "is not a known field", "name": "must be provided"}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		got := spec.ValidateRequest(r, []byte(tt.body))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s %s: got %v, want %v", tt.method, tt.target, tt.body, got, tt.want)
+		}
+	}
+}
+
+// The served document parses, and every reference in it resolves
+func TestDocument(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Paths) == 0 {
+		t.Fatal("the document has no paths")
+	}
+	var doc interface{}
+	if err := json.Unmarshal(Document, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var walk func(v interface{}, path string)
+	walk = func(v interface{}, path string) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				if !resolves(doc, ref) {
+					t.Errorf("%s: %s doesn't resolve", path, ref)
+				}
+			}
+			for key, child := range v {
+				walk(child, path+"/"+key)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child, path+"/[]")
+			}
+		}
+	}
+	walk(doc, "#")
+	for template, item := range spec.Paths {
+		for _, op := range []*Operation{item.Get, item.Post, item.Put, item.Patch, item.Delete} {
+			if op != nil && op.OperationID == "" {
+				t.Errorf("an operation on %s has no operationId", template)
+			}
+		}
+	}
+}
+
+// resolves() reports whether a local reference points at something
+func resolves(doc interface{}, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	for _, key := range strings.Split(ref[2:], "/") {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if doc, ok = m[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
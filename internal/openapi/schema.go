@@ -0,0 +1,335 @@
+// Filename: internal/openapi/schema.go
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Schema is the subset of JSON Schema the document uses
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 types              `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	OneOf                []*Schema          `json:"oneOf"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	UniqueItems          bool               `json:"uniqueItems"`
+}
+
+// types is the type keyword, which is either a name or a list of names
+type types []string
+
+func (t *types) UnmarshalJSON(b []byte) error {
+	var name string
+	if json.Unmarshal(b, &name) == nil {
+		*t = types{name}
+		return nil
+	}
+	var names []string
+	err := json.Unmarshal(b, &names)
+	*t = names
+	return err
+}
+
+// schema() resolves a reference to a schema in the components
+func (s *Spec) schema(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// ValidateRequest checks the parameters and JSON body of a request against
+// its operation. Problems are returned keyed by the parameter, or by the
+// dotted path of the field in the body. Bodies that aren't JSON, or aren't
+// well formed, are left for the handler to report.
+func (s *Spec) ValidateRequest(r *http.Request, body []byte) map[string]string {
+	op, pathParams := s.Find(r.Method, r.URL.Path)
+	if op == nil {
+		return nil
+	}
+	errs := map[string]string{}
+	qs := r.URL.Query()
+	for _, p := range op.Parameters {
+		p = s.parameter(p)
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = pathParams[p.Name]
+		case "query":
+			value, present = qs.Get(p.Name), qs.Has(p.Name)
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				errs[p.Name] = "must be provided"
+			}
+			continue
+		}
+		s.validateParam(p, value, errs)
+	}
+	if op.RequestBody != nil && len(body) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		content, ok := op.RequestBody.Content[mediaType]
+		if !ok {
+			// The handlers read any body they don't otherwise recognise as JSON
+			mediaType = "application/json"
+			content, ok = op.RequestBody.Content[mediaType]
+		}
+		if ok && strings.HasSuffix(mediaType, "json") {
+			var value interface{}
+			if json.Unmarshal(body, &value) == nil {
+				s.validate(content.Schema, value, "", errs)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateParam() converts a parameter to the type of its schema and
+// validates it
+func (s *Spec) validateParam(p *Parameter, value string, errs map[string]string) {
+	schema := s.schema(p.Schema)
+	if schema == nil {
+		return
+	}
+	var v interface{} = value
+	switch {
+	case schema.Type.has("integer"), schema.Type.has("number"):
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs[p.Name] = "must be a number"
+			return
+		}
+		v = n
+	case schema.Type.has("boolean"):
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			errs[p.Name] = "must be true or false"
+			return
+		}
+		v = b
+	}
+	s.validate(schema, v, p.Name, errs)
+}
+
+func (t types) has(name string) bool {
+	for _, n := range t {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validate() checks a decoded JSON value against a schema, recording the
+// first problem at each path
+func (s *Spec) validate(schema *Schema, value interface{}, path string, errs map[string]string) {
+	schema = s.schema(schema)
+	if schema == nil {
+		return
+	}
+	key := path
+	if key == "" {
+		key = "body"
+	}
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		errs[key] = "must be " + describeTypes(schema.Type)
+		return
+	}
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, e := range schema.Enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+			}
+		}
+		if !found {
+			options := make([]string, len(schema.Enum))
+			for i, e := range schema.Enum {
+				options[i] = fmt.Sprint(e)
+			}
+			errs[key] = "must be one of " + strings.Join(options, ", ")
+			return
+		}
+	}
+	if len(schema.OneOf) > 0 {
+		matches := 0
+		for _, option := range schema.OneOf {
+			optionErrs := map[string]string{}
+			s.validate(option, value, path, optionErrs)
+			if len(optionErrs) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			errs[key] = "does not match exactly one of the allowed forms"
+			return
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			if *schema.MinLength == 1 {
+				errs[key] = "must be provided"
+			} else {
+				errs[key] = fmt.Sprintf("must be at least %d characters long", *schema.MinLength)
+			}
+		} else if schema.MaxLength != nil && length > *schema.MaxLength {
+			errs[key] = fmt.Sprintf("must not be more than %d characters long", *schema.MaxLength)
+		}
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			errs[key] = fmt.Sprintf("must be at least %v", *schema.Minimum)
+		} else if schema.Maximum != nil && v > *schema.Maximum {
+			errs[key] = fmt.Sprintf("must not be more than %v", *schema.Maximum)
+		}
+	case []interface{}:
+		switch {
+		case schema.MinItems != nil && len(v) < *schema.MinItems:
+			errs[key] = fmt.Sprintf("must contain at least %d entries", *schema.MinItems)
+			return
+		case schema.MaxItems != nil && len(v) > *schema.MaxItems:
+			errs[key] = fmt.Sprintf("must not contain more than %d entries", *schema.MaxItems)
+			return
+		}
+		if schema.UniqueItems {
+			for i := range v {
+				for j := 0; j < i; j++ {
+					if reflect.DeepEqual(v[i], v[j]) {
+						errs[key] = "must not contain duplicate entries"
+						return
+					}
+				}
+			}
+		}
+		for i, item := range v {
+			s.validate(schema.Items, item, join(path, strconv.Itoa(i)), errs)
+		}
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				errs[join(path, name)] = "must be provided"
+			}
+		}
+		additional := s.additionalProperties(schema)
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := schema.Properties[name]; ok {
+				s.validate(property, v[name], join(path, name), errs)
+				continue
+			}
+			switch a := additional.(type) {
+			case bool:
+				if !a {
+					errs[join(path, name)] = "is not a known field"
+				}
+			case *Schema:
+				s.validate(a, v[name], join(path, name), errs)
+			}
+		}
+	}
+}
+
+// additionalProperties() reads the additionalProperties keyword, which is
+// either a boolean or a schema. Missing means any property is allowed.
+func (s *Spec) additionalProperties(schema *Schema) interface{} {
+	if len(schema.AdditionalProperties) == 0 {
+		return true
+	}
+	var allowed bool
+	if json.Unmarshal(schema.AdditionalProperties, &allowed) == nil {
+		return allowed
+	}
+	var additional Schema
+	if json.Unmarshal(schema.AdditionalProperties, &additional) != nil {
+		return true
+	}
+	return &additional
+}
+
+// matchesType() reports whether a decoded JSON value has one of the types
+func matchesType(names types, value interface{}) bool {
+	for _, name := range names {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == float64(int64(v))) {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describeTypes() names the types for an error message
+func describeTypes(names types) string {
+	words := map[string]string{
+		"string":  "a string",
+		"integer": "an integer",
+		"number":  "a number",
+		"boolean": "true or false",
+		"array":   "an array",
+		"object":  "an object",
+		"null":    "null",
+	}
+	described := make([]string, len(names))
+	for i, name := range names {
+		described[i] = words[name]
+	}
+	return strings.Join(described, " or ")
+}
+
+// join() adds a key to a dotted path
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
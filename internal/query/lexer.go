@@ -0,0 +1,155 @@
+// Filename: internal/query/lexer.go
+
+// Package query parses the expressions clients use to search a listing, such
+// as
+//
+//	priority:high AND (category:work OR status:blocked) AND NOT task_name:~meeting
+//
+// into an AST and compiles the AST into a parameterised SQL condition.
+// Only the fields and operators the caller lists are accepted.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// The position of the token in the input, counting from 1
+	pos int
+}
+
+// A SyntaxError reports a problem with the expression and where it is
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos, e.Msg)
+}
+
+// The comparison operators, longest first so that the lexer is greedy
+var operators = []string{":>=", ":<=", ":~", ":>", ":<", ":"}
+
+// lexer splits an expression into tokens. The value after an operator runs
+// to the next space or closing parenthesis unless it is quoted, so values may
+// contain colons.
+type lexer struct {
+	input   string
+	offset  int
+	afterOp bool
+	tokens  []token
+}
+
+func lex(input string) ([]token, error) {
+	l := &lexer{input: input}
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		l.tokens = append(l.tokens, tok)
+		if tok.kind == tokenEOF {
+			return l.tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	// Skip white space
+	for l.offset < len(l.input) {
+		r, size := utf8.DecodeRuneInString(l.input[l.offset:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.offset += size
+	}
+	start := l.offset
+	pos := start + 1
+	if l.offset >= len(l.input) {
+		return token{kind: tokenEOF, pos: pos}, nil
+	}
+	afterOp := l.afterOp
+	l.afterOp = false
+	c := l.input[l.offset]
+	switch {
+	case c == '"':
+		return l.quoted(pos)
+	case afterOp:
+		end := strings.IndexFunc(l.input[start:], func(r rune) bool { return unicode.IsSpace(r) || r == ')' })
+		if end == -1 {
+			end = len(l.input) - start
+		}
+		if end == 0 {
+			return token{}, &SyntaxError{Pos: pos, Msg: "expected a value"}
+		}
+		l.offset += end
+		return token{kind: tokenWord, text: l.input[start:l.offset], pos: pos}, nil
+	case c == '(':
+		l.offset++
+		return token{kind: tokenLParen, text: "(", pos: pos}, nil
+	case c == ')':
+		l.offset++
+		return token{kind: tokenRParen, text: ")", pos: pos}, nil
+	case c == ':':
+		for _, op := range operators {
+			if strings.HasPrefix(l.input[start:], op) {
+				l.offset += len(op)
+				l.afterOp = true
+				return token{kind: tokenOperator, text: op, pos: pos}, nil
+			}
+		}
+	}
+	// A bare word runs until a space, parenthesis, quote or operator
+	end := strings.IndexFunc(l.input[start:], func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`()":`, r)
+	})
+	if end == -1 {
+		end = len(l.input) - start
+	}
+	if end == 0 {
+		r, _ := utf8.DecodeRuneInString(l.input[start:])
+		return token{}, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("unexpected %q", r)}
+	}
+	l.offset += end
+	return token{kind: tokenWord, text: l.input[start:l.offset], pos: pos}, nil
+}
+
+// quoted() reads a double quoted string. A backslash escapes the next
+// character.
+func (l *lexer) quoted(pos int) (token, error) {
+	var b strings.Builder
+	l.offset++
+	for l.offset < len(l.input) {
+		c := l.input[l.offset]
+		switch c {
+		case '"':
+			l.offset++
+			return token{kind: tokenString, text: b.String(), pos: pos}, nil
+		case '\\':
+			if l.offset+1 < len(l.input) {
+				l.offset++
+				c = l.input[l.offset]
+			}
+		}
+		b.WriteByte(c)
+		l.offset++
+	}
+	return token{}, &SyntaxError{Pos: pos, Msg: "unterminated string"}
+}
@@ -0,0 +1,274 @@
+// Filename: internal/query/parser.go
+
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits that keep expressions cheap to parse and to run
+const (
+	MaxLength = 1000
+	MaxDepth  = 20
+	MaxTerms  = 50
+)
+
+// A Kind is the type of a field, which decides its operators and values
+type Kind int
+
+const (
+	// Text fields compare ignoring case. ":~" finds a substring.
+	Text Kind = iota
+	// TextArray fields match if any element matches
+	TextArray
+	// Integer and Timestamp fields also support ":>", ":>=", ":<" and ":<="
+	Integer
+	Timestamp
+)
+
+// A Field is a name clients may search on and the column it stands for
+type Field struct {
+	Column string
+	Kind   Kind
+}
+
+// The operators each kind of field supports
+var kindOperators = map[Kind][]string{
+	Text:      {":", ":~"},
+	TextArray: {":", ":~"},
+	Integer:   {":", ":>", ":>=", ":<", ":<="},
+	Timestamp: {":>", ":>=", ":<", ":<="},
+}
+
+// A Node is a node of the AST: an *And, *Or, *Not or *Comparison
+type Node interface {
+	node()
+}
+
+type And struct {
+	Left, Right Node
+}
+
+type Or struct {
+	Left, Right Node
+}
+
+type Not struct {
+	Expr Node
+}
+
+// A Comparison tests one field. The value has been checked against the kind
+// of the field and is a string, an int64 or a time.Time.
+type Comparison struct {
+	Field    Field
+	Operator string
+	Value    interface{}
+}
+
+func (*And) node()        {}
+func (*Or) node()         {}
+func (*Not) node()        {}
+func (*Comparison) node() {}
+
+type parser struct {
+	tokens []token
+	i      int
+	depth  int
+	terms  int
+	fields map[string]Field
+}
+
+// Parse() parses an expression. Terms are joined with AND, OR and NOT, which
+// are case insensitive, and grouped with parentheses. Terms next to each other
+// are joined with AND. Errors are *SyntaxError values.
+func Parse(input string, fields map[string]Field) (Node, error) {
+	if len(input) > MaxLength {
+		return nil, &SyntaxError{Pos: MaxLength + 1, Msg: fmt.Sprintf("must not be more than %d bytes long", MaxLength)}
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, fields: fields}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokenEOF {
+		p.i++
+	}
+	return tok
+}
+
+// isKeyword() reports whether the next token is the keyword
+func (p *parser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && strings.EqualFold(tok.text, keyword) &&
+		p.tokens[p.i+1].kind != tokenOperator
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.isKeyword("AND") {
+			p.advance()
+		} else if tok := p.peek(); tok.kind == tokenEOF || tok.kind == tokenRParen || p.isKeyword("OR") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+}
+
+// nest() counts one level of NOT or parentheses, up to MaxDepth
+func (p *parser) nest() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return &SyntaxError{Pos: p.peek().pos, Msg: fmt.Sprintf("must not be nested more than %d deep", MaxDepth)}
+	}
+	return nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.isKeyword("NOT") {
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		p.advance()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	}
+	tok := p.peek()
+	switch tok.kind {
+	case tokenLParen:
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		p.advance()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRParen {
+			return nil, &SyntaxError{Pos: closing.pos, Msg: "expected )"}
+		}
+		return n, nil
+	case tokenWord:
+		return p.parseComparison()
+	case tokenEOF:
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "unexpected end of expression"}
+	}
+	return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	name := p.advance()
+	field, ok := p.fields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, &SyntaxError{Pos: name.pos, Msg: fmt.Sprintf("unknown field %q, valid fields are %s", name.text, p.fieldNames())}
+	}
+	op := p.advance()
+	if op.kind != tokenOperator {
+		return nil, &SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("expected an operator after %q", name.text)}
+	}
+	allowed := kindOperators[field.Kind]
+	if !contains(allowed, op.text) {
+		return nil, &SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("operator %q cannot be used with %q, use one of %s", op.text, name.text, strings.Join(allowed, " "))}
+	}
+	value := p.advance()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, &SyntaxError{Pos: value.pos, Msg: "expected a value"}
+	}
+	p.terms++
+	if p.terms > MaxTerms {
+		return nil, &SyntaxError{Pos: name.pos, Msg: fmt.Sprintf("must not contain more than %d terms", MaxTerms)}
+	}
+	c := &Comparison{Field: field, Operator: op.text}
+	switch field.Kind {
+	case Integer:
+		i, err := strconv.ParseInt(value.text, 10, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: value.pos, Msg: fmt.Sprintf("%q is not an integer", value.text)}
+		}
+		c.Value = i
+	case Timestamp:
+		t, err := parseTime(value.text)
+		if err != nil {
+			return nil, &SyntaxError{Pos: value.pos, Msg: fmt.Sprintf("%q is not an RFC 3339 timestamp or a date in the form YYYY-MM-DD", value.text)}
+		}
+		c.Value = t
+	default:
+		c.Value = value.text
+	}
+	return c, nil
+}
+
+// fieldNames() lists the valid field names for error messages
+func (p *parser) fieldNames() string {
+	names := make([]string, 0, len(p.fields))
+	for name := range p.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", s)
+	}
+	return t, err
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+// Filename: internal/query/query_test.go
+
+package query
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testFields = map[string]Field{
+	"priority":   {Column: "priority", Kind: Text},
+	"category":   {Column: "category", Kind: Text},
+	"task_name":  {Column: "task_name", Kind: Text},
+	"status":     {Column: "status", Kind: TextArray},
+	"version":    {Column: "version", Kind: Integer},
+	"created_at": {Column: "created_at", Kind: Timestamp},
+}
+
+// format() writes an AST with every group in parentheses
+func format(n Node) string {
+	switch n := n.(type) {
+	case *And:
+		return "(" + format(n.Left) + " AND " + format(n.Right) + ")"
+	case *Or:
+		return "(" + format(n.Left) + " OR " + format(n.Right) + ")"
+	case *Not:
+		return "(NOT " + format(n.Expr) + ")"
+	case *Comparison:
+		if t, ok := n.Value.(time.Time); ok {
+			return n.Field.Column + n.Operator + t.Format(time.RFC3339)
+		}
+		return fmt.Sprintf("%s%s%v", n.Field.Column, n.Operator, n.Value)
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"priority:high", "priority:high"},
+		{"PRIORITY:high", "priority:high"},
+		{"priority:low OR category:work AND status:blocked", "(priority:low OR (category:work AND status:blocked))"},
+		{"priority:low AND category:work OR status:blocked", "((priority:low AND category:work) OR status:blocked)"},
+		{"priority:low category:work OR status:blocked", "((priority:low AND category:work) OR status:blocked)"},
+		{"priority:low and category:work or status:blocked", "((priority:low AND category:work) OR status:blocked)"},
+		{"NOT priority:low AND category:work", "((NOT priority:low) AND category:work)"},
+		{"NOT (priority:low OR category:work)", "(NOT (priority:low OR category:work))"},
+		{"NOT NOT priority:low", "(NOT (NOT priority:low))"},
+		{strings.Repeat("(", MaxDepth) + "priority:low" + strings.Repeat(")", MaxDepth), "priority:low"},
+		{"priority:high AND (category:work OR status:blocked) AND NOT task_name:~meeting",
+			"((priority:high AND (category:work OR status:blocked)) AND (NOT task_name:~meeting))"},
+		{"priority:a OR priority:b OR priority:c", "((priority:a OR priority:b) OR priority:c)"},
+		{`task_name:"team meeting"`, "task_name:team meeting"},
+		{`task_name:"say \"hi\" \\ bye"`, `task_name:say "hi" \ bye`},
+		{"category:a:b", "category:a:b"},
+		{"(category:work)", "category:work"},
+		{"version:>=3", "version:>=3"},
+		{"version:-1", "version:-1"},
+		{"created_at:<2024-01-02", "created_at:<2024-01-02T00:00:00Z"},
+		{"created_at:>2024-01-02T10:00:00+02:00", "created_at:>2024-01-02T10:00:00+02:00"},
+		{"task_name:~späti", "task_name:~späti"},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.input, testFields)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got := format(n); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		msg   string
+	}{
+		{"", 1, "unexpected end of expression"},
+		{"priority:high AND", 18, "unexpected end of expression"},
+		{"priority", 9, `expected an operator after "priority"`},
+		{"colour:red", 1, `unknown field "colour", valid fields are category, created_at, priority, status, task_name, version`},
+		{"priority:high OR owner_id:1", 18, `unknown field "owner_id"`},
+		{"created_at:2024-01-01", 11, `operator ":" cannot be used with "created_at", use one of :> :>= :< :<=`},
+		{"priority:>high", 9, `operator ":>" cannot be used with "priority", use one of : :~`},
+		{"status:<=a", 7, `operator ":<=" cannot be used`},
+		{"version:~1", 8, `operator ":~" cannot be used`},
+		{"version:abc", 9, `"abc" is not an integer`},
+		{"created_at:>yesterday", 13, `"yesterday" is not an RFC 3339 timestamp`},
+		{`task_name:"open`, 11, "unterminated string"},
+		{"priority:)", 10, "expected a value"},
+		{"(priority:high", 15, "expected )"},
+		{"priority:high)", 14, `unexpected ")"`},
+		{"priority:high AND )", 19, `unexpected ")"`},
+		{`"high"`, 1, `unexpected "high"`},
+		{"priority:high & category:work", 15, `unknown field "&"`},
+		{strings.Repeat("(", MaxDepth+1) + "priority:high" + strings.Repeat(")", MaxDepth+1), MaxDepth + 1, "must not be nested more than 20 deep"},
+		{strings.Repeat("NOT ", MaxDepth) + "(priority:high)", MaxDepth*4 + 1, "must not be nested more than 20 deep"},
+		{strings.Repeat("priority:high ", MaxTerms+1), MaxTerms*14 + 1, "must not contain more than 50 terms"},
+		{strings.Repeat(" ", MaxLength+1), MaxLength + 1, "must not be more than 1000 bytes long"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input, testFields)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%.40q): got %v, want a *SyntaxError", tt.input, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos || !strings.HasPrefix(syntaxErr.Msg, tt.msg) {
+			t.Errorf("Parse(%.40q): got %q at %d, want %q at %d", tt.input, syntaxErr.Msg, syntaxErr.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		input    string
+		firstArg int
+		sql      string
+		args     []interface{}
+	}{
+		{"priority:high", 1, "(LOWER(priority) = LOWER($1))", []interface{}{"high"}},
+		{"task_name:~meet", 3, "(task_name ILIKE $3)", []interface{}{"%meet%"}},
+		{"status:Blocked", 1, "EXISTS (SELECT 1 FROM unnest(status) AS element WHERE LOWER(element) = LOWER($1))", []interface{}{"Blocked"}},
+		{"status:~100%", 1, "EXISTS (SELECT 1 FROM unnest(status) AS element WHERE element ILIKE $1)", []interface{}{`%100\%%`}},
+		{"version:3", 1, "(version = $1)", []interface{}{int64(3)}},
+		{"version:<=3", 1, "(version <= $1)", []interface{}{int64(3)}},
+		{"created_at:>=2024-01-02", 1, "(created_at >= $1)", []interface{}{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}},
+		{"priority:high OR NOT category:a AND version:>1", 2,
+			"((LOWER(priority) = LOWER($2)) OR ((NOT (LOWER(category) = LOWER($3))) AND (version > $4)))",
+			[]interface{}{"high", "a", int64(1)}},
+		// Values never end up in the SQL
+		{`task_name:"x') OR 1=1 --"`, 1, "(LOWER(task_name) = LOWER($1))", []interface{}{"x') OR 1=1 --"}},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.input, testFields)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		sql, args := Compile(n, tt.firstArg)
+		if sql != tt.sql {
+			t.Errorf("Compile(%q) = %s, want %s", tt.input, sql, tt.sql)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Compile(%q) args = %#v, want %#v", tt.input, args, tt.args)
+		}
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"meet", "%meet%"},
+		{"100%", `%100\%%`},
+		{"a_b", `%a\_b%`},
+		{`c:\temp`, `%c:\\temp%`},
+		{`\%_`, `%\\\%\_%`},
+	}
+	for _, tt := range tests {
+		if got := likePattern(tt.value); got != tt.want {
+			t.Errorf("likePattern(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Filename: internal/query/sql.go
+
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compile() turns an AST into a SQL condition. Values are never written into
+// the SQL; they are returned as arguments numbered from firstArg. Columns
+// come from the fields given to Parse().
+func Compile(n Node, firstArg int) (string, []interface{}) {
+	c := &compiler{next: firstArg}
+	return c.compile(n), c.args
+}
+
+type compiler struct {
+	next int
+	args []interface{}
+}
+
+// arg() adds an argument and returns its placeholder
+func (c *compiler) arg(value interface{}) string {
+	c.args = append(c.args, value)
+	placeholder := fmt.Sprintf("$%d", c.next)
+	c.next++
+	return placeholder
+}
+
+func (c *compiler) compile(n Node) string {
+	switch n := n.(type) {
+	case *And:
+		return "(" + c.compile(n.Left) + " AND " + c.compile(n.Right) + ")"
+	case *Or:
+		return "(" + c.compile(n.Left) + " OR " + c.compile(n.Right) + ")"
+	case *Not:
+		return "(NOT " + c.compile(n.Expr) + ")"
+	case *Comparison:
+		return c.comparison(n)
+	}
+	panic(fmt.Sprintf("query: unknown node %T", n))
+}
+
+func (c *compiler) comparison(n *Comparison) string {
+	column := n.Field.Column
+	switch n.Field.Kind {
+	case Text:
+		if n.Operator == ":~" {
+			return fmt.Sprintf("(%s ILIKE %s)", column, c.arg(likePattern(n.Value.(string))))
+		}
+		return fmt.Sprintf("(LOWER(%s) = LOWER(%s))", column, c.arg(n.Value))
+	case TextArray:
+		if n.Operator == ":~" {
+			return fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(%s) AS element WHERE element ILIKE %s)", column, c.arg(likePattern(n.Value.(string))))
+		}
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(%s) AS element WHERE LOWER(element) = LOWER(%s))", column, c.arg(n.Value))
+	}
+	operator := strings.TrimPrefix(n.Operator, ":")
+	if operator == "" {
+		operator = "="
+	}
+	return fmt.Sprintf("(%s %s %s)", column, operator, c.arg(n.Value))
+}
+
+// likePattern() matches a substring, escaping the LIKE wildcards in it
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
@@ -0,0 +1,132 @@
+// Filename: internal/testdb/testdb.go
+
+// Package testdb gives integration tests a migrated database of their own.
+// The tests run against the Postgres server named by TODO_TEST_DB_DSN and
+// are skipped when it isn't set. Each test gets a new schema, which is
+// dropped when the test ends. The role must not be a superuser or have
+// BYPASSRLS, or the row level security policies wouldn't apply, and the
+// citext extension must already be installed in the public schema.
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Open() returns a connection pool to a freshly migrated schema
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	return OpenSeeded(t, "", nil)
+}
+
+// OpenSeeded() is like Open(), but stops after the migration whose file name
+// starts with after, such as "000003", and calls seed before applying the
+// rest. Tests use it to check that rows from an older schema survive the
+// migrations that follow.
+func OpenSeeded(t testing.TB, after string, seed func(db *sql.DB)) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TODO_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TODO_TEST_DB_DSN is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	var bypass bool
+	err = admin.QueryRowContext(ctx, `SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&bypass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bypass {
+		t.Fatal("TODO_TEST_DB_DSN must name a role that row level security applies to")
+	}
+	schema := "test_" + randomSuffix(t)
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cleanup, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer cleanup.Close()
+		if _, err := cleanup.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Error(err)
+		}
+	})
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema+",public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrate(ctx, t, db, after, seed)
+	return db
+}
+
+// withSearchPath() adds a search_path run-time parameter to a DSN in either
+// URL or key=value form
+func withSearchPath(dsn, path string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", path)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + path
+}
+
+func randomSuffix(t testing.TB) string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// migrate() applies the up migrations in order, calling seed once the
+// migration named by after has been applied
+func migrate(ctx context.Context, t testing.TB, db *sql.DB, after string, seed func(db *sql.DB)) {
+	t.Helper()
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", "migrations")
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no migrations found in %s", dir)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		script, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, string(script)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(name), err)
+		}
+		if seed != nil && after != "" && strings.HasPrefix(filepath.Base(name), after+"_") {
+			seed(db)
+		}
+	}
+}
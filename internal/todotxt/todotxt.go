@@ -0,0 +1,128 @@
+// Filename: internal/todotxt/todotxt.go
+
+// Package todotxt reads and writes the lines of a todo.txt file, as in
+//
+//	x 2024-01-02 2024-01-01 Call Mom +Family @phone due:2024-01-05
+//	(A) 2024-01-01 Pay the rent +Home
+//
+// A line is parsed into its completion mark, priority and dates, and the
+// rest is kept as it was written, so writing out a parsed line gives back
+// the same line.
+package todotxt
+
+import (
+	"strings"
+	"time"
+)
+
+// The layout of the dates in a line
+const DateLayout = "2006-01-02"
+
+// A Task is one line of a todo.txt file
+type Task struct {
+	Done bool
+	// The priority letter from A to Z, or 0 for none. Completed tasks have
+	// no priority of their own.
+	Priority byte
+	// The dates in YYYY-MM-DD form, empty when missing. A task can only have
+	// a completion date once it is done.
+	Completed string
+	Created   string
+	// The description, with its projects, contexts and tags
+	Text string
+}
+
+// Parse reads a line. Anything that isn't a well formed completion mark,
+// priority or date, each followed by a single space, is part of the text.
+func Parse(line string) Task {
+	var t Task
+	if strings.HasPrefix(line, "x ") {
+		t.Done = true
+		line = line[2:]
+		if date, rest, ok := cutDate(line); ok {
+			t.Completed = date
+			line = rest
+			// A second date is the creation date
+			if date, rest, ok := cutDate(line); ok {
+				t.Created = date
+				line = rest
+			}
+		}
+		t.Text = line
+		return t
+	}
+	if len(line) >= 4 && line[0] == '(' && line[1] >= 'A' && line[1] <= 'Z' && line[2] == ')' && line[3] == ' ' {
+		t.Priority = line[1]
+		line = line[4:]
+	}
+	if date, rest, ok := cutDate(line); ok {
+		t.Created = date
+		line = rest
+	}
+	t.Text = line
+	return t
+}
+
+// cutDate() splits a leading date and its following space from the line
+func cutDate(line string) (string, string, bool) {
+	if len(line) < len(DateLayout)+1 || line[len(DateLayout)] != ' ' {
+		return "", line, false
+	}
+	date := line[:len(DateLayout)]
+	if _, err := time.Parse(DateLayout, date); err != nil {
+		return "", line, false
+	}
+	return date, line[len(DateLayout)+1:], true
+}
+
+// String writes the task as a line
+func (t Task) String() string {
+	var b strings.Builder
+	if t.Done {
+		b.WriteString("x ")
+		if t.Completed != "" {
+			b.WriteString(t.Completed + " ")
+		}
+	} else if t.Priority != 0 {
+		b.WriteString("(" + string(t.Priority) + ") ")
+	}
+	// Without a completion date a done task's only date reads as one, so the
+	// creation date is dropped
+	if t.Created != "" && (!t.Done || t.Completed != "") {
+		b.WriteString(t.Created + " ")
+	}
+	b.WriteString(t.Text)
+	return b.String()
+}
+
+// Projects returns the +project words of the text, without the plus
+func (t Task) Projects() []string {
+	return t.prefixed('+')
+}
+
+// Contexts returns the @context words of the text, without the at sign
+func (t Task) Contexts() []string {
+	return t.prefixed('@')
+}
+
+func (t Task) prefixed(c byte) []string {
+	words := []string{}
+	for _, word := range strings.Fields(t.Text) {
+		if len(word) > 1 && word[0] == c {
+			words = append(words, word[1:])
+		}
+	}
+	return words
+}
+
+// Value returns the value of the first key:value tag with the key. Words
+// such as URLs, whose value starts with //, aren't tags.
+func (t Task) Value(key string) (string, bool) {
+	for _, word := range strings.Fields(t.Text) {
+		k, v, ok := strings.Cut(word, ":")
+		if ok && k == key && v != "" && !strings.Contains(v, ":") && !strings.HasPrefix(v, "//") {
+			return v, true
+		}
+	}
+	return "", false
+}
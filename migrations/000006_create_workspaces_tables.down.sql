@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS todo_workspace_id_idx;
+ALTER TABLE notes DROP COLUMN IF EXISTS workspace_id;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,30 @@
+-- Filename: migrations/000006_create_workspaces_tables.up.sql
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    personal boolean NOT NULL DEFAULT false,
+    version int NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id),
+    CONSTRAINT workspace_members_role_check CHECK (role IN ('owner', 'admin', 'member', 'viewer'))
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+-- Notes that existed before workspaces were introduced are kept in a shared
+-- workspace. Members can be added to it through the API.
+INSERT INTO workspaces (name) VALUES ('Default');
+
+ALTER TABLE notes ADD COLUMN workspace_id bigint REFERENCES workspaces ON DELETE CASCADE;
+UPDATE notes SET workspace_id = (SELECT MIN(id) FROM workspaces);
+ALTER TABLE notes ALTER COLUMN workspace_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS todo_workspace_id_idx ON notes (workspace_id);
@@ -0,0 +1,3 @@
+DROP POLICY IF EXISTS notes_workspace_member_policy ON notes;
+ALTER TABLE notes NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE notes DISABLE ROW LEVEL SECURITY;
@@ -0,0 +1,19 @@
+-- Filename: migrations/000007_enable_notes_row_level_security.up.sql
+
+-- Notes are only visible to members of their workspace. The user is taken from
+-- the app.user_id setting that the application sets with SET LOCAL at the start
+-- of every transaction. When the setting is missing no rows are visible.
+-- FORCE makes the policy apply to the table owner as well. Superusers and roles
+-- with BYPASSRLS are still exempt, so the API must not connect as one of them.
+ALTER TABLE notes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE notes FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY notes_workspace_member_policy ON notes
+    USING (workspace_id IN (
+        SELECT workspace_id FROM workspace_members
+        WHERE user_id = NULLIF(current_setting('app.user_id', true), '')::bigint
+    ))
+    WITH CHECK (workspace_id IN (
+        SELECT workspace_id FROM workspace_members
+        WHERE user_id = NULLIF(current_setting('app.user_id', true), '')::bigint
+    ));
@@ -0,0 +1,20 @@
+-- Filename: migrations/000008_create_user_identities_table.up.sql
+
+-- Users created through single sign-on don't have a password
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+
+-- Pending authorization code logins, keyed on the hash of their state value
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    state_hash bytea PRIMARY KEY,
+    code_verifier text NOT NULL,
+    nonce text NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
@@ -0,0 +1,20 @@
+-- Filename: migrations/000010_create_totp_tables.up.sql
+
+-- The secret has to be readable to check codes, so it is stored as is
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    secret text NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    failed_attempts int NOT NULL DEFAULT 0,
+    locked_until timestamp(0) with time zone
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    hash bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_id_idx ON user_recovery_codes (user_id);
@@ -0,0 +1,10 @@
+-- Filename: migrations/000011_create_login_throttles_table.up.sql
+
+-- Login attempts are counted, before the password is checked, per account
+-- ("email:<address>") and per client address ("ip:<address>")
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key text PRIMARY KEY,
+    failures int NOT NULL DEFAULT 0,
+    last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone
+);
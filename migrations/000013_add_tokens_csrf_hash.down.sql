@@ -0,0 +1 @@
+ALTER TABLE tokens DROP COLUMN IF EXISTS csrf_hash;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Filename: migrations/000013_add_tokens_csrf_hash.up.sql
+
+-- Browser sessions carry a synchronizer token that unsafe requests must echo
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS csrf_hash bytea;
@@ -0,0 +1,15 @@
+-- Filename: migrations/000014_create_idempotency_keys_table.up.sql
+
+-- Responses stored against the Idempotency-Key a client sent. A row without a
+-- status belongs to a request that is still being processed.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    key text NOT NULL,
+    request_hash bytea NOT NULL,
+    status integer,
+    headers jsonb,
+    body bytea,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
@@ -0,0 +1,15 @@
+-- Filename: migrations/000015_create_import_jobs_table.up.sql
+
+-- Large CSV imports run in the background. The row errors are kept as a JSON
+-- object keyed by line number.
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending',
+    total_rows integer NOT NULL,
+    imported_rows integer NOT NULL DEFAULT 0,
+    errors jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone
+);
@@ -0,0 +1,2 @@
+-- The owners given to orphaned workspaces are kept, since they can't be told
+-- apart from owners added since.
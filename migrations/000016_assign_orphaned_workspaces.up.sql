@@ -0,0 +1,14 @@
+-- Filename: migrations/000016_assign_orphaned_workspaces.up.sql
+
+-- Databases migrated before 000006 seeded an owner have a Default workspace
+-- without members, whose notes nobody can reach. Give every such workspace
+-- to the oldest user.
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT w.id, owner.id, 'owner'
+FROM workspaces w
+CROSS JOIN (
+    SELECT id FROM users ORDER BY id ASC LIMIT 1
+) owner
+WHERE NOT EXISTS (
+    SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = w.id
+);
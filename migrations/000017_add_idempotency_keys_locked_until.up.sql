@@ -0,0 +1,5 @@
+-- Filename: migrations/000017_add_idempotency_keys_locked_until.up.sql
+
+-- A claim on a key only lasts until locked_until, so a request that died
+-- without releasing its key doesn't block retries until the key expires
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until timestamp(0) with time zone NOT NULL DEFAULT NOW();
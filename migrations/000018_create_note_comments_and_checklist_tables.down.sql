@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS note_checklist_items;
+DROP TABLE IF EXISTS note_comments;
\ No newline at end of file
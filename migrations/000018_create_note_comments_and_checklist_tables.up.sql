@@ -0,0 +1,38 @@
+-- Filename: migrations/000018_create_note_comments_and_checklist_tables.up.sql
+
+-- Comments and checklist items belong to a note. Their policies only let a
+-- row through if its note is visible, and the notes policy in turn only shows
+-- the notes of the user's workspaces, so they need no workspace of their own.
+CREATE TABLE IF NOT EXISTS note_comments (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    body text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS note_comments_note_id_idx ON note_comments (note_id);
+
+CREATE TABLE IF NOT EXISTS note_checklist_items (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    text text NOT NULL,
+    done boolean NOT NULL DEFAULT false,
+    position integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS note_checklist_items_note_id_idx ON note_checklist_items (note_id);
+
+ALTER TABLE note_comments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE note_comments FORCE ROW LEVEL SECURITY;
+CREATE POLICY note_comments_note_policy ON note_comments
+    USING (note_id IN (SELECT id FROM notes))
+    WITH CHECK (note_id IN (SELECT id FROM notes));
+
+ALTER TABLE note_checklist_items ENABLE ROW LEVEL SECURITY;
+ALTER TABLE note_checklist_items FORCE ROW LEVEL SECURITY;
+CREATE POLICY note_checklist_items_note_policy ON note_checklist_items
+    USING (note_id IN (SELECT id FROM notes))
+    WITH CHECK (note_id IN (SELECT id FROM notes));
@@ -0,0 +1 @@
+ALTER TABLE oidc_logins DROP COLUMN IF EXISTS binding_hash;
\ No newline at end of file
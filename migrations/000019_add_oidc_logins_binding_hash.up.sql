@@ -0,0 +1,7 @@
+-- Filename: migrations/000019_add_oidc_logins_binding_hash.up.sql
+
+-- A login can only be completed by the browser that started it, which holds
+-- the binding value in a cookie. Logins started before the column existed
+-- have no binding and are dropped; they expire within minutes anyway.
+DELETE FROM oidc_logins;
+ALTER TABLE oidc_logins ADD COLUMN IF NOT EXISTS binding_hash bytea NOT NULL;
@@ -0,0 +1,5 @@
+-- Filename: migrations/000020_add_users_is_admin.up.sql
+
+-- Administrators can unlock accounts. Databases migrated when 000011 still
+-- added the column already have it.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin boolean NOT NULL DEFAULT false;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000021_add_notes_todotxt_line.up.sql
+
+-- Notes imported from todo.txt keep the line they came from, so that they
+-- export as that same line while their fields are unchanged. Other notes
+-- have an empty line.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS todotxt_line text NOT NULL DEFAULT '';